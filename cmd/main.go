@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"log"
+	"time"
 
 	"github.com/dedpnd/unifier/internal/adapter/api/router"
 	"github.com/dedpnd/unifier/internal/adapter/store"
@@ -11,6 +13,8 @@ import (
 	"github.com/dedpnd/unifier/internal/logger"
 )
 
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 	// Создаем логер
 	lg, err := logger.Init("info")
@@ -32,7 +36,12 @@ func main() {
 	}
 
 	// Запускаем пул воркеров
-	p, err := worker.StartPool(cfg.KafkaAdress, str, lg)
+	backoff := worker.DefaultBackoff
+	backoff.MaxRestarts = cfg.WorkerMaxRestarts
+
+	commit := worker.Commit{Interval: cfg.CommitInterval, Batch: cfg.CommitBatch}
+
+	p, err := worker.StartPool(cfg.KafkaAdress, str, lg, backoff, commit)
 	if err != nil {
 		lg.Fatal(err.Error())
 	}
@@ -45,12 +54,18 @@ func main() {
 
 	// Функция для завершения работы
 	callback := func() {
+		// Воркеры останавливаются первыми и дообрабатывают текущие сообщения
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		if err := p.StopPool(ctx); err != nil {
+			lg.Error(err.Error())
+		}
+
 		err := str.Close()
 		if err != nil {
 			lg.Info(err.Error())
 		}
-
-		p.StopPool()
 	}
 
 	// Поднимаем сервер
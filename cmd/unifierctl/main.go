@@ -0,0 +1,262 @@
+// unifierctl - офлайн проверка правил унификации на файлах с событиями.
+//
+//	unifierctl test rule.json events.jsonl
+//	unifierctl lint rule.json
+//	unifierctl diff old.json new.json events.jsonl
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dedpnd/unifier/internal/adapter/api/util"
+	"github.com/dedpnd/unifier/internal/core/worker"
+	"github.com/dedpnd/unifier/internal/models"
+)
+
+const usage = `usage:
+  unifierctl test <rule.json> <events.jsonl>        apply rule and print unified events
+  unifierctl lint <rule.json>                       validate rule
+  unifierctl diff <old.json> <new.json> <events.jsonl>  compare output of two rules
+`
+
+// Максимальный размер строки с событием.
+const maxLineSize = 10 * 1024 * 1024
+
+// Коды завершения.
+const (
+	exitOK = iota
+	// exitFailed - найдены ошибки в правиле, событиях или отличия в выводе
+	exitFailed
+	exitUsage
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+
+	var (
+		code int
+		err  error
+	)
+
+	switch cmd, params := args[0], args[1:]; {
+	case cmd == "test" && len(params) == 2:
+		code, err = runTest(params[0], params[1], stdout, stderr)
+	case cmd == "lint" && len(params) == 1:
+		code, err = runLint(params[0], stdout)
+	case cmd == "diff" && len(params) == 3:
+		code, err = runDiff(params[0], params[1], params[2], stdout)
+	default:
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailed
+	}
+
+	return code
+}
+
+// runTest печатает унифицированные события, прошедшие фильтр, по одному в строке.
+// Ошибки преобразования выводятся в stderr с номером строки входного файла.
+func runTest(rulePath, eventsPath string, stdout, stderr io.Writer) (int, error) {
+	rule, err := loadRule(rulePath)
+	if err != nil {
+		return exitFailed, err
+	}
+
+	code := exitOK
+	enc := json.NewEncoder(stdout)
+
+	err = eachEvent(eventsPath, func(line int, raw []byte) error {
+		res := rule.DryRun(raw)
+
+		for _, e := range res.Errors {
+			fmt.Fprintf(stderr, "%v:%d: %v\n", eventsPath, line, e)
+			code = exitFailed
+		}
+
+		if !res.Matched {
+			return nil
+		}
+
+		if err := enc.Encode(res.Output); err != nil {
+			return fmt.Errorf("failed write event: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return exitFailed, err
+	}
+
+	return code, nil
+}
+
+// runLint проверяет правило так же, как API при сохранении: структуру,
+// топики, типы полей, функции и регулярные выражения.
+func runLint(rulePath string, stdout io.Writer) (int, error) {
+	cfg, err := loadConfig(rulePath)
+	if err != nil {
+		return exitFailed, err
+	}
+
+	if _, err := worker.ValidateRule(cfg); err != nil {
+		var ve *worker.ValidationError
+		if !errors.As(err, &ve) {
+			return exitFailed, fmt.Errorf("%v: %w", rulePath, err)
+		}
+
+		for _, fe := range ve.Errors {
+			fmt.Fprintf(stdout, "%v: %v\n", rulePath, fe)
+		}
+		return exitFailed, nil
+	}
+
+	fmt.Fprintf(stdout, "%v: ok\n", rulePath)
+
+	return exitOK, nil
+}
+
+// runDiff печатает события, результат обработки которых двумя правилами отличается.
+func runDiff(oldPath, newPath, eventsPath string, stdout io.Writer) (int, error) {
+	oldRule, err := loadRule(oldPath)
+	if err != nil {
+		return exitFailed, err
+	}
+
+	newRule, err := loadRule(newPath)
+	if err != nil {
+		return exitFailed, err
+	}
+
+	code := exitOK
+
+	err = eachEvent(eventsPath, func(line int, raw []byte) error {
+		a, err := json.Marshal(oldRule.DryRun(raw))
+		if err != nil {
+			return fmt.Errorf("failed marshal result: %w", err)
+		}
+
+		b, err := json.Marshal(newRule.DryRun(raw))
+		if err != nil {
+			return fmt.Errorf("failed marshal result: %w", err)
+		}
+
+		changes, err := util.Diff(a, b)
+		if err != nil {
+			return fmt.Errorf("failed diff results: %w", err)
+		}
+
+		if len(changes) == 0 {
+			return nil
+		}
+
+		code = exitFailed
+		fmt.Fprintf(stdout, "%v:%d:\n", eventsPath, line)
+		for _, c := range changes {
+			printChange(stdout, c)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return exitFailed, err
+	}
+
+	return code, nil
+}
+
+func printChange(w io.Writer, c util.Change) {
+	from, _ := json.Marshal(c.From)
+	to, _ := json.Marshal(c.To)
+
+	switch c.Op {
+	case util.DiffAdd:
+		fmt.Fprintf(w, "  + %v: %s\n", c.Path, to)
+	case util.DiffRemove:
+		fmt.Fprintf(w, "  - %v: %s\n", c.Path, from)
+	default:
+		fmt.Fprintf(w, "  ~ %v: %s -> %s\n", c.Path, from, to)
+	}
+}
+
+// loadRule читает и компилирует правило.
+func loadRule(path string) (*worker.Rule, error) {
+	cfg, err := loadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	rule, err := worker.CompileRule(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+
+	return rule, nil
+}
+
+// loadConfig читает правило. Неизвестные поля считаются ошибкой,
+// чтобы опечатки в названиях секций не проходили незамеченными.
+func loadConfig(path string) (models.Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return models.Config{}, fmt.Errorf("failed read rule: %w", err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var cfg models.Config
+	if err := dec.Decode(&cfg); err != nil {
+		return models.Config{}, fmt.Errorf("%v: invalid rule: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+// eachEvent вызывает fn для каждой непустой строки файла в формате JSONL.
+func eachEvent(path string, fn func(line int, raw []byte) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed open events: %w", err)
+	}
+	defer f.Close() //nolint:errcheck // Файл открыт только на чтение
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxLineSize)
+
+	for line := 1; sc.Scan(); line++ {
+		raw := bytes.TrimSpace(sc.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+
+		if err := fn(line, raw); err != nil {
+			return err
+		}
+	}
+
+	if err := sc.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return fmt.Errorf("%v: line longer than %d bytes", path, maxLineSize)
+		}
+		return fmt.Errorf("failed read events: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, name, data string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestRun(t *testing.T) {
+	rule := writeFile(t, "rule.json",
+		`{"topicFrom": "events", "topicTo": "test", "filter": {"field": "proto", "eq": "tcp"}, "unifier": [{"name": "port", "type": "int", "expression": "dst.port"}]}`)
+	newRule := writeFile(t, "new.json",
+		`{"filter": {"field": "proto", "eq": "tcp"}, "unifier": [{"name": "port", "type": "string", "expression": "dst.port"}]}`)
+	badRule := writeFile(t, "bad.json", `{"unifier": [{"name": "port", "type": "integer", "expression": "dst.port"}]}`)
+	typoRule := writeFile(t, "typo.json", `{"unifer": []}`)
+	events := writeFile(t, "events.jsonl",
+		`{"proto": "tcp", "dst": {"port": "443"}}`+"\n\n"+`{"proto": "udp"}`+"\n"+`{"proto": "tcp", "dst": {"port": "x"}}`+"\n")
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantStdout string
+		wantStderr string
+	}{
+		{name: "No args", args: nil, wantCode: exitUsage},
+		{name: "Unknown command", args: []string{"run", rule}, wantCode: exitUsage},
+		{
+			name:       "Test",
+			args:       []string{"test", rule, events},
+			wantCode:   exitFailed,
+			wantStdout: `{"entity":"d41d8cd98f00b204e9800998ecf8427e","port":443}` + "\n" + `{"entity":"d41d8cd98f00b204e9800998ecf8427e"}` + "\n",
+			wantStderr: events + `:4: unifier port: cannot convert "x" to int` + "\n",
+		},
+		{name: "Lint", args: []string{"lint", rule}, wantCode: exitOK, wantStdout: rule + ": ok\n"},
+		{
+			name:     "Lint unknown type",
+			args:     []string{"lint", badRule},
+			wantCode: exitFailed,
+			wantStdout: badRule + ": /unifier/0/type: unknown type: integer\n" +
+				badRule + ": /topicFrom: is required\n" +
+				badRule + ": /topicTo: is required\n",
+		},
+		{name: "Lint unknown section", args: []string{"lint", typoRule}, wantCode: exitFailed},
+		{name: "Lint missing file", args: []string{"lint", rule + ".missing"}, wantCode: exitFailed},
+		{name: "Diff same rule", args: []string{"diff", rule, rule, events}, wantCode: exitOK},
+		{
+			name:     "Diff",
+			args:     []string{"diff", rule, newRule, events},
+			wantCode: exitFailed,
+			wantStdout: events + ":1:\n" +
+				`  ~ /output/port: 443 -> "443"` + "\n" +
+				events + ":4:\n" +
+				`  - /errors: ["unifier port: cannot convert \"x\" to int"]` + "\n" +
+				`  + /output/port: "x"` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+
+			code := run(tt.args, &stdout, &stderr)
+			assert.Equal(t, tt.wantCode, code, stderr.String())
+
+			if tt.wantStdout != "" || tt.wantCode == exitOK {
+				assert.Equal(t, tt.wantStdout, stdout.String())
+			}
+			if tt.wantStderr != "" {
+				assert.Equal(t, tt.wantStderr, stderr.String())
+			}
+		})
+	}
+}
@@ -2,8 +2,11 @@ package middleware
 
 import (
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/dedpnd/unifier/internal/metrics"
+	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
 )
 
@@ -34,6 +37,21 @@ func Logger(lg *zap.Logger) func(h http.Handler) http.Handler {
 
 			duration := time.Since(start)
 
+			// Шаблон маршрута вместо URI, чтобы не плодить серии по ID
+			route := "unknown"
+			if rctx := chi.RouteContext(req.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				route = rctx.RoutePattern()
+			}
+
+			status := o.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			metrics.HTTPRequestDuration.
+				WithLabelValues(req.Method, route, strconv.Itoa(status)).
+				Observe(duration.Seconds())
+
 			lg.Info("Fetch URL:",
 				zap.String("method", req.Method),
 				zap.String("uri", req.RequestURI),
@@ -2,12 +2,18 @@ package rest
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/dedpnd/unifier/internal/adapter/api/util"
 	"github.com/dedpnd/unifier/internal/adapter/store"
+	"github.com/dedpnd/unifier/internal/core/auth"
 	"github.com/dedpnd/unifier/internal/core/worker"
 	"github.com/dedpnd/unifier/internal/models"
 	"github.com/go-chi/chi/v5"
@@ -17,11 +23,14 @@ import (
 type RulesHandler struct {
 	Logger *zap.Logger
 	Store  store.Storage
-	Pool   worker.Pool
+	Pool   *worker.Pool
 }
 
 const IntServerError = "internal server error"
 
+// workerStopTimeout ограничивает ожидание остановки воркера при изменении и удалении правила.
+const workerStopTimeout = 10 * time.Second
+
 func (h RulesHandler) GetAllRules(res http.ResponseWriter, req *http.Request) {
 	data, err := h.Store.GetAllRules(req.Context())
 	if err != nil {
@@ -56,65 +65,289 @@ func (h RulesHandler) CreateRule(res http.ResponseWriter, req *http.Request) {
 
 	pBody := models.Config{}
 
-	if err := json.NewDecoder(req.Body).Decode(&pBody); err != nil {
-		http.Error(res, `invalid parsing JSON`, http.StatusBadRequest)
+	if !decodeStrict(h.Logger, res, req.Body, &pBody) {
 		return
 	}
 
-	id, err := h.Store.CreateRule(req.Context(), pBody, token.ID)
+	// Правило проверяется до сохранения, чтобы ошибка не дошла до воркера
+	rule, err := h.validateRule(pBody)
+	if err != nil {
+		writeValidationError(h.Logger, res, err)
+		return
+	}
+
+	id, err := h.Store.CreateRule(req.Context(), pBody, authorFromToken(token))
 	if err != nil {
 		h.Logger.With(zap.Error(err)).Error("failed save rule")
 		http.Error(res, IntServerError, http.StatusInternalServerError)
 		return
 	}
 
+	// Новое правило всегда начинается с первой версии
+	rule.SetVersion(1)
+
 	pID := strconv.Itoa(id)
-	h.Pool.AddWorker(pID, pBody)
+	if err := h.Pool.AddWorker(req.Context(), pID, rule); err != nil {
+		h.Logger.With(zap.Error(err)).Error("failed start worker")
+		http.Error(res, IntServerError, http.StatusInternalServerError)
+		return
+	}
 
 	res.WriteHeader(http.StatusOK)
 }
 
-func (h RulesHandler) DeleteRule(res http.ResponseWriter, req *http.Request) {
-	token, ok := util.GetTokenFromContext(req.Context())
+// TestRuleRequest - правило и примеры событий для пробного запуска.
+// Событие задается объектом JSON или строкой с исходным сообщением.
+type TestRuleRequest struct {
+	Rule   models.Config     `json:"rule"`
+	Events []json.RawMessage `json:"events"`
+}
+
+// TestRule прогоняет примеры событий через правило без Kafka.
+func (h RulesHandler) TestRule(res http.ResponseWriter, req *http.Request) {
+	pBody := TestRuleRequest{}
+
+	if !decodeStrict(h.Logger, res, req.Body, &pBody) {
+		return
+	}
+
+	// Топики для пробного запуска не нужны, поэтому достаточно компиляции
+	rule, err := worker.CompileRule(pBody.Rule)
+	if err != nil {
+		writeValidationError(h.Logger, res, err)
+		return
+	}
+
+	results := make([]worker.DryRunResult, 0, len(pBody.Events))
+	for _, e := range pBody.Events {
+		// Сообщения не в формате JSON передаются строкой
+		raw := []byte(e)
+		var text string
+		if err := json.Unmarshal(e, &text); err == nil {
+			raw = []byte(text)
+		}
+
+		results = append(results, rule.DryRun(raw))
+	}
+
+	writeJSON(h.Logger, res, results)
+}
+
+func (h RulesHandler) UpdateRule(res http.ResponseWriter, req *http.Request) {
+	rule, author, ok := h.ownedRule(res, req)
 	if !ok {
-		h.Logger.Error("invalid jwt token")
+		return
+	}
+
+	pBody := models.Config{}
+
+	if !decodeStrict(h.Logger, res, req.Body, &pBody) {
+		return
+	}
+
+	h.applyRule(res, req, rule.ID, pBody, author, h.Store.UpdateRule)
+}
+
+func (h RulesHandler) PatchRule(res http.ResponseWriter, req *http.Request) {
+	rule, author, ok := h.ownedRule(res, req)
+	if !ok {
+		return
+	}
+
+	patch, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(res, `failed read body`, http.StatusBadRequest)
+		return
+	}
+
+	doc, err := json.Marshal(rule.Rule)
+	if err != nil {
+		h.Logger.With(zap.Error(err)).Error("failed marshal rule")
 		http.Error(res, IntServerError, http.StatusInternalServerError)
 		return
 	}
 
-	id := chi.URLParam(req, "id")
+	merged, err := util.MergePatch(doc, patch)
+	if err != nil {
+		http.Error(res, `invalid parsing JSON`, http.StatusBadRequest)
+		return
+	}
+
+	pBody := models.Config{}
+
+	if !decodeStrict(h.Logger, res, bytes.NewReader(merged), &pBody) {
+		return
+	}
 
-	pID, err := strconv.Atoi(id)
+	h.applyRule(res, req, rule.ID, pBody, author, h.Store.UpdateRule)
+}
+
+// saveFunc сохраняет новую версию правила.
+type saveFunc func(ctx context.Context, id int, rule models.Config, author models.Author) (int, error)
+
+// applyRule проверяет и сохраняет новую конфигурацию правила, после чего
+// перезагружает воркер.
+func (h RulesHandler) applyRule(res http.ResponseWriter, req *http.Request, id int, cfg models.Config,
+	author models.Author, save saveFunc) {
+	rule, err := h.validateRule(cfg)
 	if err != nil {
-		http.Error(res, `failde convert id to int`, http.StatusBadRequest)
+		writeValidationError(h.Logger, res, err)
 		return
 	}
 
-	dr, err := h.Store.GetRuleByID(req.Context(), pID)
+	version, err := save(req.Context(), id, cfg, author)
 	if err != nil {
-		h.Logger.With(zap.Error(err)).Error("failed get rule")
+		h.Logger.With(zap.Error(err)).Error("failed update rule")
 		http.Error(res, IntServerError, http.StatusInternalServerError)
 		return
 	}
+	rule.SetVersion(version)
 
-	if dr.ID == 0 {
-		http.Error(res, "not found", http.StatusNotFound)
+	ctx, cancel := context.WithTimeout(req.Context(), workerStopTimeout)
+	defer cancel()
+
+	err = h.Pool.ReloadWorker(ctx, strconv.Itoa(id), rule)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		// Новый воркер запустится после остановки старого
+		h.Logger.With(zap.Error(err)).Warn("failed wait worker shutdown")
+	case err != nil:
+		h.Logger.With(zap.Error(err)).Error("failed reload worker")
+		http.Error(res, IntServerError, http.StatusInternalServerError)
 		return
 	}
 
-	if dr.Owner == nil || *dr.Owner != token.ID {
-		http.Error(res, "forbidden", http.StatusForbidden)
+	res.WriteHeader(http.StatusOK)
+}
+
+func (h RulesHandler) DeleteRule(res http.ResponseWriter, req *http.Request) {
+	dr, author, ok := h.ownedRule(res, req)
+	if !ok {
 		return
 	}
 
-	err = h.Store.DeleteRule(req.Context(), pID)
+	err := h.Store.DeleteRule(req.Context(), dr.ID, author)
 	if err != nil {
 		h.Logger.With(zap.Error(err)).Error("failed delete rule")
 		http.Error(res, IntServerError, http.StatusInternalServerError)
 		return
 	}
 
-	h.Pool.DeleteWorker(id)
+	ctx, cancel := context.WithTimeout(req.Context(), workerStopTimeout)
+	defer cancel()
+
+	// Правило уже удалено, воркер завершится сам после остановки соединений
+	if err := h.Pool.DeleteWorker(ctx, strconv.Itoa(dr.ID)); err != nil {
+		h.Logger.With(zap.Error(err)).Warn("failed wait worker shutdown")
+	}
 
 	res.WriteHeader(http.StatusOK)
 }
+
+// validateRule проверяет правило перед сохранением, в том числе по контракту topicTo.
+func (h RulesHandler) validateRule(cfg models.Config) (*worker.Rule, error) {
+	rule, err := worker.ValidateRule(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.Pool.CheckRule(rule); err != nil {
+		return nil, err
+	}
+
+	return rule, nil
+}
+
+// decodeStrict разбирает тело запроса так же, как unifierctl lint: неизвестный
+// ключ отвечается 422, чтобы опечатка в имени поля не терялась молча.
+// При ошибке ответ уже записан.
+func decodeStrict(lg *zap.Logger, res http.ResponseWriter, r io.Reader, v interface{}) bool {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(v)
+	if err == nil {
+		return true
+	}
+
+	// encoding/json не экспортирует тип этой ошибки и не сообщает путь до поля
+	if msg := strings.TrimPrefix(err.Error(), "json: "); strings.HasPrefix(msg, "unknown field ") {
+		writeValidationError(lg, res, &worker.ValidationError{Errors: []worker.FieldError{{Message: msg}}})
+		return false
+	}
+
+	http.Error(res, `invalid parsing JSON`, http.StatusBadRequest)
+	return false
+}
+
+// writeValidationError отвечает 422 со списком ошибок полей.
+func writeValidationError(lg *zap.Logger, res http.ResponseWriter, err error) {
+	var ve *worker.ValidationError
+	if !errors.As(err, &ve) {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resBodyBytes := new(bytes.Buffer)
+	if err := json.NewEncoder(resBodyBytes).Encode(ve.Errors); err != nil {
+		lg.With(zap.Error(err)).Error("failed encode validation errors")
+		http.Error(res, IntServerError, http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusUnprocessableEntity)
+
+	if _, err := res.Write(resBodyBytes.Bytes()); err != nil {
+		lg.With(zap.Error(err)).Error("failed write validation errors to response")
+	}
+}
+
+// ownedRule возвращает правило из URL, если оно принадлежит пользователю
+// из токена, и автора изменения. При ошибке ответ уже записан.
+func (h RulesHandler) ownedRule(res http.ResponseWriter, req *http.Request) (models.Rule, models.Author, bool) {
+	token, ok := util.GetTokenFromContext(req.Context())
+	if !ok {
+		h.Logger.Error("invalid jwt token")
+		http.Error(res, IntServerError, http.StatusInternalServerError)
+		return models.Rule{}, models.Author{}, false
+	}
+
+	pID, ok := ruleID(res, req)
+	if !ok {
+		return models.Rule{}, models.Author{}, false
+	}
+
+	dr, err := h.Store.GetRuleByID(req.Context(), pID)
+	if err != nil {
+		h.Logger.With(zap.Error(err)).Error("failed get rule")
+		http.Error(res, IntServerError, http.StatusInternalServerError)
+		return models.Rule{}, models.Author{}, false
+	}
+
+	if dr.ID == 0 {
+		http.Error(res, "not found", http.StatusNotFound)
+		return models.Rule{}, models.Author{}, false
+	}
+
+	if dr.Owner == nil || *dr.Owner != token.ID {
+		http.Error(res, "forbidden", http.StatusForbidden)
+		return models.Rule{}, models.Author{}, false
+	}
+
+	return dr, authorFromToken(token), true
+}
+
+func ruleID(res http.ResponseWriter, req *http.Request) (int, bool) {
+	pID, err := strconv.Atoi(chi.URLParam(req, "id"))
+	if err != nil {
+		http.Error(res, `failde convert id to int`, http.StatusBadRequest)
+		return 0, false
+	}
+
+	return pID, true
+}
+
+func authorFromToken(token auth.Claims) models.Author {
+	return models.Author{ID: token.ID, Login: token.Login}
+}
@@ -0,0 +1,142 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/dedpnd/unifier/internal/adapter/api/util"
+	"github.com/dedpnd/unifier/internal/adapter/store"
+	"github.com/dedpnd/unifier/internal/core/auth"
+	"github.com/dedpnd/unifier/internal/core/worker"
+	"github.com/dedpnd/unifier/internal/models"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// TopicsHandler управляет контрактами выходных топиков.
+type TopicsHandler struct {
+	Logger *zap.Logger
+	Store  store.Storage
+	Pool   *worker.Pool
+}
+
+func (h TopicsHandler) GetTopicSchemas(res http.ResponseWriter, req *http.Request) {
+	schemas, err := h.Store.GetTopicSchemas(req.Context())
+	if err != nil {
+		h.Logger.With(zap.Error(err)).Error("failed get topic schemas")
+		http.Error(res, IntServerError, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(h.Logger, res, schemas)
+}
+
+func (h TopicsHandler) GetTopicSchema(res http.ResponseWriter, req *http.Request) {
+	ts, err := h.Store.GetTopicSchema(req.Context(), chi.URLParam(req, "topic"))
+	if err != nil {
+		h.Logger.With(zap.Error(err)).Error("failed get topic schema")
+		http.Error(res, IntServerError, http.StatusInternalServerError)
+		return
+	}
+
+	if ts.Topic == "" {
+		http.Error(res, "not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(h.Logger, res, ts)
+}
+
+// PutTopicSchema создает или заменяет схему топика. Новая схема сразу
+// применяется воркерами. Схему может заменить только ее владелец, а
+// сохраненные правила топика должны ей соответствовать.
+func (h TopicsHandler) PutTopicSchema(res http.ResponseWriter, req *http.Request) {
+	token, ok := h.ownedSchema(res, req)
+	if !ok {
+		return
+	}
+
+	pBody := models.TopicSchema{}
+
+	if err := json.NewDecoder(req.Body).Decode(&pBody); err != nil {
+		http.Error(res, `invalid parsing JSON`, http.StatusBadRequest)
+		return
+	}
+	pBody.Topic = chi.URLParam(req, "topic")
+
+	c, err := worker.CompileContract(pBody)
+	if err != nil {
+		writeValidationError(h.Logger, res, err)
+		return
+	}
+	pBody.Mode = c.Mode()
+
+	// Схема не должна противоречить правилам, которые уже пишут в топик
+	rules, err := h.Store.GetAllRules(req.Context())
+	if err != nil {
+		h.Logger.With(zap.Error(err)).Error("failed get all records from database")
+		http.Error(res, IntServerError, http.StatusInternalServerError)
+		return
+	}
+	if err := c.CheckRules(rules); err != nil {
+		writeValidationError(h.Logger, res, err)
+		return
+	}
+
+	// Владелец задается при создании схемы, при замене он не меняется
+	pBody.Owner = &token.ID
+
+	ts, err := h.Store.SaveTopicSchema(req.Context(), pBody)
+	if err != nil {
+		h.Logger.With(zap.Error(err)).Error("failed save topic schema")
+		http.Error(res, IntServerError, http.StatusInternalServerError)
+		return
+	}
+
+	h.Pool.SetContract(c)
+
+	writeJSON(h.Logger, res, ts)
+}
+
+func (h TopicsHandler) DeleteTopicSchema(res http.ResponseWriter, req *http.Request) {
+	if _, ok := h.ownedSchema(res, req); !ok {
+		return
+	}
+
+	topic := chi.URLParam(req, "topic")
+
+	if err := h.Store.DeleteTopicSchema(req.Context(), topic); err != nil {
+		h.Logger.With(zap.Error(err)).Error("failed delete topic schema")
+		http.Error(res, IntServerError, http.StatusInternalServerError)
+		return
+	}
+
+	h.Pool.DeleteContract(topic)
+
+	res.WriteHeader(http.StatusOK)
+}
+
+// ownedSchema проверяет, что схема топика из URL еще не создана или принадлежит
+// пользователю из токена, и возвращает токен. При ошибке ответ уже записан.
+func (h TopicsHandler) ownedSchema(res http.ResponseWriter, req *http.Request) (auth.Claims, bool) {
+	token, ok := util.GetTokenFromContext(req.Context())
+	if !ok {
+		h.Logger.Error("invalid jwt token")
+		http.Error(res, IntServerError, http.StatusInternalServerError)
+		return auth.Claims{}, false
+	}
+
+	ts, err := h.Store.GetTopicSchema(req.Context(), chi.URLParam(req, "topic"))
+	if err != nil {
+		h.Logger.With(zap.Error(err)).Error("failed get topic schema")
+		http.Error(res, IntServerError, http.StatusInternalServerError)
+		return auth.Claims{}, false
+	}
+
+	if ts.Topic != "" && (ts.Owner == nil || *ts.Owner != token.ID) {
+		http.Error(res, "forbidden", http.StatusForbidden)
+		return auth.Claims{}, false
+	}
+
+	return token, true
+}
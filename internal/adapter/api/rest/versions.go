@@ -0,0 +1,154 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/dedpnd/unifier/internal/adapter/api/util"
+	"github.com/dedpnd/unifier/internal/models"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// RuleDiff - отличия между двумя версиями правила.
+type RuleDiff struct {
+	From    int           `json:"from"`
+	To      int           `json:"to"`
+	Changes []util.Change `json:"changes"`
+}
+
+func (h RulesHandler) GetRuleVersions(res http.ResponseWriter, req *http.Request) {
+	pID, ok := ruleID(res, req)
+	if !ok {
+		return
+	}
+
+	versions, err := h.Store.GetRuleVersions(req.Context(), pID)
+	if err != nil {
+		h.Logger.With(zap.Error(err)).Error("failed get rule versions")
+		http.Error(res, IntServerError, http.StatusInternalServerError)
+		return
+	}
+
+	// История удаленного правила остается доступной
+	if len(versions) == 0 {
+		http.Error(res, "not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(h.Logger, res, versions)
+}
+
+// DiffRuleVersions сравнивает версии from и to из параметров запроса.
+// Если to не указан, сравнение идет с последней версией.
+func (h RulesHandler) DiffRuleVersions(res http.ResponseWriter, req *http.Request) {
+	pID, ok := ruleID(res, req)
+	if !ok {
+		return
+	}
+
+	from, err := strconv.Atoi(req.URL.Query().Get("from"))
+	if err != nil {
+		http.Error(res, `failed convert from to int`, http.StatusBadRequest)
+		return
+	}
+
+	versions, err := h.Store.GetRuleVersions(req.Context(), pID)
+	if err != nil {
+		h.Logger.With(zap.Error(err)).Error("failed get rule versions")
+		http.Error(res, IntServerError, http.StatusInternalServerError)
+		return
+	}
+
+	if len(versions) == 0 {
+		http.Error(res, "not found", http.StatusNotFound)
+		return
+	}
+
+	to := versions[len(versions)-1].Version
+	if q := req.URL.Query().Get("to"); q != "" {
+		to, err = strconv.Atoi(q)
+		if err != nil {
+			http.Error(res, `failed convert to to int`, http.StatusBadRequest)
+			return
+		}
+	}
+
+	var a, b *models.RuleVersion
+	for i := range versions {
+		if versions[i].Version == from {
+			a = &versions[i]
+		}
+		if versions[i].Version == to {
+			b = &versions[i]
+		}
+	}
+
+	if a == nil || b == nil {
+		http.Error(res, "version not found", http.StatusNotFound)
+		return
+	}
+
+	changes, err := diffConfigs(a.Rule, b.Rule)
+	if err != nil {
+		h.Logger.With(zap.Error(err)).Error("failed diff rule versions")
+		http.Error(res, IntServerError, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(h.Logger, res, RuleDiff{From: from, To: to, Changes: changes})
+}
+
+// RollbackRule сохраняет конфигурацию указанной версии как новую версию
+// правила и перезагружает воркер.
+func (h RulesHandler) RollbackRule(res http.ResponseWriter, req *http.Request) {
+	rule, author, ok := h.ownedRule(res, req)
+	if !ok {
+		return
+	}
+
+	version, err := strconv.Atoi(chi.URLParam(req, "version"))
+	if err != nil {
+		http.Error(res, `failed convert version to int`, http.StatusBadRequest)
+		return
+	}
+
+	v, err := h.Store.GetRuleVersion(req.Context(), rule.ID, version)
+	if err != nil {
+		h.Logger.With(zap.Error(err)).Error("failed get rule version")
+		http.Error(res, IntServerError, http.StatusInternalServerError)
+		return
+	}
+
+	if v.Version == 0 || v.Rule == nil {
+		http.Error(res, "version not found", http.StatusNotFound)
+		return
+	}
+
+	h.applyRule(res, req, rule.ID, *v.Rule, author, h.Store.RollbackRule)
+}
+
+func diffConfigs(a, b *models.Config) ([]util.Change, error) {
+	aj, err := json.Marshal(a)
+	if err != nil {
+		return nil, fmt.Errorf("failed marshal rule: %w", err)
+	}
+
+	bj, err := json.Marshal(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed marshal rule: %w", err)
+	}
+
+	changes, err := util.Diff(aj, bj)
+	if err != nil {
+		return nil, fmt.Errorf("failed diff rules: %w", err)
+	}
+
+	if changes == nil {
+		changes = []util.Change{}
+	}
+
+	return changes, nil
+}
@@ -0,0 +1,51 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/dedpnd/unifier/internal/core/worker"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+type WorkersHandler struct {
+	Logger *zap.Logger
+	Pool   *worker.Pool
+}
+
+func (h WorkersHandler) GetAllWorkers(res http.ResponseWriter, req *http.Request) {
+	writeJSON(h.Logger, res, h.Pool.Statuses())
+}
+
+func (h WorkersHandler) GetWorker(res http.ResponseWriter, req *http.Request) {
+	id := chi.URLParam(req, "id")
+
+	st, ok := h.Pool.Status(id)
+	if !ok {
+		http.Error(res, "not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(h.Logger, res, st)
+}
+
+// writeJSON отправляет данные в ответ в формате JSON.
+func writeJSON(lg *zap.Logger, res http.ResponseWriter, data interface{}) {
+	resBodyBytes := new(bytes.Buffer)
+	if err := json.NewEncoder(resBodyBytes).Encode(data); err != nil {
+		lg.With(zap.Error(err)).Error("failed encode response")
+		http.Error(res, IntServerError, http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+
+	_, err := res.Write(resBodyBytes.Bytes())
+	if err != nil {
+		lg.With(zap.Error(err)).Error("failed write response")
+		http.Error(res, IntServerError, http.StatusInternalServerError)
+		return
+	}
+}
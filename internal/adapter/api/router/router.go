@@ -5,15 +5,18 @@ import (
 	"github.com/dedpnd/unifier/internal/adapter/api/rest"
 	"github.com/dedpnd/unifier/internal/adapter/store"
 	"github.com/dedpnd/unifier/internal/core/worker"
+	"github.com/dedpnd/unifier/internal/metrics"
 	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
 )
 
-func Router(lg *zap.Logger, str store.Storage, pool worker.Pool) (chi.Router, error) {
+func Router(lg *zap.Logger, str store.Storage, pool *worker.Pool) (chi.Router, error) {
 	r := chi.NewRouter()
 
 	r.Use(middleware.Logger(lg))
 
+	r.Handle("/metrics", metrics.Handler())
+
 	rulesHandler := rest.RulesHandler{
 		Logger: lg,
 		Store:  str,
@@ -22,7 +25,32 @@ func Router(lg *zap.Logger, str store.Storage, pool worker.Pool) (chi.Router, er
 
 	r.With(middleware.JWTguard).Get("/api/rules", rulesHandler.GetAllRules)
 	r.With(middleware.JWTguard).Post("/api/rules", rulesHandler.CreateRule)
+	r.With(middleware.JWTguard).Post("/api/rules/test", rulesHandler.TestRule)
+	r.With(middleware.JWTguard).Put("/api/rules/{id}", rulesHandler.UpdateRule)
+	r.With(middleware.JWTguard).Patch("/api/rules/{id}", rulesHandler.PatchRule)
 	r.With(middleware.JWTguard).Delete("/api/rules/{id}", rulesHandler.DeleteRule)
+	r.With(middleware.JWTguard).Get("/api/rules/{id}/versions", rulesHandler.GetRuleVersions)
+	r.With(middleware.JWTguard).Get("/api/rules/{id}/diff", rulesHandler.DiffRuleVersions)
+	r.With(middleware.JWTguard).Post("/api/rules/{id}/rollback/{version}", rulesHandler.RollbackRule)
+
+	topicsHandler := rest.TopicsHandler{
+		Logger: lg,
+		Store:  str,
+		Pool:   pool,
+	}
+
+	r.With(middleware.JWTguard).Get("/api/topics/schemas", topicsHandler.GetTopicSchemas)
+	r.With(middleware.JWTguard).Get("/api/topics/{topic}/schema", topicsHandler.GetTopicSchema)
+	r.With(middleware.JWTguard).Put("/api/topics/{topic}/schema", topicsHandler.PutTopicSchema)
+	r.With(middleware.JWTguard).Delete("/api/topics/{topic}/schema", topicsHandler.DeleteTopicSchema)
+
+	workersHandler := rest.WorkersHandler{
+		Logger: lg,
+		Pool:   pool,
+	}
+
+	r.With(middleware.JWTguard).Get("/api/workers", workersHandler.GetAllWorkers)
+	r.With(middleware.JWTguard).Get("/api/workers/{id}", workersHandler.GetWorker)
 
 	userHandler := rest.UserHandler{
 		Logger: lg,
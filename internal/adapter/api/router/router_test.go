@@ -173,7 +173,7 @@ func TestRouter(t *testing.T) {
 			url:           "/api/rules",
 			expectedCode:  http.StatusOK,
 			//nolint:lll // This legal size
-			expectedBody: "[{\"id\":1,\"rule\":{\"topicFrom\":\"events\",\"filter\":{\"regexp\":\"\\\"dstHost.ip\\\": \\\"10.10.10.10\\\"\"},\"entityHash\":[\"srcHost.ip\",\"dstHost.port\"],\"unifier\":[{\"name\":\"id\",\"type\":\"string\",\"expression\":\"auditEventLog\"},{\"name\":\"date\",\"type\":\"timestamp\",\"expression\":\"datetime\"},{\"name\":\"ipaddr\",\"type\":\"string\",\"expression\":\"srcHost.ip\"},{\"name\":\"category\",\"type\":\"string\",\"expression\":\"cat\"}],\"extraProcess\":[{\"func\":\"__if\",\"args\":\"category, /Host/Connect/Host/Accept, high\",\"to\":\"category\"},{\"func\":\"__stringConstant\",\"args\":\"test\",\"to\":\"customString1\"}],\"topicTo\":\"test\"},\"owner\":null}]\n",
+			expectedBody: "[{\"id\":1,\"rule\":{\"topicFrom\":\"events\",\"filter\":{\"regexp\":\"\\\"dstHost.ip\\\": \\\"10.10.10.10\\\"\"},\"entityHash\":[\"srcHost.ip\",\"dstHost.port\"],\"unifier\":[{\"name\":\"id\",\"type\":\"string\",\"expression\":\"auditEventLog\"},{\"name\":\"date\",\"type\":\"timestamp\",\"expression\":\"datetime\"},{\"name\":\"ipaddr\",\"type\":\"string\",\"expression\":\"srcHost.ip\"},{\"name\":\"category\",\"type\":\"string\",\"expression\":\"cat\"}],\"extraProcess\":[{\"func\":\"__if\",\"args\":\"category, /Host/Connect/Host/Accept, high\",\"to\":\"category\"},{\"func\":\"__stringConstant\",\"args\":\"test\",\"to\":\"customString1\"}],\"topicTo\":\"test\"},\"owner\":null,\"version\":1}]\n",
 		},
 		{
 			name:          "Get all rules: token unauth",
@@ -190,10 +190,50 @@ func TestRouter(t *testing.T) {
 			url:           "/api/rules",
 			body: map[string]interface{}{
 				"topicFrom": "events",
+				"topicTo":   "test",
 			},
 			expectedCode: http.StatusOK,
 			expectedBody: "",
 		},
+		{
+			name:          "Add new rule: invalid rule",
+			method:        http.MethodPost,
+			authorization: true,
+			url:           "/api/rules",
+			body: map[string]interface{}{
+				"topicFrom": "events",
+				"topicTo":   "events",
+				"unifier": []map[string]interface{}{
+					{"name": "port", "type": "integer", "expression": "dstHost.port"},
+				},
+			},
+			expectedCode: http.StatusUnprocessableEntity,
+			//nolint:lll // This legal size
+			expectedBody: "[{\"pointer\":\"/unifier/0/type\",\"message\":\"unknown type: integer\"},{\"pointer\":\"/topicTo\",\"message\":\"must differ from topicFrom\"}]\n",
+		},
+		{
+			name:          "Add new rule: unknown field",
+			method:        http.MethodPost,
+			authorization: true,
+			url:           "/api/rules",
+			body: map[string]interface{}{
+				"topicFrom": "events",
+				"topic_to":  "test",
+			},
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedBody: "[{\"pointer\":\"\",\"message\":\"unknown field \\\"topic_to\\\"\"}]\n",
+		},
+		{
+			name:          "Patch rule: unknown field",
+			method:        http.MethodPatch,
+			authorization: true,
+			url:           "/api/rules/2",
+			body: map[string]interface{}{
+				"onErorr": map[string]interface{}{"policy": "skip"},
+			},
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedBody: "",
+		},
 		{
 			name:          "Add new rule: invalid body",
 			method:        http.MethodPost,
@@ -212,6 +252,291 @@ func TestRouter(t *testing.T) {
 			expectedCode:  http.StatusUnauthorized,
 			expectedBody:  "",
 		},
+		{
+			name:          "Test rule",
+			method:        http.MethodPost,
+			authorization: true,
+			url:           "/api/rules/test",
+			body: map[string]interface{}{
+				"rule": map[string]interface{}{
+					"topicFrom": "events",
+					"unifier": []map[string]interface{}{
+						{"name": "port", "type": "int", "expression": "dstHost.port"},
+					},
+				},
+				"events": []interface{}{
+					map[string]interface{}{"dstHost.port": "443"},
+					map[string]interface{}{"dstHost.port": "https"},
+				},
+			},
+			expectedCode: http.StatusOK,
+			//nolint:lll // This legal size
+			expectedBody: "[{\"matched\":true,\"output\":{\"entity\":\"d41d8cd98f00b204e9800998ecf8427e\",\"port\":443}},{\"matched\":true,\"output\":{\"entity\":\"d41d8cd98f00b204e9800998ecf8427e\"},\"errors\":[\"unifier port: cannot convert \\\"https\\\" to int\"]}]\n",
+		},
+		{
+			name:          "Test rule: invalid rule",
+			method:        http.MethodPost,
+			authorization: true,
+			url:           "/api/rules/test",
+			body: map[string]interface{}{
+				"rule": map[string]interface{}{
+					"filter": map[string]interface{}{"regexp": "["},
+				},
+			},
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedBody: "",
+		},
+		{
+			name:          "Test rule: token unauth",
+			method:        http.MethodPost,
+			authorization: false,
+			url:           "/api/rules/test",
+			expectedCode:  http.StatusUnauthorized,
+			expectedBody:  "",
+		},
+		{
+			name:          "Update rule",
+			method:        http.MethodPut,
+			authorization: true,
+			url:           "/api/rules/2",
+			body: map[string]interface{}{
+				"topicFrom": "events",
+				"topicTo":   "test",
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: "",
+		},
+		{
+			name:          "Update rule: invalid body",
+			method:        http.MethodPut,
+			authorization: true,
+			url:           "/api/rules/2",
+			body:          nil,
+			expectedCode:  http.StatusBadRequest,
+			expectedBody:  "",
+		},
+		{
+			name:          "Update rule: not owner rule",
+			method:        http.MethodPut,
+			authorization: true,
+			url:           "/api/rules/1",
+			body: map[string]interface{}{
+				"topicFrom": "events",
+			},
+			expectedCode: http.StatusForbidden,
+			expectedBody: "",
+		},
+		{
+			name:          "Update rule: rule id not exist",
+			method:        http.MethodPut,
+			authorization: true,
+			url:           "/api/rules/5",
+			body: map[string]interface{}{
+				"topicFrom": "events",
+			},
+			expectedCode: http.StatusNotFound,
+			expectedBody: "",
+		},
+		{
+			name:          "Patch rule",
+			method:        http.MethodPatch,
+			authorization: true,
+			url:           "/api/rules/2",
+			body: map[string]interface{}{
+				"topicTo": "test2",
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: "",
+		},
+		{
+			name:          "Patch rule: invalid rule",
+			method:        http.MethodPatch,
+			authorization: true,
+			url:           "/api/rules/2",
+			body: map[string]interface{}{
+				"filter": map[string]interface{}{"regexp": "["},
+			},
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedBody: "",
+		},
+		{
+			name:          "Patch rule: token unauth",
+			method:        http.MethodPatch,
+			authorization: false,
+			url:           "/api/rules/2",
+			body: map[string]interface{}{
+				"topicTo": "test2",
+			},
+			expectedCode: http.StatusUnauthorized,
+			expectedBody: "",
+		},
+		{
+			name:          "Get rule versions",
+			method:        http.MethodGet,
+			authorization: true,
+			url:           "/api/rules/2/versions",
+			expectedCode:  http.StatusOK,
+			expectedBody:  "",
+		},
+		{
+			name:          "Get rule versions: token unauth",
+			method:        http.MethodGet,
+			authorization: false,
+			url:           "/api/rules/2/versions",
+			expectedCode:  http.StatusUnauthorized,
+			expectedBody:  "",
+		},
+		{
+			name:          "Get rule versions: rule id not exist",
+			method:        http.MethodGet,
+			authorization: true,
+			url:           "/api/rules/5/versions",
+			expectedCode:  http.StatusNotFound,
+			expectedBody:  "",
+		},
+		{
+			name:          "Diff rule versions",
+			method:        http.MethodGet,
+			authorization: true,
+			url:           "/api/rules/2/diff?from=1&to=3",
+			expectedCode:  http.StatusOK,
+			expectedBody:  "",
+		},
+		{
+			name:          "Diff rule versions: invalid from",
+			method:        http.MethodGet,
+			authorization: true,
+			url:           "/api/rules/2/diff?from=sd",
+			expectedCode:  http.StatusBadRequest,
+			expectedBody:  "",
+		},
+		{
+			name:          "Diff rule versions: version not exist",
+			method:        http.MethodGet,
+			authorization: true,
+			url:           "/api/rules/2/diff?from=10",
+			expectedCode:  http.StatusNotFound,
+			expectedBody:  "",
+		},
+		{
+			name:          "Rollback rule",
+			method:        http.MethodPost,
+			authorization: true,
+			url:           "/api/rules/2/rollback/1",
+			expectedCode:  http.StatusOK,
+			expectedBody:  "",
+		},
+		{
+			name:          "Rollback rule: version not exist",
+			method:        http.MethodPost,
+			authorization: true,
+			url:           "/api/rules/2/rollback/10",
+			expectedCode:  http.StatusNotFound,
+			expectedBody:  "",
+		},
+		{
+			name:          "Rollback rule: invalid version",
+			method:        http.MethodPost,
+			authorization: true,
+			url:           "/api/rules/2/rollback/sd",
+			expectedCode:  http.StatusBadRequest,
+			expectedBody:  "",
+		},
+		{
+			name:          "Rollback rule: not owner rule",
+			method:        http.MethodPost,
+			authorization: true,
+			url:           "/api/rules/1/rollback/1",
+			expectedCode:  http.StatusForbidden,
+			expectedBody:  "",
+		},
+		{
+			name:          "Put topic schema",
+			method:        http.MethodPut,
+			authorization: true,
+			url:           "/api/topics/typed/schema",
+			body: map[string]interface{}{
+				"schema": map[string]interface{}{
+					"type":       "object",
+					"required":   []string{"port"},
+					"properties": map[string]interface{}{"port": map[string]interface{}{"type": "integer"}},
+				},
+				"mode": "warn",
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: "",
+		},
+		{
+			name:          "Put topic schema: invalid mode",
+			method:        http.MethodPut,
+			authorization: true,
+			url:           "/api/topics/typed/schema",
+			body: map[string]interface{}{
+				"schema": map[string]interface{}{"type": "object"},
+				"mode":   "sometimes",
+			},
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedBody: "[{\"pointer\":\"/mode\",\"message\":\"unknown mode: sometimes\"}]\n",
+		},
+		{
+			name:          "Put topic schema: stored rule violation",
+			method:        http.MethodPut,
+			authorization: true,
+			url:           "/api/topics/test/schema",
+			body: map[string]interface{}{
+				"schema": map[string]interface{}{"type": "object", "required": []string{"port"}},
+			},
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedBody: "",
+		},
+		{
+			name:          "Get topic schema",
+			method:        http.MethodGet,
+			authorization: true,
+			url:           "/api/topics/typed/schema",
+			expectedCode:  http.StatusOK,
+			expectedBody:  "",
+		},
+		{
+			name:          "Get topic schema: topic not exist",
+			method:        http.MethodGet,
+			authorization: true,
+			url:           "/api/topics/other/schema",
+			expectedCode:  http.StatusNotFound,
+			expectedBody:  "",
+		},
+		{
+			name:          "Update rule: topic schema violation",
+			method:        http.MethodPut,
+			authorization: true,
+			url:           "/api/rules/2",
+			body: map[string]interface{}{
+				"topicFrom": "events",
+				"topicTo":   "typed",
+				"unifier": []map[string]interface{}{
+					{"name": "port", "type": "string", "expression": "port"},
+				},
+			},
+			expectedCode: http.StatusUnprocessableEntity,
+			//nolint:lll // This legal size
+			expectedBody: "[{\"pointer\":\"/unifier/0/type\",\"message\":\"field port has type string, topic typed schema expects integer\"}]\n",
+		},
+		{
+			name:          "Get topic schemas",
+			method:        http.MethodGet,
+			authorization: true,
+			url:           "/api/topics/schemas",
+			expectedCode:  http.StatusOK,
+			expectedBody:  "",
+		},
+		{
+			name:          "Delete topic schema",
+			method:        http.MethodDelete,
+			authorization: true,
+			url:           "/api/topics/typed/schema",
+			expectedCode:  http.StatusOK,
+			expectedBody:  "",
+		},
 		{
 			name:          "Remove rule",
 			method:        http.MethodDelete,
@@ -244,6 +569,45 @@ func TestRouter(t *testing.T) {
 			expectedCode:  http.StatusNotFound,
 			expectedBody:  "",
 		},
+		{
+			name:          "Get all workers",
+			method:        http.MethodGet,
+			authorization: true,
+			url:           "/api/workers",
+			expectedCode:  http.StatusOK,
+			expectedBody:  "",
+		},
+		{
+			name:          "Get all workers: token unauth",
+			method:        http.MethodGet,
+			authorization: false,
+			url:           "/api/workers",
+			expectedCode:  http.StatusUnauthorized,
+			expectedBody:  "",
+		},
+		{
+			name:          "Get worker",
+			method:        http.MethodGet,
+			authorization: true,
+			url:           "/api/workers/1",
+			expectedCode:  http.StatusOK,
+			expectedBody:  "",
+		},
+		{
+			name:          "Get worker: worker id not exist",
+			method:        http.MethodGet,
+			authorization: true,
+			url:           "/api/workers/5",
+			expectedCode:  http.StatusNotFound,
+			expectedBody:  "",
+		},
+		{
+			name:         "Get metrics",
+			method:       http.MethodGet,
+			url:          "/metrics",
+			expectedCode: http.StatusOK,
+			expectedBody: "",
+		},
 		{
 			name:          "Remove rule: not owner rule",
 			method:        http.MethodDelete,
@@ -273,7 +637,12 @@ func TestRouter(t *testing.T) {
 	}
 
 	// Запускаем пул воркеров
-	p, err := worker.StartPool(cfg.KafkaAdress, str, lg)
+	backoff := worker.DefaultBackoff
+	backoff.MaxRestarts = cfg.WorkerMaxRestarts
+
+	commit := worker.Commit{Interval: cfg.CommitInterval, Batch: cfg.CommitBatch}
+
+	p, err := worker.StartPool(cfg.KafkaAdress, str, lg, backoff, commit)
 	if err != nil {
 		assert.NoError(t, err)
 	}
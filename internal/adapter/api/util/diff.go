@@ -0,0 +1,114 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Операции изменения документа.
+const (
+	DiffAdd     = "add"
+	DiffRemove  = "remove"
+	DiffReplace = "replace"
+)
+
+// Change - отличие между двумя JSON документами. Path - JSON Pointer (RFC 6901).
+type Change struct {
+	Op   string      `json:"op"`
+	Path string      `json:"path"`
+	From interface{} `json:"from,omitempty"`
+	To   interface{} `json:"to,omitempty"`
+}
+
+// Diff сравнивает два JSON документа. Объекты сравниваются по ключам,
+// массивы - поэлементно по индексам.
+func Diff(a, b []byte) ([]Change, error) {
+	var da, db interface{}
+
+	if err := json.Unmarshal(a, &da); err != nil {
+		return nil, fmt.Errorf("invalid source document: %w", err)
+	}
+
+	if err := json.Unmarshal(b, &db); err != nil {
+		return nil, fmt.Errorf("invalid target document: %w", err)
+	}
+
+	return diffValue("", da, db, nil), nil
+}
+
+func diffValue(path string, a, b interface{}, res []Change) []Change {
+	switch av := a.(type) {
+	case map[string]interface{}:
+		if bv, ok := b.(map[string]interface{}); ok {
+			return diffObject(path, av, bv, res)
+		}
+	case []interface{}:
+		if bv, ok := b.([]interface{}); ok {
+			return diffArray(path, av, bv, res)
+		}
+	}
+
+	// Скаляры, а также значения разных типов заменяются целиком
+	aj, _ := json.Marshal(a)
+	bj, _ := json.Marshal(b)
+	if string(aj) != string(bj) {
+		res = append(res, Change{Op: DiffReplace, Path: path, From: a, To: b})
+	}
+
+	return res
+}
+
+func diffObject(path string, a, b map[string]interface{}, res []Change) []Change {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		p := path + "/" + escapePointer(k)
+
+		av, aok := a[k]
+		bv, bok := b[k]
+
+		switch {
+		case !aok:
+			res = append(res, Change{Op: DiffAdd, Path: p, To: bv})
+		case !bok:
+			res = append(res, Change{Op: DiffRemove, Path: p, From: av})
+		default:
+			res = diffValue(p, av, bv, res)
+		}
+	}
+
+	return res
+}
+
+func diffArray(path string, a, b []interface{}, res []Change) []Change {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		p := path + "/" + strconv.Itoa(i)
+
+		switch {
+		case i >= len(a):
+			res = append(res, Change{Op: DiffAdd, Path: p, To: b[i]})
+		case i >= len(b):
+			res = append(res, Change{Op: DiffRemove, Path: p, From: a[i]})
+		default:
+			res = diffValue(p, a[i], b[i], res)
+		}
+	}
+
+	return res
+}
+
+func escapePointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
@@ -0,0 +1,49 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// MergePatch применяет JSON Merge Patch (RFC 7386) к документу.
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	var d, p interface{}
+
+	if err := json.Unmarshal(doc, &d); err != nil {
+		return nil, fmt.Errorf("invalid document: %w", err)
+	}
+
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, fmt.Errorf("invalid patch: %w", err)
+	}
+
+	res, err := json.Marshal(mergeValue(d, p))
+	if err != nil {
+		return nil, fmt.Errorf("failed marshal merged document: %w", err)
+	}
+
+	return res, nil
+}
+
+func mergeValue(target, patch interface{}) interface{} {
+	pm, ok := patch.(map[string]interface{})
+	if !ok {
+		// Не объект заменяет значение целиком
+		return patch
+	}
+
+	tm, ok := target.(map[string]interface{})
+	if !ok {
+		tm = make(map[string]interface{})
+	}
+
+	for k, v := range pm {
+		if v == nil {
+			delete(tm, k)
+			continue
+		}
+		tm[k] = mergeValue(tm[k], v)
+	}
+
+	return tm
+}
@@ -45,3 +45,87 @@ func TestGetTokenFromContext(t *testing.T) {
 	assert.True(t, ok)
 	assert.Equal(t, testToken, tokenFromContext)
 }
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		patch   string
+		want    string
+		wantErr bool
+	}{
+		{name: "Replace field", doc: `{"a":"b"}`, patch: `{"a":"c"}`, want: `{"a":"c"}`},
+		{name: "Add field", doc: `{"a":"b"}`, patch: `{"b":"c"}`, want: `{"a":"b","b":"c"}`},
+		{name: "Remove field", doc: `{"a":"b","b":"c"}`, patch: `{"a":null}`, want: `{"b":"c"}`},
+		{name: "Replace array", doc: `{"a":[1,2]}`, patch: `{"a":[3]}`, want: `{"a":[3]}`},
+		{name: "Nested merge", doc: `{"a":{"b":"c","d":"e"}}`, patch: `{"a":{"b":null,"f":"g"}}`, want: `{"a":{"d":"e","f":"g"}}`},
+		{name: "Object into scalar", doc: `{"a":"b"}`, patch: `{"a":{"c":"d"}}`, want: `{"a":{"c":"d"}}`},
+		{name: "Invalid patch", doc: `{}`, patch: `{`, wantErr: true},
+		{name: "Invalid document", doc: `{`, patch: `{}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MergePatch([]byte(tt.doc), []byte(tt.patch))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("MergePatch() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr {
+				assert.JSONEq(t, tt.want, string(got))
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name    string
+		a       string
+		b       string
+		want    []Change
+		wantErr bool
+	}{
+		{name: "Equal", a: `{"a":[1,{"b":2}]}`, b: `{"a":[1,{"b":2}]}`, want: nil},
+		{
+			name: "Object changes",
+			a:    `{"a":"b","c":"d","e":{"f":1}}`,
+			b:    `{"a":"x","e":{"f":1,"g/h":2},"i":true}`,
+			want: []Change{
+				{Op: DiffReplace, Path: "/a", From: "b", To: "x"},
+				{Op: DiffRemove, Path: "/c", From: "d"},
+				{Op: DiffAdd, Path: "/e/g~1h", To: float64(2)},
+				{Op: DiffAdd, Path: "/i", To: true},
+			},
+		},
+		{
+			name: "Array changes",
+			a:    `{"a":[1,2,3]}`,
+			b:    `{"a":[1,5]}`,
+			want: []Change{
+				{Op: DiffReplace, Path: "/a/1", From: float64(2), To: float64(5)},
+				{Op: DiffRemove, Path: "/a/2", From: float64(3)},
+			},
+		},
+		{
+			name: "Type change",
+			a:    `{"a":{"b":1}}`,
+			b:    `{"a":[1]}`,
+			want: []Change{
+				{Op: DiffReplace, Path: "/a", From: map[string]interface{}{"b": float64(1)}, To: []interface{}{float64(1)}},
+			},
+		},
+		{name: "Invalid document", a: `{`, b: `{}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Diff([]byte(tt.a), []byte(tt.b))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Diff() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
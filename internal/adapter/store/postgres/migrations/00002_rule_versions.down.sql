@@ -0,0 +1,6 @@
+BEGIN TRANSACTION;
+
+DROP TABLE rule_versions;
+ALTER TABLE rules DROP COLUMN Version;
+
+COMMIT;
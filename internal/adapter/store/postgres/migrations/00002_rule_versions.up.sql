@@ -0,0 +1,25 @@
+BEGIN TRANSACTION;
+
+ALTER TABLE rules ADD COLUMN IF NOT EXISTS Version INT NOT NULL DEFAULT 1;
+
+CREATE TABLE IF NOT EXISTS rule_versions(
+	RuleID      INT NOT NULL,
+	Version     INT NOT NULL,
+	Action      VARCHAR(16) NOT NULL,
+	Rule        JSON NULL,
+	Author      INT NULL,
+	AuthorLogin VARCHAR(255) NULL,
+	CreatedAt   TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (RuleID, Version),
+	CONSTRAINT fk_users
+		FOREIGN KEY(Author)
+			REFERENCES users(ID)
+			ON DELETE SET NULL
+);
+
+-- История существующих правил начинается с их текущего состояния
+INSERT INTO rule_versions
+(RuleID, Version, Action, Rule, Author)
+SELECT ID, Version, 'create', Rule, Owner FROM rules;
+
+COMMIT;
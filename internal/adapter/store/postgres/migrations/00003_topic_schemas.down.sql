@@ -0,0 +1,5 @@
+BEGIN TRANSACTION;
+
+DROP TABLE topic_schemas;
+
+COMMIT;
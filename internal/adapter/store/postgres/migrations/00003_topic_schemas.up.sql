@@ -0,0 +1,10 @@
+BEGIN TRANSACTION;
+
+CREATE TABLE IF NOT EXISTS topic_schemas(
+	Topic     VARCHAR(255) PRIMARY KEY NOT NULL,
+	Schema    JSON NOT NULL,
+	Mode      VARCHAR(16) NOT NULL,
+	UpdatedAt TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+COMMIT;
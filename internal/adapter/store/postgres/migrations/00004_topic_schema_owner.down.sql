@@ -0,0 +1,5 @@
+BEGIN TRANSACTION;
+
+ALTER TABLE topic_schemas DROP COLUMN Owner;
+
+COMMIT;
@@ -0,0 +1,9 @@
+BEGIN TRANSACTION;
+
+ALTER TABLE topic_schemas ADD COLUMN IF NOT EXISTS Owner INT NULL;
+ALTER TABLE topic_schemas ADD CONSTRAINT fk_users
+	FOREIGN KEY(Owner)
+		REFERENCES users(ID)
+		ON DELETE SET NULL;
+
+COMMIT;
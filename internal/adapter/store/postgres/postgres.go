@@ -10,6 +10,7 @@ import (
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/source/iofs"
 	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"go.uber.org/zap"
@@ -92,7 +93,7 @@ func (db DataBase) CreateUser(ctx context.Context, user models.User) (int, error
 }
 
 func (db DataBase) GetAllRules(ctx context.Context) ([]models.Rule, error) {
-	rows, err := db.pool.Query(ctx, `SELECT ID, Rule, Owner FROM Rules`)
+	rows, err := db.pool.Query(ctx, `SELECT ID, Rule, Owner, Version FROM Rules`)
 	if err != nil {
 		return nil, fmt.Errorf("failed rules query records: %w", err)
 	}
@@ -101,7 +102,7 @@ func (db DataBase) GetAllRules(ctx context.Context) ([]models.Rule, error) {
 	var rules []models.Rule
 	for rows.Next() {
 		var rule models.Rule
-		if err = rows.Scan(&rule.ID, &rule.Rule, &rule.Owner); err != nil {
+		if err = rows.Scan(&rule.ID, &rule.Rule, &rule.Owner, &rule.Version); err != nil {
 			return nil, fmt.Errorf("failed scan rules records: %w", err)
 		}
 		rules = append(rules, rule)
@@ -113,12 +114,12 @@ func (db DataBase) GetAllRules(ctx context.Context) ([]models.Rule, error) {
 //nolint:dupl // This legal code
 func (db DataBase) GetRuleByID(ctx context.Context, id int) (models.Rule, error) {
 	row := db.pool.QueryRow(ctx,
-		`SELECT ID, Rule, Owner FROM Rules WHERE id=$1`,
+		`SELECT ID, Rule, Owner, Version FROM Rules WHERE id=$1`,
 		id,
 	)
 
 	r := models.Rule{}
-	err := row.Scan(&r.ID, &r.Rule, &r.Owner)
+	err := row.Scan(&r.ID, &r.Rule, &r.Owner, &r.Version)
 	if err != nil {
 		var pgErr *pgconn.PgError
 		// Если данные не найдены возвращаем пустую структуру
@@ -132,29 +133,248 @@ func (db DataBase) GetRuleByID(ctx context.Context, id int) (models.Rule, error)
 	return r, nil
 }
 
-func (db DataBase) CreateRule(ctx context.Context, rule models.Config, owner int) (int, error) {
-	row := db.pool.QueryRow(context.Background(),
-		`INSERT INTO rules (Rule, Owner) VALUES($1, $2) RETURNING id`,
-		rule,
-		owner,
-	)
-
+func (db DataBase) CreateRule(ctx context.Context, rule models.Config, author models.Author) (int, error) {
 	var id int
-	err := row.Scan(&id)
+
+	err := db.inTx(ctx, func(tx pgx.Tx) error {
+		row := tx.QueryRow(ctx,
+			`INSERT INTO rules (Rule, Owner) VALUES($1, $2) RETURNING id, Version`,
+			rule,
+			author.ID,
+		)
+
+		var version int
+		if err := row.Scan(&id, &version); err != nil {
+			return fmt.Errorf("failed scan rule record row: %w", err)
+		}
+
+		return addVersion(ctx, tx, id, version, models.ActionCreate, &rule, author)
+	})
 	if err != nil {
-		return 0, fmt.Errorf("failed scan rule record row: %w", err)
+		return 0, err
 	}
 
 	return id, nil
 }
 
-func (db DataBase) DeleteRule(ctx context.Context, id int) error {
-	_, err := db.pool.Exec(context.Background(),
-		`DELETE FROM rules WHERE id = $1`,
+func (db DataBase) UpdateRule(ctx context.Context, id int, rule models.Config, author models.Author) (int, error) {
+	return db.updateRule(ctx, id, rule, author, models.ActionUpdate)
+}
+
+func (db DataBase) RollbackRule(ctx context.Context, id int, rule models.Config, author models.Author) (int, error) {
+	return db.updateRule(ctx, id, rule, author, models.ActionRollback)
+}
+
+// updateRule сохраняет новую конфигурацию правила и возвращает номер версии.
+func (db DataBase) updateRule(ctx context.Context, id int, rule models.Config,
+	author models.Author, action string) (int, error) {
+	var version int
+
+	err := db.inTx(ctx, func(tx pgx.Tx) error {
+		// Блокировка строки упорядочивает конкурентные изменения правила
+		row := tx.QueryRow(ctx,
+			`UPDATE rules SET Rule = $1, Version = Version + 1 WHERE id = $2 RETURNING Version`,
+			rule,
+			id,
+		)
+
+		if err := row.Scan(&version); err != nil {
+			return fmt.Errorf("failed update record in rules: %w", err)
+		}
+
+		return addVersion(ctx, tx, id, version, action, &rule, author)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+func (db DataBase) DeleteRule(ctx context.Context, id int, author models.Author) error {
+	return db.inTx(ctx, func(tx pgx.Tx) error {
+		row := tx.QueryRow(ctx,
+			`DELETE FROM rules WHERE id = $1 RETURNING Version`,
+			id,
+		)
+
+		var version int
+		if err := row.Scan(&version); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil
+			}
+			return fmt.Errorf("failed delete record in rules: %w", err)
+		}
+
+		return addVersion(ctx, tx, id, version+1, models.ActionDelete, nil, author)
+	})
+}
+
+func (db DataBase) GetRuleVersions(ctx context.Context, id int) ([]models.RuleVersion, error) {
+	rows, err := db.pool.Query(ctx,
+		`SELECT RuleID, Version, Action, Rule, Author, AuthorLogin, CreatedAt
+		FROM rule_versions WHERE RuleID = $1 ORDER BY Version`,
+		id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed rule versions query records: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []models.RuleVersion
+	for rows.Next() {
+		v, err := scanVersion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed scan rule versions records: %w", err)
+		}
+		versions = append(versions, v)
+	}
+
+	return versions, nil
+}
+
+func (db DataBase) GetRuleVersion(ctx context.Context, id, version int) (models.RuleVersion, error) {
+	row := db.pool.QueryRow(ctx,
+		`SELECT RuleID, Version, Action, Rule, Author, AuthorLogin, CreatedAt
+		FROM rule_versions WHERE RuleID = $1 AND Version = $2`,
+		id,
+		version,
+	)
+
+	v, err := scanVersion(row)
+	if err != nil {
+		// Если данные не найдены возвращаем пустую структуру
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.RuleVersion{}, nil
+		}
+
+		return v, fmt.Errorf("failed scan row: %w", err)
+	}
+
+	return v, nil
+}
+
+func (db DataBase) GetTopicSchemas(ctx context.Context) ([]models.TopicSchema, error) {
+	rows, err := db.pool.Query(ctx, `SELECT Topic, Schema, Mode, Owner, UpdatedAt FROM topic_schemas ORDER BY Topic`)
+	if err != nil {
+		return nil, fmt.Errorf("failed topic schemas query records: %w", err)
+	}
+	defer rows.Close()
+
+	var schemas []models.TopicSchema
+	for rows.Next() {
+		var ts models.TopicSchema
+		if err = rows.Scan(&ts.Topic, &ts.Schema, &ts.Mode, &ts.Owner, &ts.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed scan topic schemas records: %w", err)
+		}
+		schemas = append(schemas, ts)
+	}
+
+	return schemas, nil
+}
+
+func (db DataBase) GetTopicSchema(ctx context.Context, topic string) (models.TopicSchema, error) {
+	row := db.pool.QueryRow(ctx,
+		`SELECT Topic, Schema, Mode, Owner, UpdatedAt FROM topic_schemas WHERE Topic = $1`,
+		topic,
+	)
+
+	var ts models.TopicSchema
+	if err := row.Scan(&ts.Topic, &ts.Schema, &ts.Mode, &ts.Owner, &ts.UpdatedAt); err != nil {
+		// Если данные не найдены возвращаем пустую структуру
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.TopicSchema{}, nil
+		}
+
+		return ts, fmt.Errorf("failed scan row: %w", err)
+	}
+
+	return ts, nil
+}
+
+// SaveTopicSchema создает или заменяет схему топика. Владелец задается
+// при создании и при замене не меняется.
+func (db DataBase) SaveTopicSchema(ctx context.Context, schema models.TopicSchema) (models.TopicSchema, error) {
+	row := db.pool.QueryRow(ctx,
+		`INSERT INTO topic_schemas (Topic, Schema, Mode, Owner) VALUES($1, $2, $3, $4)
+		ON CONFLICT (Topic) DO UPDATE SET Schema = EXCLUDED.Schema, Mode = EXCLUDED.Mode, UpdatedAt = now()
+		RETURNING Owner, UpdatedAt`,
+		schema.Topic,
+		string(schema.Schema),
+		schema.Mode,
+		schema.Owner,
+	)
+
+	if err := row.Scan(&schema.Owner, &schema.UpdatedAt); err != nil {
+		return schema, fmt.Errorf("failed save record in topic_schemas: %w", err)
+	}
+
+	return schema, nil
+}
+
+func (db DataBase) DeleteTopicSchema(ctx context.Context, topic string) error {
+	_, err := db.pool.Exec(ctx, `DELETE FROM topic_schemas WHERE Topic = $1`, topic)
+	if err != nil {
+		return fmt.Errorf("failed delete record in topic_schemas: %w", err)
+	}
+
+	return nil
+}
+
+func scanVersion(row pgx.Row) (models.RuleVersion, error) {
+	var (
+		v           models.RuleVersion
+		authorID    *int
+		authorLogin *string
+	)
+
+	if err := row.Scan(&v.RuleID, &v.Version, &v.Action, &v.Rule, &authorID, &authorLogin, &v.CreatedAt); err != nil {
+		return v, fmt.Errorf("failed scan rule version: %w", err)
+	}
+
+	if authorID != nil {
+		v.Author = &models.Author{ID: *authorID}
+		if authorLogin != nil {
+			v.Author.Login = *authorLogin
+		}
+	}
+
+	return v, nil
+}
+
+func addVersion(ctx context.Context, tx pgx.Tx, id, version int, action string,
+	rule *models.Config, author models.Author) error {
+	_, err := tx.Exec(ctx,
+		`INSERT INTO rule_versions (RuleID, Version, Action, Rule, Author, AuthorLogin)
+		VALUES($1, $2, $3, $4, $5, $6)`,
 		id,
+		version,
+		action,
+		rule,
+		author.ID,
+		author.Login,
 	)
 	if err != nil {
-		return fmt.Errorf("failed delete record in rules: %w", err)
+		return fmt.Errorf("failed insert record in rule_versions: %w", err)
+	}
+
+	return nil
+}
+
+func (db DataBase) inTx(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed begin transaction: %w", err)
+	}
+	//nolint:errcheck // После Commit откат ничего не делает
+	defer tx.Rollback(ctx)
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed commit transaction: %w", err)
 	}
 
 	return nil
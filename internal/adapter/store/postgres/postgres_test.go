@@ -3,6 +3,7 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
@@ -165,7 +166,7 @@ func TestCreateRule(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Вызываем функцию, которую тестируем
-	ruleID, err := db.CreateRule(ctx, testRule, ownerID)
+	ruleID, err := db.CreateRule(ctx, testRule, models.Author{ID: ownerID})
 	assert.NoError(t, err)
 	assert.NotEqual(t, 0, ruleID)
 }
@@ -183,7 +184,7 @@ func TestGetRuleByID(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Создаем правило
-	ruleID, err := db.CreateRule(ctx, testRule, ownerID)
+	ruleID, err := db.CreateRule(ctx, testRule, models.Author{ID: ownerID})
 	assert.NoError(t, err)
 
 	// Вызываем функцию, которую тестируем
@@ -207,11 +208,11 @@ func TestDeleteRule(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Создаем правило
-	ruleID, err := db.CreateRule(ctx, testRule, ownerID)
+	ruleID, err := db.CreateRule(ctx, testRule, models.Author{ID: ownerID})
 	assert.NoError(t, err)
 
 	// Вызываем функцию, которую тестируем
-	err = db.DeleteRule(ctx, ruleID)
+	err = db.DeleteRule(ctx, ruleID, models.Author{ID: ownerID})
 	assert.NoError(t, err)
 
 	// Пытаемся получить правило после удаления
@@ -220,6 +221,90 @@ func TestDeleteRule(t *testing.T) {
 	assert.Equal(t, r, models.Rule{})
 }
 
+func TestUpdateRule(t *testing.T) {
+	ctx := context.Background()
+
+	// Создаем тестовое правило
+	testRule := models.Config{
+		TopicFrom: "events",
+	}
+
+	// Создаем пользователя, который будет владельцем правила
+	ownerID, err := db.CreateUser(ctx, models.User{Login: "testowner4", Hash: "hash123"})
+	assert.NoError(t, err)
+
+	// Создаем правило
+	ruleID, err := db.CreateRule(ctx, testRule, models.Author{ID: ownerID})
+	assert.NoError(t, err)
+
+	// Вызываем функцию, которую тестируем
+	testRule.TopicTo = "unified"
+	version, err := db.UpdateRule(ctx, ruleID, testRule, models.Author{ID: ownerID})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, version)
+
+	// Правило обновлено, владелец не изменился
+	r, err := db.GetRuleByID(ctx, ruleID)
+	assert.NoError(t, err)
+	assert.Equal(t, testRule, r.Rule)
+	assert.Equal(t, ownerID, *r.Owner)
+	assert.Equal(t, 2, r.Version)
+}
+
+func TestRuleVersions(t *testing.T) {
+	ctx := context.Background()
+
+	// Создаем тестовое правило
+	testRule := models.Config{
+		TopicFrom: "events",
+	}
+
+	// Создаем пользователя, который будет автором изменений
+	ownerID, err := db.CreateUser(ctx, models.User{Login: "testowner5", Hash: "hash123"})
+	assert.NoError(t, err)
+	author := models.Author{ID: ownerID, Login: "testowner5"}
+
+	// Создаем, изменяем, откатываем и удаляем правило
+	ruleID, err := db.CreateRule(ctx, testRule, author)
+	assert.NoError(t, err)
+
+	updated := testRule
+	updated.TopicTo = "unified"
+	_, err = db.UpdateRule(ctx, ruleID, updated, author)
+	assert.NoError(t, err)
+
+	version, err := db.RollbackRule(ctx, ruleID, testRule, author)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, version)
+
+	err = db.DeleteRule(ctx, ruleID, author)
+	assert.NoError(t, err)
+
+	// Вызываем функцию, которую тестируем
+	versions, err := db.GetRuleVersions(ctx, ruleID)
+	assert.NoError(t, err)
+	assert.Len(t, versions, 4)
+
+	actions := make([]string, 0, len(versions))
+	for _, v := range versions {
+		actions = append(actions, v.Action)
+		assert.Equal(t, &author, v.Author)
+	}
+	assert.Equal(t, []string{
+		models.ActionCreate, models.ActionUpdate, models.ActionRollback, models.ActionDelete,
+	}, actions)
+	assert.Nil(t, versions[3].Rule)
+
+	v, err := db.GetRuleVersion(ctx, ruleID, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, &updated, v.Rule)
+
+	// Несуществующая версия возвращает пустую структуру
+	v, err = db.GetRuleVersion(ctx, ruleID, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, models.RuleVersion{}, v)
+}
+
 func TestGetAllRules(t *testing.T) {
 	ctx := context.Background()
 
@@ -228,3 +313,46 @@ func TestGetAllRules(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotEmpty(t, rules)
 }
+
+func TestTopicSchemas(t *testing.T) {
+	ctx := context.Background()
+
+	ownerID, err := db.CreateUser(ctx, models.User{Login: "schemaowner", Hash: "hash123"})
+	assert.NoError(t, err)
+
+	ts := models.TopicSchema{
+		Topic:  "unified",
+		Schema: json.RawMessage(`{"type":"object"}`),
+		Mode:   "enforce",
+		Owner:  &ownerID,
+	}
+
+	// Создаем и заменяем схему, владелец при замене не меняется
+	saved, err := db.SaveTopicSchema(ctx, ts)
+	assert.NoError(t, err)
+	assert.False(t, saved.UpdatedAt.IsZero())
+
+	ts.Mode = "warn"
+	ts.Owner = nil
+	saved, err = db.SaveTopicSchema(ctx, ts)
+	assert.NoError(t, err)
+	assert.Equal(t, &ownerID, saved.Owner)
+
+	// Вызываем функцию, которую тестируем
+	got, err := db.GetTopicSchema(ctx, "unified")
+	assert.NoError(t, err)
+	assert.Equal(t, "warn", got.Mode)
+	assert.Equal(t, &ownerID, got.Owner)
+	assert.JSONEq(t, `{"type":"object"}`, string(got.Schema))
+
+	schemas, err := db.GetTopicSchemas(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, schemas, 1)
+
+	// Удаленная схема возвращает пустую структуру
+	assert.NoError(t, db.DeleteTopicSchema(ctx, "unified"))
+
+	got, err = db.GetTopicSchema(ctx, "unified")
+	assert.NoError(t, err)
+	assert.Equal(t, models.TopicSchema{}, got)
+}
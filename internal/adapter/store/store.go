@@ -16,8 +16,16 @@ type Storage interface {
 	CreateUser(ctx context.Context, user models.User) (int, error)
 	GetRuleByID(ctx context.Context, id int) (models.Rule, error)
 	GetAllRules(ctx context.Context) ([]models.Rule, error)
-	CreateRule(ctx context.Context, rule models.Config, owner int) (int, error)
-	DeleteRule(ctx context.Context, id int) error
+	CreateRule(ctx context.Context, rule models.Config, author models.Author) (int, error)
+	UpdateRule(ctx context.Context, id int, rule models.Config, author models.Author) (int, error)
+	RollbackRule(ctx context.Context, id int, rule models.Config, author models.Author) (int, error)
+	DeleteRule(ctx context.Context, id int, author models.Author) error
+	GetRuleVersions(ctx context.Context, id int) ([]models.RuleVersion, error)
+	GetRuleVersion(ctx context.Context, id, version int) (models.RuleVersion, error)
+	GetTopicSchemas(ctx context.Context) ([]models.TopicSchema, error)
+	GetTopicSchema(ctx context.Context, topic string) (models.TopicSchema, error)
+	SaveTopicSchema(ctx context.Context, schema models.TopicSchema) (models.TopicSchema, error)
+	DeleteTopicSchema(ctx context.Context, topic string) error
 }
 
 func NewStore(dsn string, lg *zap.Logger) (Storage, error) {
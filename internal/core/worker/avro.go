@@ -0,0 +1,371 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hamba/avro/v2"
+)
+
+// compileAvroSchema разбирает схему Avro и возвращает функцию кодирования
+// событий. Разбор схемы и двоичное кодирование выполняет hamba/avro, здесь
+// значения события приводятся к типам Go, которые ожидает библиотека.
+func compileAvroSchema(s string) (encoder, error) {
+	// Именованные типы правила не должны пересекаться с типами других правил
+	schema, err := avro.ParseWithCache(s, "", &avro.SchemaCache{})
+	if err != nil {
+		return nil, err
+	}
+
+	rec, ok := schema.(*avro.RecordSchema)
+	if !ok {
+		return nil, fmt.Errorf("top level type must be record, got %v", schema.Type())
+	}
+
+	return func(event map[string]interface{}) ([]byte, error) {
+		v, err := avroValue(rec, event)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errSchemaMismatch, err)
+		}
+
+		buf, err := avro.Marshal(rec, v)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errSchemaMismatch, err)
+		}
+
+		return buf, nil
+	}, nil
+}
+
+// avroValue приводит значение события к типу схемы. Числа приводятся к типам
+// нужной разрядности, строки RFC 3339 - ко времени для логических типов даты
+// и времени, значения объединений оборачиваются именем выбранной ветки.
+func avroValue(s avro.Schema, v interface{}) (interface{}, error) {
+	switch s := s.(type) {
+	case *avro.RefSchema:
+		return avroValue(s.Schema(), v)
+	case *avro.NullSchema:
+		if v != nil {
+			return nil, errConvert(v, "null")
+		}
+		return nil, nil
+	case *avro.PrimitiveSchema:
+		return avroPrimitive(s, v)
+	case *avro.FixedSchema:
+		// Десятичное число задается числом или строкой, размер проверяет кодировщик
+		if s.Logical() != nil && s.Logical().Type() == avro.Decimal {
+			return avroDecimal(v)
+		}
+		b, ok := avroBytes(v)
+		if !ok || len(b) != s.Size() {
+			return nil, errConvert(v, fmt.Sprintf("fixed(%d)", s.Size()))
+		}
+		arr := reflect.New(reflect.ArrayOf(s.Size(), reflect.TypeOf(byte(0)))).Elem()
+		reflect.Copy(arr, reflect.ValueOf(b))
+		return arr.Interface(), nil
+	case *avro.EnumSchema:
+		str, ok := v.(string)
+		if !ok {
+			return nil, errConvert(v, "enum")
+		}
+		for _, sym := range s.Symbols() {
+			if sym == str {
+				return str, nil
+			}
+		}
+		return nil, errConvert(v, "enum")
+	case *avro.ArraySchema:
+		return avroArray(s, v)
+	case *avro.MapSchema:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, errConvert(v, "map")
+		}
+		res := make(map[string]interface{}, len(m))
+		for _, k := range sortedKeys(m) {
+			ev, err := avroValue(s.Values(), m[k])
+			if err != nil {
+				return nil, fmt.Errorf("%v: %w", k, err)
+			}
+			res[k] = ev
+		}
+		return res, nil
+	case *avro.RecordSchema:
+		return avroRecord(s, v)
+	case *avro.UnionSchema:
+		return avroUnion(s, v)
+	}
+
+	return nil, fmt.Errorf("unsupported type: %v", s.Type())
+}
+
+func avroPrimitive(s *avro.PrimitiveSchema, v interface{}) (interface{}, error) {
+	var logical avro.LogicalType
+	if s.Logical() != nil {
+		logical = s.Logical().Type()
+	}
+
+	switch s.Type() {
+	case avro.Boolean:
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+	case avro.Int:
+		switch logical {
+		case avro.Date:
+			if t, ok := avroTime(v); ok {
+				return t, nil
+			}
+		case avro.TimeMillis:
+			if n, ok := avroLong(v); ok && n <= math.MaxInt32 && n >= math.MinInt32 {
+				return time.Duration(n) * time.Millisecond, nil
+			}
+		}
+		if n, ok := avroLong(v); ok && n <= math.MaxInt32 && n >= math.MinInt32 {
+			return int(n), nil
+		}
+	case avro.Long:
+		switch logical {
+		case avro.TimestampMillis, avro.TimestampMicros, avro.LocalTimestampMillis, avro.LocalTimestampMicros:
+			if t, ok := avroTime(v); ok {
+				return t, nil
+			}
+		case avro.TimeMicros:
+			if n, ok := avroLong(v); ok {
+				return time.Duration(n) * time.Microsecond, nil
+			}
+		}
+		if n, ok := avroLong(v); ok {
+			return n, nil
+		}
+	case avro.Float:
+		if f, ok := avroFloat(v); ok {
+			return float32(f), nil
+		}
+	case avro.Double:
+		if f, ok := avroFloat(v); ok {
+			return f, nil
+		}
+	case avro.String:
+		if str, ok := v.(string); ok {
+			return str, nil
+		}
+	case avro.Bytes:
+		if logical == avro.Decimal {
+			return avroDecimal(v)
+		}
+		if b, ok := avroBytes(v); ok {
+			return b, nil
+		}
+	}
+
+	return nil, errConvert(v, string(s.Type()))
+}
+
+func avroArray(s *avro.ArraySchema, v interface{}) (interface{}, error) {
+	var items []interface{}
+	switch a := v.(type) {
+	case []interface{}:
+		items = a
+	case []string:
+		for _, e := range a {
+			items = append(items, e)
+		}
+	default:
+		return nil, errConvert(v, "array")
+	}
+
+	res := make([]interface{}, len(items))
+	for i, e := range items {
+		ev, err := avroValue(s.Items(), e)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", i, err)
+		}
+		res[i] = ev
+	}
+
+	return res, nil
+}
+
+// avroRecord проверяет, что событие не содержит полей вне схемы. Отсутствующие
+// поля заполняются значениями по умолчанию из схемы.
+func avroRecord(s *avro.RecordSchema, v interface{}) (interface{}, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errConvert(v, "record")
+	}
+
+	res := make(map[string]interface{}, len(m))
+	known := make(map[string]bool, len(s.Fields()))
+	for _, f := range s.Fields() {
+		known[f.Name()] = true
+
+		fv, found := m[f.Name()]
+		switch {
+		case found:
+			ev, err := avroValue(f.Type(), fv)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %w", f.Name(), err)
+			}
+			res[f.Name()] = ev
+		case f.HasDefault():
+		default:
+			// Поле без значения по умолчанию допустимо, если схема разрешает null
+			if _, err := avroValue(f.Type(), nil); err != nil {
+				return nil, fmt.Errorf("%v: missing field", f.Name())
+			}
+			res[f.Name()] = nil
+		}
+	}
+
+	for _, k := range sortedKeys(m) {
+		if !known[k] {
+			return nil, fmt.Errorf("%v: unknown field", k)
+		}
+	}
+
+	return res, nil
+}
+
+// avroUnion выбирает первую подходящую ветку объединения.
+func avroUnion(s *avro.UnionSchema, v interface{}) (interface{}, error) {
+	if v == nil {
+		if s.Nullable() {
+			return nil, nil
+		}
+		return nil, errConvert(v, "union")
+	}
+
+	for _, b := range s.Types() {
+		if b.Type() == avro.Null {
+			continue
+		}
+		if ev, err := avroValue(b, v); err == nil {
+			return map[string]interface{}{avroUnionName(b): ev}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%T does not match any union branch", v)
+}
+
+// avroUnionName возвращает имя ветки объединения в формате hamba/avro.
+func avroUnionName(s avro.Schema) string {
+	if ref, ok := s.(*avro.RefSchema); ok {
+		s = ref.Schema()
+	}
+	if named, ok := s.(avro.NamedSchema); ok {
+		return named.FullName()
+	}
+	if ls, ok := s.(avro.LogicalTypeSchema); ok && ls.Logical() != nil {
+		return string(s.Type()) + "." + string(ls.Logical().Type())
+	}
+
+	return string(s.Type())
+}
+
+// avroLong приводит целые числа.
+func avroLong(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int64:
+		return n, true
+	case json.Number:
+		i, err := n.Int64()
+		if err != nil {
+			return 0, false
+		}
+		return i, true
+	case float64:
+		if n != math.Trunc(n) || n >= 1<<63 || n < -1<<63 {
+			return 0, false
+		}
+		return int64(n), true
+	}
+
+	return 0, false
+}
+
+func avroFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+
+	return 0, false
+}
+
+// avroTime приводит время и строки RFC 3339 или даты.
+func avroTime(v interface{}) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case string:
+		if tt, err := time.Parse(time.RFC3339Nano, t); err == nil {
+			return tt, true
+		}
+		if tt, err := time.Parse(time.DateOnly, t); err == nil {
+			return tt, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+func avroBytes(v interface{}) ([]byte, bool) {
+	switch b := v.(type) {
+	case string:
+		return []byte(b), true
+	case []byte:
+		return b, true
+	}
+
+	return nil, false
+}
+
+// avroDecimal приводит числа и строки с числом к big.Rat.
+func avroDecimal(v interface{}) (interface{}, error) {
+	var s string
+	switch n := v.(type) {
+	case json.Number:
+		s = n.String()
+	case string:
+		s = n
+	case int:
+		s = strconv.Itoa(n)
+	case float64:
+		s = strconv.FormatFloat(n, 'f', -1, 64)
+	default:
+		return nil, errConvert(v, "decimal")
+	}
+
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, errConvert(v, "decimal")
+	}
+
+	return r, nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,214 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Поля заголовка CEF по порядку.
+var cefHeader = []string{
+	"cefVersion", "deviceVendor", "deviceProduct", "deviceVersion",
+	"deviceEventClassId", "name", "severity",
+}
+
+// Поля заголовка LEEF по порядку.
+var leefHeader = []string{"leefVersion", "vendor", "product", "version", "eventId"}
+
+// parseCEF разбирает сообщение ArcSight CEF. Префикс перед "CEF:",
+// например заголовок syslog, пропускается.
+func parseCEF(raw []byte) (map[string]interface{}, error) {
+	s := string(raw)
+
+	i := strings.Index(s, "CEF:")
+	if i < 0 {
+		return nil, errors.New("invalid CEF parse: no CEF header")
+	}
+
+	header, ext, err := splitHeader(s[i+len("CEF:"):], len(cefHeader))
+	if err != nil {
+		return nil, fmt.Errorf("invalid CEF parse: %w", err)
+	}
+
+	event := make(map[string]interface{}, len(cefHeader))
+	for i, name := range cefHeader {
+		event[name] = header[i]
+	}
+
+	parseCEFExtension(strings.TrimRight(ext, "\r\n"), event)
+
+	return event, nil
+}
+
+// splitHeader делит строку на n полей, разделенных "|", и остаток.
+// В полях "\|" и "\\" заменяются на "|" и "\".
+func splitHeader(s string, n int) ([]string, string, error) {
+	fields := make([]string, 0, n)
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && (s[i+1] == '|' || s[i+1] == '\\'):
+			i++
+			b.WriteByte(s[i])
+		case s[i] == '|':
+			fields = append(fields, b.String())
+			b.Reset()
+			if len(fields) == n {
+				return fields, s[i+1:], nil
+			}
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+
+	return nil, "", fmt.Errorf("expected %d header fields, got %d", n, len(fields))
+}
+
+// parseCEFExtension разбирает расширение "key=value key2=value with spaces".
+// Значение продолжается до пробела перед следующим ключом.
+func parseCEFExtension(ext string, event map[string]interface{}) {
+	type pair struct{ keyStart, eq int }
+
+	var pairs []pair
+	prevEq := -1
+	for j := 0; j < len(ext); j++ {
+		if ext[j] == '\\' {
+			j++
+			continue
+		}
+		if ext[j] != '=' {
+			continue
+		}
+
+		// Ключ начинается после последнего пробела, который должен
+		// находиться после предыдущего "=", иначе "=" часть значения
+		ks := strings.LastIndexByte(ext[:j], ' ') + 1
+		if (prevEq >= 0 && ks <= prevEq) || !isCEFKey(ext[ks:j]) {
+			continue
+		}
+
+		pairs = append(pairs, pair{keyStart: ks, eq: j})
+		prevEq = j
+	}
+
+	for i, p := range pairs {
+		end := len(ext)
+		if i+1 < len(pairs) {
+			end = pairs[i+1].keyStart
+		}
+
+		event[ext[p.keyStart:p.eq]] = unescapeCEF(strings.TrimRight(ext[p.eq+1:end], " "))
+	}
+}
+
+func isCEFKey(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+			c == '_' || c == '.' || c == '-' || c == '[' || c == ']') {
+			return false
+		}
+	}
+
+	return true
+}
+
+func unescapeCEF(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+
+	return b.String()
+}
+
+// parseLEEF разбирает сообщение IBM LEEF 1.0 и 2.0. Атрибуты в 1.0
+// разделены табуляцией, в 2.0 разделитель задается в заголовке.
+func parseLEEF(raw []byte) (map[string]interface{}, error) {
+	s := string(raw)
+
+	i := strings.Index(s, "LEEF:")
+	if i < 0 {
+		return nil, errors.New("invalid LEEF parse: no LEEF header")
+	}
+	s = strings.TrimRight(s[i+len("LEEF:"):], "\r\n")
+
+	header, attrs, err := splitHeader(s, len(leefHeader))
+	if err != nil {
+		return nil, fmt.Errorf("invalid LEEF parse: %w", err)
+	}
+
+	event := make(map[string]interface{}, len(leefHeader))
+	for i, name := range leefHeader {
+		event[name] = header[i]
+	}
+
+	delim := "\t"
+	if strings.HasPrefix(header[0], "2") {
+		d, rest, err := splitHeader(attrs, 1)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LEEF parse: no delimiter: %w", err)
+		}
+		attrs = rest
+
+		if delim, err = leefDelimiter(d[0]); err != nil {
+			return nil, fmt.Errorf("invalid LEEF parse: %w", err)
+		}
+	}
+
+	for _, a := range strings.Split(attrs, delim) {
+		k, v, ok := strings.Cut(a, "=")
+		if ok && k != "" {
+			event[k] = v
+		}
+	}
+
+	return event, nil
+}
+
+// leefDelimiter разбирает разделитель LEEF 2.0: символ или его код
+// в виде x09 или 0x09. Пустое значение означает табуляцию.
+func leefDelimiter(d string) (string, error) {
+	if d == "" {
+		return "\t", nil
+	}
+
+	var hex string
+	switch {
+	case strings.HasPrefix(d, "0x"):
+		hex = d[2:]
+	case strings.HasPrefix(d, "x") && len(d) > 1:
+		hex = d[1:]
+	default:
+		return d, nil
+	}
+
+	c, err := strconv.ParseUint(hex, 16, 8)
+	if err != nil {
+		return "", fmt.Errorf("invalid delimiter %q: %w", d, err)
+	}
+
+	return string(rune(c)), nil
+}
@@ -0,0 +1,274 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+// Commit - параметры подтверждения смещений consumer group.
+type Commit struct {
+	// Interval - период подтверждения обработанных сообщений
+	Interval time.Duration
+	// Batch - число обработанных сообщений, после которого смещения
+	// подтверждаются, не дожидаясь Interval
+	Batch int
+}
+
+// DefaultCommit - параметры подтверждения по умолчанию.
+var DefaultCommit = Commit{
+	Interval: time.Second,
+	Batch:    100,
+}
+
+// offsetCommitter - часть kafka.Reader, подтверждающая смещения.
+type offsetCommitter interface {
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// committer накапливает полностью обработанные сообщения и подтверждает их
+// смещения пачками. Сообщение отмечается только после того, как результат
+// записан с подтверждением брокера или ошибка обработана политикой onError,
+// поэтому после сбоя необработанные сообщения читаются повторно.
+type committer struct {
+	r     offsetCommitter
+	batch int
+
+	mu      sync.Mutex
+	pending map[int]kafka.Message
+	count   int
+
+	// Подтверждения выполняются по очереди, чтобы смещение не откатилось назад
+	commitMu sync.Mutex
+}
+
+func newCommitter(r offsetCommitter, batch int) *committer {
+	if batch <= 0 {
+		batch = 1
+	}
+
+	return &committer{r: r, batch: batch, pending: make(map[int]kafka.Message)}
+}
+
+// mark отмечает сообщение обработанным и подтверждает накопленные смещения,
+// если набралась пачка.
+func (c *committer) mark(ctx context.Context, msg kafka.Message) error {
+	if c.add(msg) {
+		return c.flush(ctx)
+	}
+
+	return nil
+}
+
+// add отмечает сообщение обработанным без подтверждения и сообщает, что
+// набралась пачка.
+func (c *committer) add(msg kafka.Message) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Сообщения партиции отмечаются по порядку, достаточно последнего
+	c.pending[msg.Partition] = msg
+	c.count++
+
+	return c.count >= c.batch
+}
+
+// flush подтверждает смещения всех отмеченных сообщений.
+func (c *committer) flush(ctx context.Context) error {
+	c.commitMu.Lock()
+	defer c.commitMu.Unlock()
+
+	c.mu.Lock()
+	msgs := make([]kafka.Message, 0, len(c.pending))
+	for p, msg := range c.pending {
+		msgs = append(msgs, msg)
+		delete(c.pending, p)
+	}
+	c.count = 0
+	c.mu.Unlock()
+
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	if err := c.r.CommitMessages(ctx, msgs...); err != nil {
+		// Неподтвержденные смещения возвращаются, если партиция не продвинулась дальше
+		c.mu.Lock()
+		for _, msg := range msgs {
+			if _, ok := c.pending[msg.Partition]; !ok {
+				c.pending[msg.Partition] = msg
+			}
+		}
+		c.mu.Unlock()
+
+		return fmt.Errorf("failed commit messages: %w", err)
+	}
+
+	return nil
+}
+
+// run периодически подтверждает смещения до отмены контекста.
+func (c *committer) run(ctx context.Context, interval time.Duration, id string, lg *zap.Logger) {
+	if interval <= 0 {
+		return
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			// Ошибка не останавливает воркер: смещения будут подтверждены позже
+			if err := c.flush(ctx); err != nil && ctx.Err() == nil {
+				lg.With(zap.Error(err)).Warn("Periodic commit failed", zap.String("ID", id))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// inflight отслеживает прочитанные сообщения, результат которых еще записывается
+// асинхронно. Сообщение передается committer, только когда завершены оно и все
+// предыдущие сообщения его партиции, поэтому смещение не обгоняет незаписанные
+// результаты.
+type inflight struct {
+	cm   *committer
+	ctx  context.Context
+	fail func(error)
+	// Ограничивает число сообщений в работе
+	slots chan struct{}
+
+	mu    sync.Mutex
+	parts map[int][]*pendingMsg
+}
+
+// pendingMsg - сообщение в работе. refs - число незавершенных действий:
+// обработка в воркере и запись каждого результата.
+type pendingMsg struct {
+	msg  kafka.Message
+	refs int
+	// dropped - сообщение убрано из очереди после повторного чтения партиции
+	dropped bool
+}
+
+func newInflight(ctx context.Context, cm *committer, limit int, fail func(error)) *inflight {
+	if limit <= 0 {
+		limit = 1
+	}
+
+	return &inflight{
+		cm:    cm,
+		ctx:   ctx,
+		fail:  fail,
+		slots: make(chan struct{}, limit),
+		parts: make(map[int][]*pendingMsg),
+	}
+}
+
+// add начинает отслеживать прочитанное сообщение и возвращает его с отметкой,
+// по которой retain и release находят сообщение в работе. Если в работе уже
+// limit сообщений, add ждет завершения одного из них.
+// Если партиция прочитана снова с уже полученного смещения, например после
+// перебалансировки группы, прежняя очередь партиции сбрасывается: ее сообщения
+// будут обработаны и подтверждены повторно, а завершение прежних не учитывается.
+func (f *inflight) add(ctx context.Context, msg kafka.Message) (kafka.Message, error) {
+	// Сброс выполняется до ожидания места, иначе прежние сообщения могут занять все места
+	f.mu.Lock()
+	if q := f.parts[msg.Partition]; len(q) != 0 && msg.Offset <= q[len(q)-1].msg.Offset {
+		for _, p := range q {
+			p.dropped = true
+			if p.refs > 0 {
+				<-f.slots
+			}
+		}
+		delete(f.parts, msg.Partition)
+	}
+	f.mu.Unlock()
+
+	select {
+	case f.slots <- struct{}{}:
+	case <-ctx.Done():
+		return msg, ctx.Err()
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p := &pendingMsg{msg: msg, refs: 1}
+	msg.WriterData = p
+	f.parts[msg.Partition] = append(f.parts[msg.Partition], p)
+
+	return msg, nil
+}
+
+// find возвращает сообщение в работе по отметке add, вызывается под f.mu.
+func (f *inflight) find(msg kafka.Message) *pendingMsg {
+	p, ok := msg.WriterData.(*pendingMsg)
+	if !ok || p.dropped {
+		return nil
+	}
+
+	return p
+}
+
+// retain отмечает начало асинхронной записи результата сообщения.
+func (f *inflight) retain(msg kafka.Message) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if p := f.find(msg); p != nil {
+		p.refs++
+	}
+}
+
+// release отмечает завершение действия над сообщением. Завершенные сообщения
+// с начала очереди партиции передаются committer.
+func (f *inflight) release(msg kafka.Message) {
+	f.mu.Lock()
+	last, ok := f.complete(msg)
+	// Отметка под f.mu, чтобы смещения партиции передавались по порядку
+	full := ok && f.cm.add(last)
+	f.mu.Unlock()
+
+	// Подтверждение обращается к брокеру и выполняется без блокировки, чтобы
+	// не задерживать остальные обработчики и запись результатов
+	if full {
+		if err := f.cm.flush(f.ctx); err != nil {
+			f.fail(err)
+		}
+	}
+}
+
+// complete уменьшает счетчик действий сообщения и убирает завершенные сообщения
+// с начала очереди партиции. Возвращает последнее из них. Вызывается под f.mu.
+func (f *inflight) complete(msg kafka.Message) (kafka.Message, bool) {
+	p := f.find(msg)
+	if p == nil {
+		return kafka.Message{}, false
+	}
+
+	p.refs--
+	if p.refs > 0 {
+		return kafka.Message{}, false
+	}
+	<-f.slots
+
+	q := f.parts[p.msg.Partition]
+	n := 0
+	for n < len(q) && q[n].refs == 0 {
+		n++
+	}
+	if n == 0 {
+		return kafka.Message{}, false
+	}
+
+	f.parts[msg.Partition] = q[n:]
+
+	return q[n-1].msg, true
+}
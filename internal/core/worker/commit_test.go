@@ -0,0 +1,247 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// fakeCommitter запоминает подтвержденные смещения по партициям.
+type fakeCommitter struct {
+	mu      sync.Mutex
+	offsets map[int]int64
+	calls   int
+	err     error
+}
+
+func (f *fakeCommitter) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls++
+	if f.err != nil {
+		return f.err
+	}
+
+	for _, m := range msgs {
+		f.offsets[m.Partition] = m.Offset
+	}
+
+	return nil
+}
+
+func (f *fakeCommitter) state() (map[int]int64, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	res := make(map[int]int64, len(f.offsets))
+	for p, o := range f.offsets {
+		res[p] = o
+	}
+
+	return res, f.calls
+}
+
+func TestCommitter_Batch(t *testing.T) {
+	f := &fakeCommitter{offsets: make(map[int]int64)}
+	cm := newCommitter(f, 3)
+	ctx := context.Background()
+
+	assert.NoError(t, cm.mark(ctx, kafka.Message{Partition: 0, Offset: 1}))
+	assert.NoError(t, cm.mark(ctx, kafka.Message{Partition: 1, Offset: 7}))
+
+	// Пачка не набрана, подтверждений нет
+	_, calls := f.state()
+	assert.Equal(t, 0, calls)
+
+	// Третье сообщение подтверждает последние смещения каждой партиции одним вызовом
+	assert.NoError(t, cm.mark(ctx, kafka.Message{Partition: 0, Offset: 2}))
+	offsets, calls := f.state()
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, map[int]int64{0: 2, 1: 7}, offsets)
+
+	// Пустой flush не обращается к брокеру
+	assert.NoError(t, cm.flush(ctx))
+	_, calls = f.state()
+	assert.Equal(t, 1, calls)
+}
+
+func TestCommitter_FailedCommit(t *testing.T) {
+	f := &fakeCommitter{offsets: make(map[int]int64), err: errors.New("broker is down")}
+	cm := newCommitter(f, 10)
+	ctx := context.Background()
+
+	assert.NoError(t, cm.mark(ctx, kafka.Message{Partition: 0, Offset: 5}))
+	assert.Error(t, cm.flush(ctx))
+
+	// Неподтвержденное смещение не теряется
+	f.err = nil
+	assert.NoError(t, cm.flush(ctx))
+	offsets, _ := f.state()
+	assert.Equal(t, map[int]int64{0: 5}, offsets)
+}
+
+func TestCommitter_Run(t *testing.T) {
+	f := &fakeCommitter{offsets: make(map[int]int64)}
+	cm := newCommitter(f, 100)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cm.run(ctx, time.Millisecond, "1", zap.NewNop())
+	}()
+
+	for i := int64(0); i < 5; i++ {
+		assert.NoError(t, cm.mark(context.Background(), kafka.Message{Partition: int(i % 2), Offset: i}))
+	}
+
+	assert.Eventually(t, func() bool {
+		offsets, _ := f.state()
+		return len(offsets) == 2 && offsets[0] == 4 && offsets[1] == 3
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	<-done
+}
+
+func TestInflight_Order(t *testing.T) {
+	f := &fakeCommitter{offsets: make(map[int]int64)}
+	cm := newCommitter(f, 1)
+	ctx := context.Background()
+
+	var failed error
+	acks := newInflight(ctx, cm, 10, func(err error) { failed = err })
+
+	msgs := []kafka.Message{{Partition: 0, Offset: 1}, {Partition: 0, Offset: 2}, {Partition: 1, Offset: 9}}
+	for i, m := range msgs {
+		m, err := acks.add(ctx, m)
+		assert.NoError(t, err)
+		acks.retain(m)
+		acks.release(m)
+		msgs[i] = m
+	}
+
+	// Запись второго сообщения завершилась раньше первого, смещение не продвигается
+	acks.release(msgs[1])
+	acks.release(msgs[2])
+	offsets, _ := f.state()
+	assert.Equal(t, map[int]int64{1: 9}, offsets)
+
+	acks.release(msgs[0])
+	offsets, _ = f.state()
+	assert.Equal(t, map[int]int64{0: 2, 1: 9}, offsets)
+	assert.NoError(t, failed)
+
+	// Ошибка подтверждения передается воркеру
+	f.err = errors.New("broker is down")
+	m, err := acks.add(ctx, kafka.Message{Partition: 0, Offset: 3})
+	assert.NoError(t, err)
+	acks.release(m)
+	assert.Error(t, failed)
+}
+
+func TestInflight_Limit(t *testing.T) {
+	acks := newInflight(context.Background(), newCommitter(&fakeCommitter{offsets: make(map[int]int64)}, 1), 1, func(error) {})
+
+	m, err := acks.add(context.Background(), kafka.Message{Offset: 1})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = acks.add(ctx, kafka.Message{Offset: 2})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	acks.release(m)
+	_, err = acks.add(context.Background(), kafka.Message{Offset: 2})
+	assert.NoError(t, err)
+}
+
+func TestInflight_Redelivery(t *testing.T) {
+	f := &fakeCommitter{offsets: make(map[int]int64)}
+	ctx := context.Background()
+	acks := newInflight(ctx, newCommitter(f, 1), 3, func(error) {})
+
+	// Сообщения партиции в работе, их результаты еще записываются
+	var old []kafka.Message
+	for off := int64(5); off < 8; off++ {
+		m, err := acks.add(ctx, kafka.Message{Partition: 0, Offset: off})
+		assert.NoError(t, err)
+		acks.retain(m)
+		acks.release(m)
+		old = append(old, m)
+	}
+
+	// После перебалансировки партиция читается снова с подтвержденного смещения.
+	// Прежние сообщения освобождают места, add не блокируется
+	addCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	m, err := acks.add(addCtx, kafka.Message{Partition: 0, Offset: 5})
+	assert.NoError(t, err)
+	acks.retain(m)
+
+	// Завершение прежней записи того же смещения не засчитывается новому сообщению
+	for _, o := range old {
+		acks.release(o)
+	}
+	offsets, _ := f.state()
+	assert.Empty(t, offsets)
+
+	acks.release(m)
+	acks.release(m)
+	offsets, _ = f.state()
+	assert.Equal(t, map[int]int64{0: 5}, offsets)
+
+	// Все места свободны
+	for off := int64(6); off < 9; off++ {
+		_, err := acks.add(addCtx, kafka.Message{Partition: 0, Offset: off})
+		assert.NoError(t, err)
+	}
+}
+
+// blockingCommitter ждет разрешения на каждое подтверждение.
+type blockingCommitter struct {
+	started chan struct{}
+	unblock chan struct{}
+}
+
+func (b *blockingCommitter) CommitMessages(context.Context, ...kafka.Message) error {
+	b.started <- struct{}{}
+	<-b.unblock
+	return nil
+}
+
+func TestInflight_SlowCommit(t *testing.T) {
+	b := &blockingCommitter{started: make(chan struct{}, 1), unblock: make(chan struct{})}
+	ctx := context.Background()
+	acks := newInflight(ctx, newCommitter(b, 1), 10, func(error) {})
+
+	m, err := acks.add(ctx, kafka.Message{Partition: 0, Offset: 1})
+	assert.NoError(t, err)
+	go acks.release(m)
+	<-b.started
+
+	// Пока брокер не ответил, сообщения других партиций добавляются и завершаются
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		other, err := acks.add(ctx, kafka.Message{Partition: 1, Offset: 1})
+		assert.NoError(t, err)
+		acks.retain(other)
+		acks.release(other)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("release is blocked by commit")
+	}
+	close(b.unblock)
+}
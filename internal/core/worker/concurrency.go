@@ -0,0 +1,186 @@
+package worker
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dedpnd/unifier/internal/models"
+	"github.com/segmentio/kafka-go"
+)
+
+// Порядок обработки событий при параллельной обработке.
+const (
+	OrderingPartition = "partition"
+	OrderingSourceKey = "sourceKey"
+)
+
+// maxWorkers - наибольшее число обработчиков правила.
+const maxWorkers = 64
+
+// lanesConfig - проверенная секция concurrency.
+type lanesConfig struct {
+	workers  int
+	ordering string
+}
+
+// compileConcurrency проверяет секцию concurrency. По умолчанию события
+// обрабатываются одним обработчиком.
+func compileConcurrency(cfg *models.Concurrency) (lanesConfig, error) {
+	c := lanesConfig{workers: 1, ordering: OrderingPartition}
+	if cfg == nil {
+		return c, nil
+	}
+
+	ve := &ValidationError{}
+
+	switch {
+	case cfg.Workers < 0:
+		ve.add("/concurrency/workers", "must be positive")
+	case cfg.Workers > maxWorkers:
+		ve.add("/concurrency/workers", "must be at most %d", maxWorkers)
+	case cfg.Workers > 0:
+		c.workers = cfg.Workers
+	}
+
+	switch cfg.Ordering {
+	case "":
+	case OrderingPartition, OrderingSourceKey:
+		c.ordering = cfg.Ordering
+	default:
+		ve.add("/concurrency/ordering", "unknown ordering: %v", cfg.Ordering)
+	}
+
+	return c, ve.err()
+}
+
+// lane выбирает обработчик сообщения. Сообщения одной партиции, а при
+// ordering sourceKey - с одним ключом исходного сообщения, всегда попадают
+// к одному обработчику и обрабатываются по порядку. Сообщения без ключа
+// распределяются по партиции. Поле entity для выбора не подходит: оно
+// вычисляется только после разбора события, который и выполняют обработчики.
+func (c lanesConfig) lane(msg kafka.Message) int {
+	if c.workers == 1 {
+		return 0
+	}
+
+	if c.ordering == OrderingSourceKey && len(msg.Key) != 0 {
+		h := fnv.New32a()
+		_, _ = h.Write(msg.Key)
+		return int(h.Sum32() % uint32(c.workers))
+	}
+
+	return msg.Partition % c.workers
+}
+
+// each обрабатывает пачку сообщений обработчиками правила и возвращает первую
+// ошибку. После ошибки оставшиеся сообщения не обрабатываются.
+func (c lanesConfig) each(msgs []kafka.Message, fn func(kafka.Message) error) error {
+	if c.workers == 1 {
+		for _, msg := range msgs {
+			if err := fn(msg); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	split := make([][]kafka.Message, c.workers)
+	for _, msg := range msgs {
+		i := c.lane(msg)
+		split[i] = append(split[i], msg)
+	}
+
+	var (
+		wg      sync.WaitGroup
+		errOnce sync.Once
+		first   error
+		stopped atomic.Bool
+	)
+	for _, part := range split {
+		if len(part) == 0 {
+			continue
+		}
+
+		wg.Add(1)
+		go func(part []kafka.Message) {
+			defer wg.Done()
+
+			for _, msg := range part {
+				if stopped.Load() {
+					return
+				}
+				if err := fn(msg); err != nil {
+					errOnce.Do(func() { first = err })
+					stopped.Store(true)
+					return
+				}
+			}
+		}(part)
+	}
+	wg.Wait()
+
+	return first
+}
+
+// lanes передает прочитанные сообщения обработчикам. С одним обработчиком
+// сообщение обрабатывается в вызывающей горутине.
+type lanes struct {
+	cfg    lanesConfig
+	ctx    context.Context
+	fn     func(kafka.Message)
+	queues []chan kafka.Message
+	wg     sync.WaitGroup
+}
+
+// newLanes запускает обработчики. После отмены ctx сообщения из очередей
+// не обрабатываются и будут прочитаны снова после перезапуска.
+func newLanes(ctx context.Context, cfg lanesConfig, buffer int, fn func(kafka.Message)) *lanes {
+	l := &lanes{cfg: cfg, ctx: ctx, fn: fn}
+	if cfg.workers == 1 {
+		return l
+	}
+
+	l.queues = make([]chan kafka.Message, cfg.workers)
+	for i := range l.queues {
+		q := make(chan kafka.Message, buffer)
+		l.queues[i] = q
+
+		l.wg.Add(1)
+		go func() {
+			defer l.wg.Done()
+
+			for msg := range q {
+				if ctx.Err() == nil {
+					fn(msg)
+				}
+			}
+		}()
+	}
+
+	return l
+}
+
+// dispatch передает сообщение обработчику. Блокируется, пока очередь обработчика заполнена.
+func (l *lanes) dispatch(msg kafka.Message) error {
+	if l.queues == nil {
+		l.fn(msg)
+		return nil
+	}
+
+	select {
+	case l.queues[l.cfg.lane(msg)] <- msg:
+		return nil
+	case <-l.ctx.Done():
+		return l.ctx.Err()
+	}
+}
+
+// close дожидается завершения обработчиков.
+func (l *lanes) close() {
+	for _, q := range l.queues {
+		close(q)
+	}
+	l.wg.Wait()
+}
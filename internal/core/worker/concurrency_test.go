@@ -0,0 +1,253 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/dedpnd/unifier/internal/models"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_compileConcurrency(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *models.Concurrency
+		want lanesConfig
+		errs []FieldError
+	}{
+		{name: "Default", want: lanesConfig{workers: 1, ordering: OrderingPartition}},
+		{
+			name: "Source key ordering",
+			cfg:  &models.Concurrency{Workers: 8, Ordering: OrderingSourceKey},
+			want: lanesConfig{workers: 8, ordering: OrderingSourceKey},
+		},
+		{
+			name: "Invalid",
+			cfg:  &models.Concurrency{Workers: maxWorkers + 1, Ordering: "entity"},
+			errs: []FieldError{
+				{Pointer: "/concurrency/workers", Message: "must be at most 64"},
+				{Pointer: "/concurrency/ordering", Message: "unknown ordering: entity"},
+			},
+		},
+		{
+			name: "Negative workers",
+			cfg:  &models.Concurrency{Workers: -1},
+			errs: []FieldError{{Pointer: "/concurrency/workers", Message: "must be positive"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := compileConcurrency(tt.cfg)
+			if tt.errs != nil {
+				var ve *ValidationError
+				assert.ErrorAs(t, err, &ve)
+				assert.Equal(t, tt.errs, ve.Errors)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// testMessages возвращает по n сообщений в каждой из партиций.
+func testMessages(partitions, n int) []kafka.Message {
+	var msgs []kafka.Message
+	for off := 0; off < n; off++ {
+		for p := 0; p < partitions; p++ {
+			msgs = append(msgs, kafka.Message{
+				Partition: p,
+				Offset:    int64(off),
+				Key:       []byte(fmt.Sprintf("key-%d", off%3)),
+			})
+		}
+	}
+
+	return msgs
+}
+
+// orderRecorder запоминает порядок обработки сообщений по партициям и ключам.
+type orderRecorder struct {
+	mu     sync.Mutex
+	byPart map[int][]int64
+	byKey  map[string][]int
+}
+
+func newOrderRecorder() *orderRecorder {
+	return &orderRecorder{byPart: make(map[int][]int64), byKey: make(map[string][]int)}
+}
+
+func (o *orderRecorder) record(msg kafka.Message) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.byPart[msg.Partition] = append(o.byPart[msg.Partition], msg.Offset)
+	o.byKey[string(msg.Key)] = append(o.byKey[string(msg.Key)], msg.Partition)
+}
+
+func TestLanesConfig_each(t *testing.T) {
+	msgs := testMessages(5, 20)
+
+	t.Run("Partition ordering", func(t *testing.T) {
+		rec := newOrderRecorder()
+		err := lanesConfig{workers: 3, ordering: OrderingPartition}.each(msgs, func(msg kafka.Message) error {
+			rec.record(msg)
+			return nil
+		})
+		assert.NoError(t, err)
+
+		assert.Len(t, rec.byPart, 5)
+		for p, offsets := range rec.byPart {
+			assert.IsIncreasing(t, offsets, "partition %d", p)
+			assert.Len(t, offsets, 20)
+		}
+	})
+
+	t.Run("Source key ordering", func(t *testing.T) {
+		// Сообщения одного ключа обрабатываются в порядке чтения
+		want := make(map[string][]string)
+		for _, msg := range msgs {
+			want[string(msg.Key)] = append(want[string(msg.Key)], fmt.Sprintf("%d/%d", msg.Partition, msg.Offset))
+		}
+
+		var (
+			mu  sync.Mutex
+			got = make(map[string][]string)
+		)
+		err := lanesConfig{workers: 4, ordering: OrderingSourceKey}.each(msgs, func(msg kafka.Message) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			got[string(msg.Key)] = append(got[string(msg.Key)], fmt.Sprintf("%d/%d", msg.Partition, msg.Offset))
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, want, got)
+	})
+
+	t.Run("Stop on error", func(t *testing.T) {
+		failed := errors.New("failed")
+		var after atomic.Int64
+
+		err := lanesConfig{workers: 1, ordering: OrderingPartition}.each(msgs, func(msg kafka.Message) error {
+			if msg.Partition == 1 && msg.Offset == 0 {
+				return failed
+			}
+			if msg.Offset > 0 {
+				after.Add(1)
+			}
+			return nil
+		})
+		assert.ErrorIs(t, err, failed)
+		assert.Zero(t, after.Load())
+
+		err = lanesConfig{workers: 4, ordering: OrderingPartition}.each(msgs, func(msg kafka.Message) error {
+			if msg.Partition == 2 {
+				return failed
+			}
+			return nil
+		})
+		assert.ErrorIs(t, err, failed)
+	})
+}
+
+func TestLanes(t *testing.T) {
+	msgs := testMessages(7, 50)
+
+	rec := newOrderRecorder()
+	var handled atomic.Int64
+	l := newLanes(context.Background(), lanesConfig{workers: 4, ordering: OrderingPartition}, 2, func(msg kafka.Message) {
+		rec.record(msg)
+		handled.Add(1)
+	})
+	for _, msg := range msgs {
+		assert.NoError(t, l.dispatch(msg))
+	}
+	l.close()
+
+	assert.Equal(t, int64(len(msgs)), handled.Load())
+	for p, offsets := range rec.byPart {
+		assert.IsIncreasing(t, offsets, "partition %d", p)
+	}
+
+	t.Run("Cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		started := make(chan struct{}, 1)
+		block := make(chan struct{})
+		l := newLanes(ctx, lanesConfig{workers: 2, ordering: OrderingPartition}, 1, func(kafka.Message) {
+			started <- struct{}{}
+			<-block
+		})
+
+		// Первый обработчик занят, его очередь заполнена, dispatch ждет до отмены контекста
+		assert.NoError(t, l.dispatch(kafka.Message{Partition: 0}))
+		<-started
+		assert.NoError(t, l.dispatch(kafka.Message{Partition: 0}))
+		done := make(chan error, 1)
+		go func() {
+			done <- l.dispatch(kafka.Message{Partition: 0})
+		}()
+		cancel()
+		assert.ErrorIs(t, <-done, context.Canceled)
+
+		close(block)
+		l.close()
+	})
+}
+
+// Обработка примеров kafka-perf-test воркером с разным числом обработчиков.
+// Запуск: go test ./internal/core/worker -run '^$' -bench BenchmarkRunner_Concurrency
+func BenchmarkRunner_Concurrency(b *testing.B) {
+	events := loadExampleEvents(b)
+	cfg := parseConfig(b, seedRule)
+	// Без фильтра каждое событие кодируется и записывается
+	cfg.Filter = models.Filter{}
+
+	rule, err := CompileRule(cfg)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	const partitions = 12
+	msgs := make([]kafka.Message, len(events))
+	for i, e := range events {
+		msgs[i] = kafka.Message{Partition: i % partitions, Offset: int64(i / partitions), Value: e}
+	}
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			wrk := &workerEntity{ID: "bench", state: newWorkerState(), stats: newWorkerStats()}
+			wrk.rule.Store(rule)
+
+			w := &runner{
+				wrk:  wrk,
+				lg:   zap.NewNop(),
+				wCtx: context.Background(),
+				emit: func(kafka.Message) error { return nil },
+			}
+
+			l := newLanes(context.Background(), lanesConfig{workers: workers, ordering: OrderingPartition}, 100,
+				func(msg kafka.Message) {
+					if err := w.handle(msg); err != nil {
+						b.Error(err)
+					}
+				})
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := l.dispatch(msgs[i%len(msgs)]); err != nil {
+					b.Fatal(err)
+				}
+			}
+			l.close()
+		})
+	}
+}
@@ -0,0 +1,293 @@
+package worker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dedpnd/unifier/internal/models"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// Режимы проверки документов контрактом топика в воркере.
+const (
+	ContractEnforce = "enforce"
+	ContractWarn    = "warn"
+	ContractOff     = "off"
+)
+
+// errContractViolation - документ не соответствует схеме topicTo.
+var errContractViolation = errors.New("contract violation")
+
+// Contract - JSON Schema документов выходного топика.
+type Contract struct {
+	topic  string
+	mode   string
+	schema *gojsonschema.Schema
+	// Корневые свойства схемы для статической проверки правил
+	props    map[string][]string
+	required []string
+	closed   bool
+}
+
+// schemaShape - часть схемы, по которой проверяются поля правила.
+type schemaShape struct {
+	Properties           map[string]json.RawMessage `json:"properties"`
+	Required             []string                   `json:"required"`
+	AdditionalProperties json.RawMessage            `json:"additionalProperties"`
+}
+
+// CompileContract проверяет схему топика и подставляет режим по умолчанию.
+func CompileContract(ts models.TopicSchema) (*Contract, error) {
+	ve := &ValidationError{}
+	c := &Contract{topic: ts.Topic, mode: ts.Mode}
+
+	switch c.mode {
+	case "":
+		c.mode = ContractEnforce
+	case ContractEnforce, ContractWarn, ContractOff:
+	default:
+		ve.add("/mode", "unknown mode: %v", ts.Mode)
+	}
+
+	if len(ts.Schema) == 0 {
+		ve.add("/schema", "is required")
+		return nil, ve.err()
+	}
+
+	schema, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(ts.Schema))
+	if err != nil {
+		ve.add("/schema", "invalid schema: %v", err)
+		return nil, ve.err()
+	}
+	c.schema = schema
+
+	// Схема true или false не описывает свойств
+	var shape schemaShape
+	_ = json.Unmarshal(ts.Schema, &shape)
+
+	c.props = make(map[string][]string, len(shape.Properties))
+	for name, raw := range shape.Properties {
+		c.props[name] = schemaTypes(raw)
+	}
+	c.required = shape.Required
+	c.closed = string(shape.AdditionalProperties) == "false"
+
+	if err := ve.err(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// schemaTypes возвращает типы свойства схемы, nil - любой тип.
+func schemaTypes(raw json.RawMessage) []string {
+	var prop struct {
+		Type json.RawMessage `json:"type"`
+	}
+	if err := json.Unmarshal(raw, &prop); err != nil || len(prop.Type) == 0 {
+		return nil
+	}
+
+	var typ string
+	if err := json.Unmarshal(prop.Type, &typ); err == nil {
+		return []string{typ}
+	}
+
+	var types []string
+	if err := json.Unmarshal(prop.Type, &types); err == nil {
+		return types
+	}
+
+	return nil
+}
+
+// Mode возвращает режим проверки документов в воркере.
+func (c *Contract) Mode() string {
+	return c.mode
+}
+
+// jsonType возвращает тип JSON, который дает поле унификатора.
+func jsonType(u models.Unifier) string {
+	switch u.Type {
+	case "int":
+		return "integer"
+	case "float":
+		return "number"
+	case "bool":
+		return "boolean"
+	case "array", "object":
+		return u.Type
+	case "timestamp":
+		if u.Timestamp != nil && strings.HasPrefix(u.Timestamp.Output, "epoch_") {
+			return "integer"
+		}
+	}
+
+	return "string"
+}
+
+func typeAllowed(types []string, typ string) bool {
+	if types == nil {
+		return true
+	}
+
+	for _, t := range types {
+		if t == typ || (t == "number" && typ == "integer") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CheckRule статически сверяет поля, которые пишет правило, со схемой:
+// имена и типы полей unifier, поля To функций extraProcess, блок _meta
+// и обязательные поля.
+// Тип результата функций заранее неизвестен и не проверяется.
+func (c *Contract) CheckRule(r *Rule) error {
+	ve := &ValidationError{}
+	cfg := r.Config()
+
+	produced := map[string]bool{"entity": true}
+	if types, ok := c.props["entity"]; !ok && c.closed {
+		ve.add("/topicTo", "field entity is not allowed by topic %v schema", c.topic)
+	} else if !typeAllowed(types, "string") {
+		ve.add("/topicTo", "field entity has type string, topic %v schema expects %v",
+			c.topic, strings.Join(types, ", "))
+	}
+
+	for i, u := range cfg.Unifier {
+		produced[u.Name] = true
+		ptr := fmt.Sprintf("/unifier/%d", i)
+
+		types, ok := c.props[u.Name]
+		if !ok {
+			if c.closed {
+				ve.add(ptr+"/name", "field %v is not allowed by topic %v schema", u.Name, c.topic)
+			}
+			continue
+		}
+
+		if typ := jsonType(u); !typeAllowed(types, typ) {
+			ve.add(ptr+"/type", "field %v has type %v, topic %v schema expects %v",
+				u.Name, typ, c.topic, strings.Join(types, ", "))
+		}
+	}
+
+	for i, ep := range cfg.ExtraProcess {
+		if ep.To == "" {
+			continue
+		}
+		produced[ep.To] = true
+
+		if _, ok := c.props[ep.To]; !ok && c.closed {
+			ve.add(fmt.Sprintf("/extraProcess/%d/to", i), "field %v is not allowed by topic %v schema", ep.To, c.topic)
+		}
+	}
+
+	if r.envelope.meta == MetaField {
+		produced[MetaKey] = true
+
+		if types, ok := c.props[MetaKey]; !ok && c.closed {
+			ve.add("/envelope/meta", "field %v is not allowed by topic %v schema", MetaKey, c.topic)
+		} else if !typeAllowed(types, "object") {
+			ve.add("/envelope/meta", "field %v has type object, topic %v schema expects %v",
+				MetaKey, c.topic, strings.Join(types, ", "))
+		}
+	}
+
+	for _, name := range c.required {
+		if !produced[name] {
+			ve.add("/topicTo", "field %v required by topic %v schema is not produced", name, c.topic)
+		}
+	}
+
+	return ve.err()
+}
+
+// CheckRules сверяет со схемой сохраненные правила, которые пишут в топик
+// контракта. Указатели ошибок начинаются с /rules/{id}. Правила с ошибками
+// компиляции не проверяются: их воркеры и так не запущены.
+func (c *Contract) CheckRules(rules []models.Rule) error {
+	ve := &ValidationError{}
+
+	for _, dr := range rules {
+		if dr.Rule.TopicTo != c.topic {
+			continue
+		}
+
+		rule, err := CompileRule(dr.Rule)
+		if err != nil {
+			continue
+		}
+
+		var rve *ValidationError
+		if errors.As(c.CheckRule(rule), &rve) {
+			for _, fe := range rve.Errors {
+				ve.add(fmt.Sprintf("/rules/%d%v", dr.ID, fe.Pointer), "%v", fe.Message)
+			}
+		}
+	}
+
+	return ve.err()
+}
+
+// Validate проверяет документ схемой во время работы воркера.
+func (c *Contract) Validate(doc map[string]interface{}) error {
+	res, err := c.schema.Validate(gojsonschema.NewGoLoader(doc))
+	if err != nil {
+		return fmt.Errorf("failed validate document: %w", err)
+	}
+
+	if res.Valid() {
+		return nil
+	}
+
+	msgs := make([]string, 0, len(res.Errors()))
+	for _, e := range res.Errors() {
+		msgs = append(msgs, e.String())
+	}
+	sort.Strings(msgs)
+
+	return fmt.Errorf("%w: topic %v: %v", errContractViolation, c.topic, strings.Join(msgs, "; "))
+}
+
+// contractSet - контракты выходных топиков, общие для воркеров пула.
+type contractSet struct {
+	mu sync.RWMutex
+	m  map[string]*Contract
+}
+
+func newContractSet() *contractSet {
+	return &contractSet{m: make(map[string]*Contract)}
+}
+
+// get возвращает контракт топика или nil.
+func (s *contractSet) get(topic string) *Contract {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.m[topic]
+}
+
+func (s *contractSet) set(c *Contract) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.m[c.topic] = c
+}
+
+func (s *contractSet) delete(topic string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.m, topic)
+}
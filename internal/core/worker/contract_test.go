@@ -0,0 +1,150 @@
+package worker
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/dedpnd/unifier/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+const testTopicSchema = `{
+	"type": "object",
+	"required": ["entity", "port", "severity"],
+	"additionalProperties": false,
+	"properties": {
+		"entity": {"type": "string"},
+		"port": {"type": "integer", "minimum": 1},
+		"ts": {"type": ["integer", "null"]},
+		"ratio": {"type": "number"},
+		"severity": {}
+	}
+}`
+
+func testContract(t *testing.T, mode string) *Contract {
+	t.Helper()
+
+	c, err := CompileContract(models.TopicSchema{Topic: "typed", Schema: json.RawMessage(testTopicSchema), Mode: mode})
+	assert.NoError(t, err)
+
+	return c
+}
+
+func TestCompileContract(t *testing.T) {
+	assert.Equal(t, ContractEnforce, testContract(t, "").Mode())
+	assert.Equal(t, ContractWarn, testContract(t, ContractWarn).Mode())
+
+	_, err := CompileContract(models.TopicSchema{Topic: "typed", Schema: json.RawMessage(`{"type": 1}`), Mode: "x"})
+
+	var ve *ValidationError
+	assert.ErrorAs(t, err, &ve)
+	assert.Len(t, ve.Errors, 2)
+	assert.Equal(t, "/mode", ve.Errors[0].Pointer)
+	assert.Equal(t, "/schema", ve.Errors[1].Pointer)
+}
+
+func TestContract_CheckRule(t *testing.T) {
+	c := testContract(t, "")
+
+	tests := []struct {
+		name string
+		cfg  string
+		want []FieldError
+	}{
+		{
+			name: "Compatible rule",
+			cfg: `{"unifier": [{"name": "port", "type": "int", "expression": "p"},
+				{"name": "ts", "type": "timestamp", "expression": "t", "timestamp": {"output": "epoch_ms"}},
+				{"name": "ratio", "type": "int", "expression": "r"}],
+				"extraProcess": [{"func": "__stringConstant", "args": "high", "to": "severity"}]}`,
+		},
+		{
+			name: "Incompatible rule",
+			cfg: `{"unifier": [{"name": "port", "type": "string", "expression": "p"},
+				{"name": "ts", "type": "timestamp", "expression": "t"},
+				{"name": "extra", "type": "string", "expression": "e"}],
+				"extraProcess": [{"func": "__stringConstant", "args": "x", "to": "custom"}]}`,
+			want: []FieldError{
+				{Pointer: "/unifier/0/type", Message: "field port has type string, topic typed schema expects integer"},
+				{Pointer: "/unifier/1/type", Message: "field ts has type string, topic typed schema expects integer, null"},
+				{Pointer: "/unifier/2/name", Message: "field extra is not allowed by topic typed schema"},
+				{Pointer: "/extraProcess/0/to", Message: "field custom is not allowed by topic typed schema"},
+				{Pointer: "/topicTo", Message: "field severity required by topic typed schema is not produced"},
+			},
+		},
+		{
+			name: "Meta field in closed schema",
+			cfg: `{"unifier": [{"name": "port", "type": "int", "expression": "p"}],
+				"extraProcess": [{"func": "__stringConstant", "args": "high", "to": "severity"}],
+				"envelope": {"meta": "field"}}`,
+			want: []FieldError{{Pointer: "/envelope/meta", Message: "field _meta is not allowed by topic typed schema"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := CompileRule(parseConfig(t, tt.cfg))
+			assert.NoError(t, err)
+
+			err = c.CheckRule(rule)
+			if tt.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			var ve *ValidationError
+			assert.ErrorAs(t, err, &ve)
+			assert.Equal(t, tt.want, ve.Errors)
+		})
+	}
+}
+
+func TestContract_CheckRules(t *testing.T) {
+	c := testContract(t, "")
+
+	compatible := parseConfig(t, `{"topicTo": "typed", "unifier": [{"name": "port", "type": "int", "expression": "p"}],
+		"extraProcess": [{"func": "__stringConstant", "args": "high", "to": "severity"}]}`)
+	incompatible := parseConfig(t, `{"topicTo": "typed", "unifier": [{"name": "port", "type": "string", "expression": "p"}],
+		"extraProcess": [{"func": "__stringConstant", "args": "high", "to": "severity"}]}`)
+	other := incompatible
+	other.TopicTo = "other"
+
+	err := c.CheckRules([]models.Rule{
+		{ID: 1, Rule: compatible},
+		{ID: 2, Rule: incompatible},
+		{ID: 3, Rule: other},
+	})
+
+	var ve *ValidationError
+	assert.ErrorAs(t, err, &ve)
+	assert.Equal(t, []FieldError{
+		{Pointer: "/rules/2/unifier/0/type", Message: "field port has type string, topic typed schema expects integer"},
+	}, ve.Errors)
+
+	assert.NoError(t, c.CheckRules([]models.Rule{{ID: 1, Rule: compatible}, {ID: 3, Rule: other}}))
+}
+
+func TestContract_Validate(t *testing.T) {
+	c := testContract(t, "")
+
+	assert.NoError(t, c.Validate(map[string]interface{}{"entity": "x", "port": 22, "severity": "high", "ts": nil}))
+
+	err := c.Validate(map[string]interface{}{"entity": "x", "port": 0, "other": 1})
+	assert.ErrorIs(t, err, errContractViolation)
+	assert.ErrorContains(t, err, "topic typed")
+	assert.ErrorContains(t, err, "severity is required")
+	assert.ErrorContains(t, err, "port: Must be greater than or equal to 1")
+}
+
+func TestPool_CheckRule(t *testing.T) {
+	p := testPool(t)
+
+	rule, err := CompileRule(models.Config{TopicFrom: "events", TopicTo: "typed"})
+	assert.NoError(t, err)
+	assert.NoError(t, p.CheckRule(rule))
+
+	p.SetContract(testContract(t, ""))
+	assert.Error(t, p.CheckRule(rule))
+
+	p.DeleteContract("typed")
+	assert.NoError(t, p.CheckRule(rule))
+}
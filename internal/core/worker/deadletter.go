@@ -0,0 +1,64 @@
+package worker
+
+import (
+	"strconv"
+
+	"github.com/dedpnd/unifier/internal/models"
+	"github.com/segmentio/kafka-go"
+)
+
+// Политики обработки ошибок событий.
+const (
+	PolicySkip       = "skip"
+	PolicyDeadLetter = "deadLetter"
+	PolicyStop       = "stop"
+)
+
+// Заголовки сообщений в топике недоставленных событий.
+const (
+	HeaderError       = "unifier.error"
+	HeaderRuleID      = "unifier.rule_id"
+	HeaderSourceTopic = "unifier.source_topic"
+	HeaderPartition   = "unifier.partition"
+	HeaderOffset      = "unifier.offset"
+)
+
+// compileOnError проверяет политику и подставляет значения по умолчанию.
+func compileOnError(cfg *models.OnError, topicFrom string) (models.OnError, error) {
+	if cfg == nil {
+		return models.OnError{Policy: PolicySkip}, nil
+	}
+
+	oe := *cfg
+	switch oe.Policy {
+	case "":
+		oe.Policy = PolicySkip
+	case PolicySkip, PolicyStop:
+	case PolicyDeadLetter:
+		if oe.Topic == "" {
+			return oe, fieldError("/onError/topic", "is required for %v policy", PolicyDeadLetter)
+		}
+		if oe.Topic == topicFrom {
+			return oe, fieldError("/onError/topic", "must differ from topicFrom")
+		}
+	default:
+		return oe, fieldError("/onError/policy", "unknown policy: %v", oe.Policy)
+	}
+
+	return oe, nil
+}
+
+// deadLetterMessage формирует сообщение с исходным содержимым и причиной ошибки.
+func deadLetterMessage(ruleID string, msg kafka.Message, cause error) kafka.Message {
+	return kafka.Message{
+		Key:   msg.Key,
+		Value: msg.Value,
+		Headers: []kafka.Header{
+			{Key: HeaderError, Value: []byte(cause.Error())},
+			{Key: HeaderRuleID, Value: []byte(ruleID)},
+			{Key: HeaderSourceTopic, Value: []byte(msg.Topic)},
+			{Key: HeaderPartition, Value: []byte(strconv.Itoa(msg.Partition))},
+			{Key: HeaderOffset, Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+		},
+	}
+}
@@ -0,0 +1,68 @@
+package worker
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dedpnd/unifier/internal/models"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_compileOnError(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *models.OnError
+		want    string
+		wantErr bool
+	}{
+		{name: "Default policy is skip", cfg: nil, want: PolicySkip},
+		{name: "Empty policy is skip", cfg: &models.OnError{}, want: PolicySkip},
+		{name: "Stop policy", cfg: &models.OnError{Policy: PolicyStop}, want: PolicyStop},
+		{name: "Dead letter policy", cfg: &models.OnError{Policy: PolicyDeadLetter, Topic: "events.dlq"}, want: PolicyDeadLetter},
+		{name: "Dead letter without topic", cfg: &models.OnError{Policy: PolicyDeadLetter}, wantErr: true},
+		{name: "Dead letter to source topic", cfg: &models.OnError{Policy: PolicyDeadLetter, Topic: "events"}, wantErr: true},
+		{name: "Unknown policy", cfg: &models.OnError{Policy: "retry"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := compileOnError(tt.cfg, "events")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("compileOnError() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr {
+				assert.Equal(t, tt.want, got.Policy)
+			}
+		})
+	}
+}
+
+func Test_deadLetterMessage(t *testing.T) {
+	msg := kafka.Message{
+		Topic:     "events",
+		Partition: 3,
+		Offset:    42,
+		Key:       []byte("key"),
+		Value:     []byte(`{"broken":`),
+	}
+
+	got := deadLetterMessage("7", msg, errors.New("invalid JSON parse"))
+
+	assert.Equal(t, msg.Key, got.Key)
+	assert.Equal(t, msg.Value, got.Value)
+
+	headers := make(map[string]string)
+	for _, h := range got.Headers {
+		headers[h.Key] = string(h.Value)
+	}
+
+	assert.Equal(t, map[string]string{
+		HeaderError:       "invalid JSON parse",
+		HeaderRuleID:      "7",
+		HeaderSourceTopic: "events",
+		HeaderPartition:   "3",
+		HeaderOffset:      "42",
+	}, headers)
+}
@@ -0,0 +1,38 @@
+package worker
+
+// DryRunResult - результат пробной обработки события правилом.
+type DryRunResult struct {
+	// Matched - событие прошло фильтр
+	Matched bool `json:"matched"`
+	// Output - документ, который воркер записал бы в topicTo
+	Output map[string]interface{} `json:"output,omitempty"`
+	// Errors - ошибки разбора, преобразования полей и кодирования
+	Errors []string `json:"errors,omitempty"`
+}
+
+// DryRun обрабатывает событие так же, как воркер, но без Kafka. Ошибки,
+// которые воркер только логирует, возвращаются в результате.
+func (r *Rule) DryRun(raw []byte) DryRunResult {
+	res, err := r.Process(raw)
+	if err != nil {
+		return DryRunResult{Errors: []string{err.Error()}}
+	}
+
+	out := DryRunResult{
+		Matched: res.Matched,
+		Output:  res.Event,
+	}
+
+	for _, e := range res.Errors {
+		out.Errors = append(out.Errors, e.Error())
+	}
+
+	// Несоответствие схеме output воркер тоже считает ошибкой события
+	if res.Matched {
+		if _, err := r.Encode(res.Event); err != nil {
+			out.Errors = append(out.Errors, err.Error())
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,200 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/dedpnd/unifier/internal/models"
+	"github.com/segmentio/kafka-go"
+)
+
+// Способы записи метаданных обработки.
+const (
+	MetaField   = "field"
+	MetaHeaders = "headers"
+)
+
+// MetaKey - поле унифицированного события с метаданными обработки.
+const MetaKey = "_meta"
+
+// Заголовки метаданных в дополнение к заголовкам недоставленных событий.
+const (
+	HeaderRuleVersion     = "unifier.rule_version"
+	HeaderSourceTimestamp = "unifier.source_timestamp"
+	HeaderProcessedAt     = "unifier.processed_at"
+)
+
+// envelope - проверенная секция envelope правила.
+type envelope struct {
+	key     Path
+	copyAll bool
+	copy    map[string]bool
+	// Заголовки с постоянными значениями, по порядку имен
+	headers []kafka.Header
+	meta    string
+}
+
+// compileEnvelope проверяет секцию envelope. По умолчанию ключом сообщения
+// становится поле entity. Блок _meta добавляется только в вывод JSON: схемы
+// avro и protobuf не допускают полей, которых в них нет.
+func compileEnvelope(cfg *models.Envelope, output *models.Output) (envelope, error) {
+	key, _ := ParsePath("entity")
+	e := envelope{key: key}
+	if cfg == nil {
+		return e, nil
+	}
+
+	ve := &ValidationError{}
+
+	if cfg.Key != "" {
+		p, err := ParsePath(cfg.Key)
+		switch {
+		case err != nil:
+			ve.add("/envelope/key", "%v", err)
+		case p.Multi():
+			ve.add("/envelope/key", "must select a single value")
+		default:
+			e.key = p
+		}
+	}
+
+	for i, name := range cfg.CopyHeaders {
+		switch name {
+		case "":
+			ve.add(fmt.Sprintf("/envelope/copyHeaders/%d", i), "is required")
+		case "*":
+			e.copyAll = true
+		default:
+			if e.copy == nil {
+				e.copy = make(map[string]bool)
+			}
+			e.copy[name] = true
+		}
+	}
+
+	names := make([]string, 0, len(cfg.Headers))
+	for name := range cfg.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if name == "" {
+			ve.add("/envelope/headers", "header name is required")
+			continue
+		}
+		e.headers = append(e.headers, kafka.Header{Key: name, Value: []byte(cfg.Headers[name])})
+	}
+
+	switch cfg.Meta {
+	case MetaField:
+		if output != nil && output.Format != "" && output.Format != OutputJSON {
+			ve.add("/envelope/meta", "%v is allowed only for %v output, use %v", MetaField, OutputJSON, MetaHeaders)
+		}
+		e.meta = cfg.Meta
+	case "", MetaHeaders:
+		e.meta = cfg.Meta
+	default:
+		ve.add("/envelope/meta", "unknown meta: %v", cfg.Meta)
+	}
+
+	return e, ve.err()
+}
+
+// sourceMeta - метаданные, по которым результат связывается с исходным событием.
+type sourceMeta struct {
+	ruleID      string
+	ruleVersion int
+	src         kafka.Message
+	processedAt time.Time
+}
+
+// fields возвращает метаданные для блока _meta.
+func (m sourceMeta) fields() map[string]interface{} {
+	f := map[string]interface{}{
+		"ruleId":          m.ruleID,
+		"ruleVersion":     m.ruleVersion,
+		"sourceTopic":     m.src.Topic,
+		"sourcePartition": m.src.Partition,
+		"sourceOffset":    m.src.Offset,
+		"processedAt":     m.processedAt.UTC().Format(time.RFC3339Nano),
+	}
+	if !m.src.Time.IsZero() {
+		f["sourceTimestamp"] = m.src.Time.UTC().Format(time.RFC3339Nano)
+	}
+
+	return f
+}
+
+// headers возвращает метаданные в виде заголовков.
+func (m sourceMeta) headers() []kafka.Header {
+	h := []kafka.Header{
+		{Key: HeaderRuleID, Value: []byte(m.ruleID)},
+		{Key: HeaderRuleVersion, Value: []byte(strconv.Itoa(m.ruleVersion))},
+		{Key: HeaderSourceTopic, Value: []byte(m.src.Topic)},
+		{Key: HeaderPartition, Value: []byte(strconv.Itoa(m.src.Partition))},
+		{Key: HeaderOffset, Value: []byte(strconv.FormatInt(m.src.Offset, 10))},
+	}
+	if !m.src.Time.IsZero() {
+		h = append(h, kafka.Header{Key: HeaderSourceTimestamp, Value: []byte(m.src.Time.UTC().Format(time.RFC3339Nano))})
+	}
+
+	return append(h, kafka.Header{Key: HeaderProcessedAt, Value: []byte(m.processedAt.UTC().Format(time.RFC3339Nano))})
+}
+
+// message формирует сообщение topicTo: ключ из поля события, скопированные
+// и постоянные заголовки и, если задано, заголовки метаданных.
+func (e envelope) message(event map[string]interface{}, value []byte, meta sourceMeta) kafka.Message {
+	msg := kafka.Message{Value: value}
+
+	if v, ok := e.key.Get(event); ok {
+		msg.Key = keyBytes(v)
+	}
+
+	if e.copyAll || len(e.copy) != 0 {
+		for _, h := range meta.src.Headers {
+			if (e.copyAll || e.copy[h.Key]) && !e.sets(h.Key) {
+				msg.Headers = append(msg.Headers, h)
+			}
+		}
+	}
+	msg.Headers = append(msg.Headers, e.headers...)
+
+	if e.meta == MetaHeaders {
+		msg.Headers = append(msg.Headers, meta.headers()...)
+	}
+
+	return msg
+}
+
+// sets сообщает, что заголовок задан постоянным значением.
+func (e envelope) sets(name string) bool {
+	for _, h := range e.headers {
+		if h.Key == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// keyBytes приводит значение поля к ключу сообщения. Строка используется
+// как есть, остальные значения - в виде JSON.
+func keyBytes(v interface{}) []byte {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return []byte(v)
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+
+	return b
+}
@@ -0,0 +1,159 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/dedpnd/unifier/internal/models"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_compileEnvelope(t *testing.T) {
+	_, err := compileEnvelope(&models.Envelope{
+		Key:         "items[*].id",
+		CopyHeaders: []string{"trace", ""},
+		Headers:     map[string]string{"": "x"},
+		Meta:        "body",
+	}, nil)
+
+	var ve *ValidationError
+	assert.ErrorAs(t, err, &ve)
+	assert.Equal(t, []FieldError{
+		{Pointer: "/envelope/key", Message: "must select a single value"},
+		{Pointer: "/envelope/copyHeaders/1", Message: "is required"},
+		{Pointer: "/envelope/headers", Message: "header name is required"},
+		{Pointer: "/envelope/meta", Message: "unknown meta: body"},
+	}, ve.Errors)
+
+	t.Run("Meta field with avro output", func(t *testing.T) {
+		_, err := compileEnvelope(&models.Envelope{Meta: MetaField}, &models.Output{Format: OutputAvro})
+
+		var ve *ValidationError
+		assert.ErrorAs(t, err, &ve)
+		assert.Equal(t, []FieldError{
+			{Pointer: "/envelope/meta", Message: "field is allowed only for json output, use headers"},
+		}, ve.Errors)
+
+		_, err = compileEnvelope(&models.Envelope{Meta: MetaHeaders}, &models.Output{Format: OutputAvro})
+		assert.NoError(t, err)
+	})
+}
+
+// testRunner возвращает runner, который запоминает записанные сообщения.
+func testRunner(t *testing.T, cfg models.Config) (*runner, *[]kafka.Message) {
+	t.Helper()
+
+	rule, err := CompileRule(cfg)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	rule.SetVersion(3)
+
+	wrk := &workerEntity{ID: "7", state: newWorkerState(), stats: newWorkerStats()}
+	wrk.rule.Store(rule)
+
+	var sent []kafka.Message
+	return &runner{
+		wrk:  wrk,
+		lg:   zap.NewNop(),
+		wCtx: context.Background(),
+		emit: func(msg kafka.Message) error {
+			sent = append(sent, msg)
+			return nil
+		},
+	}, &sent
+}
+
+func TestRunner_Envelope(t *testing.T) {
+	src := kafka.Message{
+		Topic:     "events",
+		Partition: 2,
+		Offset:    42,
+		Time:      time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Value:     []byte(`{"user": "root", "port": 22}`),
+		Headers: []kafka.Header{
+			{Key: "trace", Value: []byte("abc")},
+			{Key: "source", Value: []byte("raw")},
+			{Key: "internal", Value: []byte("1")},
+		},
+	}
+	unifier := []models.Unifier{{Name: "user", Type: "string", Expression: "user"}, {Name: "port", Type: "int", Expression: "port"}}
+
+	t.Run("Default key", func(t *testing.T) {
+		w, sent := testRunner(t, models.Config{EntityHash: []string{"user"}, Unifier: unifier})
+		assert.NoError(t, w.handle(src))
+
+		assert.Len(t, *sent, 1)
+		msg := (*sent)[0]
+
+		var doc map[string]interface{}
+		assert.NoError(t, json.Unmarshal(msg.Value, &doc))
+		assert.Equal(t, doc["entity"], string(msg.Key))
+		assert.Empty(t, msg.Headers)
+		assert.NotContains(t, doc, MetaKey)
+	})
+
+	t.Run("Meta field", func(t *testing.T) {
+		w, sent := testRunner(t, models.Config{Unifier: unifier, Envelope: &models.Envelope{
+			Key:         "port",
+			CopyHeaders: []string{"trace", "source"},
+			Headers:     map[string]string{"source": "unifier"},
+			Meta:        MetaField,
+		}})
+		assert.NoError(t, w.handle(src))
+
+		msg := (*sent)[0]
+		assert.Equal(t, []byte("22"), msg.Key)
+		assert.Equal(t, []kafka.Header{
+			{Key: "trace", Value: []byte("abc")},
+			{Key: "source", Value: []byte("unifier")},
+		}, msg.Headers)
+
+		var doc struct {
+			Meta map[string]interface{} `json:"_meta"`
+		}
+		assert.NoError(t, json.Unmarshal(msg.Value, &doc))
+		assert.NotEmpty(t, doc.Meta["processedAt"])
+		delete(doc.Meta, "processedAt")
+		assert.Equal(t, map[string]interface{}{
+			"ruleId":          "7",
+			"ruleVersion":     float64(3),
+			"sourceTopic":     "events",
+			"sourcePartition": float64(2),
+			"sourceOffset":    float64(42),
+			"sourceTimestamp": "2024-01-02T03:04:05Z",
+		}, doc.Meta)
+	})
+
+	t.Run("Meta headers", func(t *testing.T) {
+		w, sent := testRunner(t, models.Config{Unifier: unifier, Envelope: &models.Envelope{
+			CopyHeaders: []string{"*"},
+			Meta:        MetaHeaders,
+		}})
+		assert.NoError(t, w.handle(src))
+
+		msg := (*sent)[0]
+		headers := make(map[string]string)
+		for _, h := range msg.Headers {
+			headers[h.Key] = string(h.Value)
+		}
+		assert.NotEmpty(t, headers[HeaderProcessedAt])
+		delete(headers, HeaderProcessedAt)
+		assert.Equal(t, map[string]string{
+			"trace":               "abc",
+			"source":              "raw",
+			"internal":            "1",
+			HeaderRuleID:          "7",
+			HeaderRuleVersion:     "3",
+			HeaderSourceTopic:     "events",
+			HeaderPartition:       "2",
+			HeaderOffset:          "42",
+			HeaderSourceTimestamp: "2024-01-02T03:04:05Z",
+		}, headers)
+		assert.NotContains(t, string(msg.Value), MetaKey)
+	})
+}
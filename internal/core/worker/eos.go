@@ -0,0 +1,230 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"go.uber.org/zap"
+)
+
+// Гарантии доставки результата в topicTo.
+const (
+	DeliveryAtLeastOnce = "at_least_once"
+	DeliveryExactlyOnce = "exactly_once"
+)
+
+// compileDelivery проверяет гарантию доставки и подставляет значение по умолчанию.
+func compileDelivery(delivery string) (string, error) {
+	switch delivery {
+	case "":
+		return DeliveryAtLeastOnce, nil
+	case DeliveryAtLeastOnce, DeliveryExactlyOnce:
+		return delivery, nil
+	}
+
+	return delivery, fieldError("/delivery", "unknown delivery: %v", delivery)
+}
+
+// transactionalID возвращает идентификатор транзакций правила. Новый воркер
+// с тем же идентификатором отстраняет предыдущий, даже если тот еще работает.
+func transactionalID(ruleID string) string {
+	return "unifier-rule-" + ruleID
+}
+
+// txnSink записывает сообщения в открытую транзакцию. Запись асинхронная,
+// первая ошибка сохраняется и проверяется перед подтверждением транзакции.
+type txnSink struct {
+	sess *kgo.GroupTransactSession
+	ctx  context.Context
+	// results - число результатов в текущей транзакции, учитываются после ее подтверждения
+	results atomic.Int64
+
+	mu  sync.Mutex
+	err error
+}
+
+func (s *txnSink) produce(topic string) func(kafka.Message) error {
+	return func(msg kafka.Message) error {
+		s.sess.Produce(s.ctx, messageRecord(topic, msg), func(_ *kgo.Record, err error) {
+			if err == nil {
+				return
+			}
+
+			s.mu.Lock()
+			if s.err == nil {
+				s.err = err
+			}
+			s.mu.Unlock()
+		})
+
+		return nil
+	}
+}
+
+// reset сбрасывает ошибку записи перед новой транзакцией.
+func (s *txnSink) reset() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.err
+	s.err = nil
+
+	return err
+}
+
+// startTransactional работает как Start, но читает, обрабатывает и пишет
+// пачку сообщений в одной транзакции kafka, вместе со смещениями consumer group.
+// Читаются только подтвержденные транзакции, поэтому после сбоя или перезапуска
+// результат в topicTo и топике недоставленных событий не дублируется.
+// Ошибка записи в транзакции не обрабатывается политикой onError: транзакция
+// отменяется, а воркер перезапускается и обрабатывает пачку заново.
+func startTransactional(ctx context.Context, kafkaURL string, wrkConfig *workerEntity,
+	lg *zap.Logger) error {
+	rule := wrkConfig.rule.Load()
+	cfg := rule.Config()
+	onError := rule.OnError()
+
+	opts := append([]kgo.Opt{
+		kgo.SeedBrokers(kafkaURL),
+		kgo.TransactionalID(transactionalID(wrkConfig.ID)),
+		kgo.ConsumerGroup(wrkConfig.ID),
+		kgo.ConsumeTopics(cfg.TopicFrom),
+		kgo.FetchIsolationLevel(kgo.ReadCommitted()),
+		kgo.RequireStableFetchOffsets(),
+	}, rule.producer.kgoOpts()...)
+
+	sess, err := kgo.NewGroupTransactSession(opts...)
+	if err != nil {
+		return fmt.Errorf("worker:%v - failed create transactional session: %w", wrkConfig.ID, err)
+	}
+	defer sess.Close()
+
+	wCtx, stopWrite := writeContext(ctx)
+	defer stopWrite()
+
+	w := &runner{
+		wrk:  wrkConfig,
+		lg:   lg,
+		wCtx: wCtx,
+	}
+
+	tx := &txnSink{sess: sess, ctx: w.wCtx}
+	produce := tx.produce(cfg.TopicTo)
+	w.emit = func(msg kafka.Message) error {
+		if err := produce(msg); err != nil {
+			return err
+		}
+
+		tx.results.Add(1)
+		return nil
+	}
+	if onError.Policy == PolicyDeadLetter {
+		w.deadLetter = tx.produce(onError.Topic)
+	}
+
+	for {
+		fetches := sess.PollFetches(ctx)
+		if ctx.Err() != nil || fetches.IsClientClosed() {
+			lg.Info("Worker stop", zap.String("ID", wrkConfig.ID))
+			return nil
+		}
+		if err := fetches.Err(); err != nil {
+			return fmt.Errorf("worker:%v - failed read message: %w", wrkConfig.ID, err)
+		}
+
+		if err := w.transact(sess, tx, fetches); err != nil {
+			return err
+		}
+	}
+}
+
+// transact обрабатывает пачку сообщений в одной транзакции. Ошибка означает,
+// что транзакция отменена и воркер нужно остановить.
+func (w *runner) transact(sess *kgo.GroupTransactSession, tx *txnSink, fetches kgo.Fetches) error {
+	id := w.wrk.ID
+
+	if err := sess.Begin(); err != nil {
+		return fmt.Errorf("worker:%v - failed begin transaction: %w", id, err)
+	}
+	_ = tx.reset()
+	tx.results.Store(0)
+
+	var msgs []kafka.Message
+	fetches.EachPartition(func(p kgo.FetchTopicPartition) {
+		for _, r := range p.Records {
+			msgs = append(msgs, recordMessage(r, p.HighWatermark))
+		}
+	})
+
+	hErr := w.wrk.rule.Load().lanes.each(msgs, w.handle)
+
+	if hErr == nil {
+		// Дожидаемся записи всех сообщений, чтобы не подтвердить транзакцию с потерями
+		if err := sess.Client().Flush(w.wCtx); err != nil {
+			hErr = fmt.Errorf("worker:%v - failed flush transaction: %w", id, err)
+		} else if err := tx.reset(); err != nil {
+			hErr = fmt.Errorf("worker:%v - failed to write messages: %w", id, err)
+		}
+	}
+
+	if hErr != nil {
+		if _, err := sess.End(w.wCtx, kgo.TryAbort); err != nil {
+			hErr = errors.Join(hErr, fmt.Errorf("failed abort transaction: %w", err))
+		}
+		return hErr
+	}
+
+	committed, err := sess.End(w.wCtx, kgo.TryCommit)
+	if err != nil {
+		return fmt.Errorf("worker:%v - failed commit transaction: %w", id, err)
+	}
+
+	// Транзакция отменяется при перебалансировке группы, сообщения будут прочитаны снова
+	if !committed {
+		w.lg.Warn("Transaction aborted", zap.String("ID", id))
+		return nil
+	}
+	w.emitted(tx.results.Load())
+
+	return nil
+}
+
+// recordMessage приводит запись franz-go к сообщению, которое обрабатывает воркер.
+func recordMessage(r *kgo.Record, highWaterMark int64) kafka.Message {
+	msg := kafka.Message{
+		Topic:         r.Topic,
+		Partition:     int(r.Partition),
+		Offset:        r.Offset,
+		HighWaterMark: highWaterMark,
+		Key:           r.Key,
+		Value:         r.Value,
+		Time:          r.Timestamp,
+	}
+
+	for _, h := range r.Headers {
+		msg.Headers = append(msg.Headers, kafka.Header{Key: h.Key, Value: h.Value})
+	}
+
+	return msg
+}
+
+// messageRecord приводит исходящее сообщение к записи franz-go.
+func messageRecord(topic string, msg kafka.Message) *kgo.Record {
+	r := &kgo.Record{
+		Topic: topic,
+		Key:   msg.Key,
+		Value: msg.Value,
+	}
+
+	for _, h := range msg.Headers {
+		r.Headers = append(r.Headers, kgo.RecordHeader{Key: h.Key, Value: h.Value})
+	}
+	markResult(r, msg)
+
+	return r
+}
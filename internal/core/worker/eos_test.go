@@ -0,0 +1,200 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dedpnd/unifier/internal/models"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+	"github.com/stretchr/testify/assert"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+	"go.uber.org/zap"
+)
+
+const testBrokerPort = "29092"
+
+// kafkaBroker запускает однонодовую kafka в контейнере и возвращает адрес брокера.
+// Тест пропускается, если docker недоступен.
+func kafkaBroker(t *testing.T) string {
+	t.Helper()
+
+	pool, err := dockertest.NewPool("")
+	if err != nil || pool.Client.Ping() != nil {
+		t.Skip("docker is not available")
+	}
+
+	resource, err := pool.RunWithOptions(&dockertest.RunOptions{
+		Repository: "apache/kafka",
+		Tag:        "3.7.0",
+		Env: []string{
+			"KAFKA_NODE_ID=1",
+			"KAFKA_PROCESS_ROLES=broker,controller",
+			"KAFKA_LISTENERS=PLAINTEXT://:9092,CONTROLLER://:9093",
+			"KAFKA_ADVERTISED_LISTENERS=PLAINTEXT://localhost:" + testBrokerPort,
+			"KAFKA_CONTROLLER_LISTENER_NAMES=CONTROLLER",
+			"KAFKA_LISTENER_SECURITY_PROTOCOL_MAP=CONTROLLER:PLAINTEXT,PLAINTEXT:PLAINTEXT",
+			"KAFKA_CONTROLLER_QUORUM_VOTERS=1@localhost:9093",
+			"KAFKA_OFFSETS_TOPIC_REPLICATION_FACTOR=1",
+			"KAFKA_TRANSACTION_STATE_LOG_REPLICATION_FACTOR=1",
+			"KAFKA_TRANSACTION_STATE_LOG_MIN_ISR=1",
+			"KAFKA_GROUP_INITIAL_REBALANCE_DELAY_MS=0",
+		},
+		PortBindings: map[docker.Port][]docker.PortBinding{
+			"9092/tcp": {{HostIP: "localhost", HostPort: testBrokerPort}},
+		},
+	}, func(config *docker.HostConfig) {
+		config.AutoRemove = true
+		config.RestartPolicy = docker.RestartPolicy{Name: "no"}
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() {
+		_ = pool.Purge(resource)
+	})
+	_ = resource.Expire(120)
+
+	addr := "localhost:" + testBrokerPort
+
+	pool.MaxWait = time.Minute
+	err = pool.Retry(func() error {
+		cl, err := kgo.NewClient(kgo.SeedBrokers(addr))
+		if err != nil {
+			return err
+		}
+		defer cl.Close()
+
+		return cl.Ping(context.Background())
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	return addr
+}
+
+func createTopics(t *testing.T, cl *kgo.Client, partitions int32, topics ...string) {
+	t.Helper()
+
+	req := kmsg.NewPtrCreateTopicsRequest()
+	for _, topic := range topics {
+		rt := kmsg.NewCreateTopicsRequestTopic()
+		rt.Topic = topic
+		rt.NumPartitions = partitions
+		rt.ReplicationFactor = 1
+		req.Topics = append(req.Topics, rt)
+	}
+
+	resp, err := req.RequestWith(context.Background(), cl)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	for _, rt := range resp.Topics {
+		assert.NoError(t, kerr.ErrorForCode(rt.ErrorCode), rt.Topic)
+	}
+}
+
+// readCommitted читает из начала топика подтвержденные сообщения, пока их не станет want.
+func readCommitted(t *testing.T, addr, topic string, want int) []string {
+	t.Helper()
+
+	var values []string
+	for _, r := range readRecords(t, addr, topic, want) {
+		values = append(values, string(r.Value))
+	}
+
+	return values
+}
+
+func readRecords(t *testing.T, addr, topic string, want int) []*kgo.Record {
+	t.Helper()
+
+	cl, err := kgo.NewClient(
+		kgo.SeedBrokers(addr),
+		kgo.ConsumeTopics(topic),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+		kgo.FetchIsolationLevel(kgo.ReadCommitted()),
+	)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer cl.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var records []*kgo.Record
+	for len(records) < want && ctx.Err() == nil {
+		records = append(records, cl.PollFetches(ctx).Records()...)
+	}
+
+	return records
+}
+
+func TestStart_ExactlyOnce(t *testing.T) {
+	addr := kafkaBroker(t)
+
+	cl, err := kgo.NewClient(kgo.SeedBrokers(addr))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer cl.Close()
+
+	createTopics(t, cl, 1, "eos-in", "eos-out", "eos-dlq")
+
+	rule, err := CompileRule(models.Config{
+		TopicFrom: "eos-in",
+		TopicTo:   "eos-out",
+		Unifier:   []models.Unifier{{Name: "port", Type: "int", Expression: "port"}},
+		OnError:   &models.OnError{Policy: PolicyDeadLetter, Topic: "eos-dlq"},
+		Delivery:  DeliveryExactlyOnce,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	wrk := &workerEntity{ID: "eos", state: newWorkerState(), stats: newWorkerStats()}
+	wrk.rule.Store(rule)
+
+	// run пишет события в topicFrom и запускает воркер, пока в topicTo не будет want сообщений
+	run := func(want int, events ...string) []string {
+		for _, e := range events {
+			assert.NoError(t, cl.ProduceSync(context.Background(), &kgo.Record{Topic: "eos-in", Value: []byte(e)}).FirstErr())
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() {
+			done <- Start(ctx, addr, DefaultCommit, wrk, zap.NewNop())
+		}()
+
+		values := readCommitted(t, addr, "eos-out", want)
+		cancel()
+		assert.NoError(t, <-done)
+
+		return values
+	}
+
+	event := func(port int) string {
+		return fmt.Sprintf(`{"port": %d}`, port)
+	}
+	// Хэш пустого списка полей entityHash
+	result := func(port int) string {
+		return fmt.Sprintf(`{"entity":"d41d8cd98f00b204e9800998ecf8427e","port":%d}`, port)
+	}
+
+	assert.Equal(t, []string{result(1), result(2)}, run(2, event(1), "{", event(2)))
+
+	// После перезапуска обработка продолжается с подтвержденного в транзакции смещения
+	assert.Equal(t, []string{result(1), result(2), result(3)}, run(3, event(3)))
+
+	assert.Equal(t, []string{"{"}, readCommitted(t, addr, "eos-dlq", 1))
+
+	// Учитываются только результаты подтвержденных транзакций
+	assert.Equal(t, int64(3), wrk.stats.emitted.Load())
+}
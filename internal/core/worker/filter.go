@@ -0,0 +1,290 @@
+package worker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+
+	"github.com/dedpnd/unifier/internal/models"
+)
+
+var errFilterNoField = errors.New("filter operators require field")
+
+// filterNode - скомпилированный узел фильтра.
+type filterNode struct {
+	raw *regexp.Regexp
+
+	and []*filterNode
+	or  []*filterNode
+	not *filterNode
+
+	field  *Path
+	eq     interface{}
+	in     []interface{}
+	exists *bool
+	gt     *float64
+	gte    *float64
+	lt     *float64
+	lte    *float64
+	cidr   *net.IPNet
+	match  *regexp.Regexp
+}
+
+// compileFilter проверяет фильтр и подготавливает его к применению.
+func compileFilter(f models.Filter) (*filterNode, error) {
+	ve := &ValidationError{}
+	n := compileFilterNode(f, "/filter", ve)
+
+	return n, ve.err()
+}
+
+func compileFilterNode(f models.Filter, ptr string, ve *ValidationError) *filterNode {
+	n := &filterNode{
+		eq:     f.Eq,
+		in:     f.In,
+		exists: f.Exists,
+		gt:     f.Gt,
+		gte:    f.Gte,
+		lt:     f.Lt,
+		lte:    f.Lte,
+	}
+
+	if f.Regexp != "" {
+		re, err := regexp.Compile(f.Regexp)
+		if err != nil {
+			ve.add(ptr+"/regexp", "invalid regexp: %v", err)
+		}
+		n.raw = re
+	}
+
+	for i, sub := range f.And {
+		n.and = append(n.and, compileFilterNode(sub, fmt.Sprintf("%v/and/%d", ptr, i), ve))
+	}
+
+	for i, sub := range f.Or {
+		n.or = append(n.or, compileFilterNode(sub, fmt.Sprintf("%v/or/%d", ptr, i), ve))
+	}
+
+	if f.Not != nil {
+		n.not = compileFilterNode(*f.Not, ptr+"/not", ve)
+	}
+
+	if f.Field == "" {
+		if hasFieldOps(f) {
+			ve.add(ptr+"/field", "%v", errFilterNoField)
+		}
+		return n
+	}
+
+	path, err := ParsePath(f.Field)
+	if err != nil {
+		ve.add(ptr+"/field", "%v", err)
+	}
+	n.field = &path
+
+	if f.CIDR != "" {
+		_, ipNet, err := net.ParseCIDR(f.CIDR)
+		if err != nil {
+			ve.add(ptr+"/cidr", "invalid cidr: %v", err)
+		}
+		n.cidr = ipNet
+	}
+
+	if f.Match != "" {
+		re, err := regexp.Compile(f.Match)
+		if err != nil {
+			ve.add(ptr+"/match", "invalid match: %v", err)
+		}
+		n.match = re
+	}
+
+	return n
+}
+
+func hasFieldOps(f models.Filter) bool {
+	return f.Eq != nil || f.In != nil || f.Exists != nil ||
+		f.Gt != nil || f.Gte != nil || f.Lt != nil || f.Lte != nil ||
+		f.CIDR != "" || f.Match != ""
+}
+
+// Match проверяет событие по фильтру. Устаревший regexp применяется
+// к исходному сообщению, остальные операторы - к разобранному событию.
+func (n *filterNode) Match(raw []byte, event map[string]interface{}) bool {
+	if n.raw != nil && !n.raw.Match(raw) {
+		return false
+	}
+
+	for _, sub := range n.and {
+		if !sub.Match(raw, event) {
+			return false
+		}
+	}
+
+	if len(n.or) != 0 {
+		found := false
+		for _, sub := range n.or {
+			if sub.Match(raw, event) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if n.not != nil && n.not.Match(raw, event) {
+		return false
+	}
+
+	return n.matchField(event)
+}
+
+func (n *filterNode) matchField(event map[string]interface{}) bool {
+	if n.field == nil {
+		return true
+	}
+
+	v, found := n.field.Get(event)
+
+	if n.exists != nil && *n.exists != found {
+		return false
+	}
+
+	// Поле без операторов проверяет только наличие
+	if !found {
+		return n.exists != nil && !*n.exists
+	}
+
+	// Для путей с подстановкой достаточно совпадения одного из значений
+	values := []interface{}{v}
+	if n.field.Multi() {
+		values, _ = v.([]interface{})
+	}
+
+	for _, val := range values {
+		if n.matchValue(val) {
+			return true
+		}
+	}
+
+	return false
+}
+
+//nolint:gocyclo // Перечень операторов
+func (n *filterNode) matchValue(v interface{}) bool {
+	if n.eq != nil && !equalValues(v, n.eq) {
+		return false
+	}
+
+	if n.in != nil {
+		in := false
+		for _, e := range n.in {
+			if equalValues(v, e) {
+				in = true
+				break
+			}
+		}
+		if !in {
+			return false
+		}
+	}
+
+	if n.gt != nil || n.gte != nil || n.lt != nil || n.lte != nil {
+		f, ok := toFloat(v)
+		if !ok {
+			return false
+		}
+		if (n.gt != nil && !(f > *n.gt)) || (n.gte != nil && !(f >= *n.gte)) ||
+			(n.lt != nil && !(f < *n.lt)) || (n.lte != nil && !(f <= *n.lte)) {
+			return false
+		}
+	}
+
+	if n.cidr != nil {
+		s, _ := v.(string)
+		ip := net.ParseIP(s)
+		if ip == nil || !n.cidr.Contains(ip) {
+			return false
+		}
+	}
+
+	if n.match != nil {
+		s, ok := scalarString(v)
+		if !ok || !n.match.MatchString(s) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// equalValues сравнивает значения события и фильтра. Если одно из значений
+// число, они сравниваются численно, в том числе записанные строкой. Строки
+// между собой сравниваются точно: "00123" и "123" различаются.
+func equalValues(a, b interface{}) bool {
+	if isNumber(a) || isNumber(b) {
+		if na, ok := toFloat(a); ok {
+			if nb, ok := toFloat(b); ok {
+				return na == nb
+			}
+		}
+	}
+
+	sa, ok := scalarString(a)
+	if !ok {
+		return false
+	}
+	sb, ok := scalarString(b)
+	if !ok {
+		return false
+	}
+
+	return sa == sb
+}
+
+func isNumber(v interface{}) bool {
+	switch v.(type) {
+	case float64, json.Number, int:
+		return true
+	default:
+		return false
+	}
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case int:
+		return float64(n), true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func scalarString(v interface{}) (string, bool) {
+	switch s := v.(type) {
+	case string:
+		return s, true
+	case json.Number:
+		return s.String(), true
+	case float64:
+		return strconv.FormatFloat(s, 'f', -1, 64), true
+	case int:
+		return strconv.Itoa(s), true
+	case bool:
+		return strconv.FormatBool(s), true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,77 @@
+package worker
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/dedpnd/unifier/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_filterNode_Match(t *testing.T) {
+	raw := []byte(`{"dstHost.ip": "10.10.10.10", "dstHost.port": "443", "cat": "/Host/Connect/Host/Accept",` +
+		` "severity": 7, "protoTr": "tcp", "tags": ["vpn", "fw"]}`)
+
+	var event map[string]interface{}
+	if err := json.Unmarshal(raw, &event); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		filter  string
+		want    bool
+		wantErr bool
+	}{
+		{name: "Empty filter", filter: `{}`, want: true},
+		{name: "Legacy regexp", filter: `{"regexp": "\"dstHost.ip\": \"10.10.10.10\""}`, want: true},
+		{name: "Legacy regexp not matched", filter: `{"regexp": "192\\.168"}`, want: false},
+		{name: "Eq string", filter: `{"field": "protoTr", "eq": "tcp"}`, want: true},
+		{name: "Eq number as string", filter: `{"field": "dstHost.port", "eq": 443}`, want: true},
+		{name: "Eq not matched", filter: `{"field": "protoTr", "eq": "udp"}`, want: false},
+		{name: "Eq strings compared exactly", filter: `{"field": "dstHost.port", "eq": "0443"}`, want: false},
+		{name: "Eq number with string", filter: `{"field": "severity", "eq": "7.0"}`, want: true},
+		{name: "In strings compared exactly", filter: `{"field": "dstHost.port", "in": ["443.0", "4.43e2"]}`, want: false},
+		{name: "In", filter: `{"field": "protoTr", "in": ["udp", "tcp"]}`, want: true},
+		{name: "In not matched", filter: `{"field": "protoTr", "in": ["udp", "icmp"]}`, want: false},
+		{name: "Exists", filter: `{"field": "cat", "exists": true}`, want: true},
+		{name: "Not exists", filter: `{"field": "srcUser.name", "exists": false}`, want: true},
+		{name: "Field without operators", filter: `{"field": "srcUser.name"}`, want: false},
+		{name: "Range", filter: `{"field": "severity", "gte": 5, "lt": 8}`, want: true},
+		{name: "Range not matched", filter: `{"field": "severity", "gt": 7}`, want: false},
+		{name: "Range on string number", filter: `{"field": "dstHost.port", "lte": 1024}`, want: true},
+		{name: "CIDR", filter: `{"field": "dstHost.ip", "cidr": "10.0.0.0/8"}`, want: true},
+		{name: "CIDR not matched", filter: `{"field": "dstHost.ip", "cidr": "192.168.0.0/16"}`, want: false},
+		{name: "Match", filter: `{"field": "cat", "match": "^/Host/Connect"}`, want: true},
+		{name: "Wildcard any of", filter: `{"field": "tags[*]", "eq": "fw"}`, want: true},
+		{
+			name:   "And / Or / Not",
+			filter: `{"and": [{"field": "protoTr", "eq": "tcp"}, {"or": [{"field": "severity", "gt": 9}, {"field": "cat", "match": "Accept$"}]}], "not": {"field": "dstHost.port", "eq": "80"}}`,
+			want:   true,
+		},
+		{name: "Not matched", filter: `{"not": {"field": "protoTr", "eq": "tcp"}}`, want: false},
+		{name: "Invalid regexp", filter: `{"regexp": "["}`, wantErr: true},
+		{name: "Invalid match", filter: `{"field": "cat", "match": "["}`, wantErr: true},
+		{name: "Invalid cidr", filter: `{"field": "dstHost.ip", "cidr": "10.0.0.0"}`, wantErr: true},
+		{name: "Operator without field", filter: `{"eq": "tcp"}`, wantErr: true},
+		{name: "Invalid field path", filter: `{"field": "a..b", "exists": true}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var f models.Filter
+			if err := json.Unmarshal([]byte(tt.filter), &f); err != nil {
+				t.Fatal(err)
+			}
+
+			n, err := compileFilter(f)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("compileFilter() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr {
+				assert.Equal(t, tt.want, n.Match(raw, event))
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package worker
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dedpnd/unifier/internal/models"
+)
+
+// Форматы входных сообщений.
+const (
+	FormatJSON   = "json"
+	FormatCEF    = "cef"
+	FormatLEEF   = "leef"
+	FormatSyslog = "syslog"
+	FormatKV     = "kv"
+	FormatCSV    = "csv"
+)
+
+// parser разбирает сообщение в событие. Значения текстовых форматов
+// сохраняются строками и приводятся к типам на этапе унификации.
+type parser func(raw []byte) (map[string]interface{}, error)
+
+// compileFormat выбирает парсер входных сообщений.
+func compileFormat(cfg *models.Format) (parser, error) {
+	if cfg == nil {
+		return parseJSON, nil
+	}
+
+	ve := &ValidationError{}
+
+	// Настройки, которые имеют смысл только для одного формата
+	onlyFor := func(set bool, name, typ string) {
+		if set && cfg.Type != typ {
+			ve.add("/format/"+name, "allowed only for %v format", typ)
+		}
+	}
+	onlyFor(cfg.PairSeparator != "", "pairSeparator", FormatKV)
+	onlyFor(cfg.KVSeparator != "", "kvSeparator", FormatKV)
+	onlyFor(cfg.Delimiter != "", "delimiter", FormatCSV)
+	onlyFor(cfg.Columns != nil, "columns", FormatCSV)
+
+	var p parser
+	switch cfg.Type {
+	case "", FormatJSON:
+		p = parseJSON
+	case FormatCEF:
+		p = parseCEF
+	case FormatLEEF:
+		p = parseLEEF
+	case FormatSyslog:
+		p = parseSyslog
+	case FormatKV:
+		p = kvParser(cfg.PairSeparator, cfg.KVSeparator)
+	case FormatCSV:
+		p = csvParser(cfg, ve)
+	default:
+		ve.add("/format/type", "unknown format: %v", cfg.Type)
+	}
+
+	return p, ve.err()
+}
+
+func parseJSON(raw []byte) (map[string]interface{}, error) {
+	// Числа сохраняются как json.Number, чтобы целые не теряли точность
+	var event map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&event); err != nil {
+		return nil, fmt.Errorf("invalid JSON parse: %w", err)
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid JSON parse: unexpected data after event")
+	}
+
+	return event, nil
+}
+
+// kvParser разбирает пары ключ=значение. Значение может быть в двойных или
+// одинарных кавычках, внутри кавычек работает экранирование обратным слэшем.
+// Слова без разделителя ключа и значения пропускаются.
+func kvParser(pairSep, kvSep string) parser {
+	if kvSep == "" {
+		kvSep = "="
+	}
+
+	// Длина разделителя пар в начале строки, 0 - разделителя нет
+	sepLen := func(s string) int {
+		if pairSep != "" {
+			if strings.HasPrefix(s, pairSep) {
+				return len(pairSep)
+			}
+			return 0
+		}
+
+		r, size := utf8.DecodeRuneInString(s)
+		if unicode.IsSpace(r) {
+			return size
+		}
+		return 0
+	}
+
+	return func(raw []byte) (map[string]interface{}, error) {
+		s := string(raw)
+		event := make(map[string]interface{})
+
+		for len(s) != 0 {
+			if n := sepLen(s); n != 0 {
+				s = s[n:]
+				continue
+			}
+
+			// Ключ до разделителя ключа или пары
+			i := 0
+			for i < len(s) && !strings.HasPrefix(s[i:], kvSep) && sepLen(s[i:]) == 0 {
+				i++
+			}
+
+			key := s[:i]
+			s = s[i:]
+			if !strings.HasPrefix(s, kvSep) {
+				continue
+			}
+			s = s[len(kvSep):]
+
+			var value string
+			if len(s) != 0 && (s[0] == '"' || s[0] == '\'') {
+				var err error
+				value, s, err = readQuoted(s)
+				if err != nil {
+					return nil, fmt.Errorf("kv: key %v: %w", key, err)
+				}
+			} else {
+				j := 0
+				for j < len(s) && sepLen(s[j:]) == 0 {
+					j++
+				}
+				value, s = s[:j], s[j:]
+			}
+
+			if key != "" {
+				event[key] = value
+			}
+		}
+
+		return event, nil
+	}
+}
+
+// readQuoted читает значение в кавычках и возвращает остаток строки.
+func readQuoted(s string) (string, string, error) {
+	q := s[0]
+
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s):
+			i++
+			b.WriteByte(s[i])
+		case s[i] == q:
+			return b.String(), s[i+1:], nil
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+
+	return "", "", errors.New("unterminated quote")
+}
+
+func csvParser(cfg *models.Format, ve *ValidationError) parser {
+	comma := ','
+	if cfg.Delimiter != "" {
+		r, size := utf8.DecodeRuneInString(cfg.Delimiter)
+		if size != len(cfg.Delimiter) || r == '"' || r == '\r' || r == '\n' {
+			ve.add("/format/delimiter", "must be a single character")
+		}
+		comma = r
+	}
+
+	if len(cfg.Columns) == 0 {
+		ve.add("/format/columns", "is required for %v format", FormatCSV)
+	}
+
+	columns := cfg.Columns
+
+	return func(raw []byte) (map[string]interface{}, error) {
+		r := csv.NewReader(bytes.NewReader(raw))
+		r.Comma = comma
+		r.LazyQuotes = true
+		r.FieldsPerRecord = -1
+
+		rec, err := r.Read()
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV parse: %w", err)
+		}
+
+		// Лишние значения отбрасываются, недостающие не записываются
+		event := make(map[string]interface{}, len(columns))
+		for i, v := range rec {
+			if i >= len(columns) {
+				break
+			}
+			if columns[i] != "" {
+				event[columns[i]] = v
+			}
+		}
+
+		return event, nil
+	}
+}
@@ -0,0 +1,246 @@
+package worker
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/dedpnd/unifier/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_compileFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *models.Format
+		want []string
+	}{
+		{name: "Default format", cfg: nil},
+		{name: "JSON", cfg: &models.Format{Type: FormatJSON}},
+		{name: "Unknown format", cfg: &models.Format{Type: "xml"}, want: []string{"/format/type"}},
+		{name: "CSV without columns", cfg: &models.Format{Type: FormatCSV}, want: []string{"/format/columns"}},
+		{
+			name: "CSV with long delimiter",
+			cfg:  &models.Format{Type: FormatCSV, Delimiter: ";;", Columns: []string{"a"}},
+			want: []string{"/format/delimiter"},
+		},
+		{
+			name: "Options of another format",
+			cfg:  &models.Format{Type: FormatKV, Columns: []string{"a"}},
+			want: []string{"/format/columns"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := compileFormat(tt.cfg)
+
+			var pointers []string
+			if ve, ok := err.(*ValidationError); ok {
+				for _, fe := range ve.Errors {
+					pointers = append(pointers, fe.Pointer)
+				}
+			}
+
+			assert.Equal(t, tt.want, pointers)
+		})
+	}
+}
+
+func Test_parsers(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     models.Format
+		raw     string
+		want    map[string]interface{}
+		wantErr bool
+	}{
+		{
+			name: "JSON",
+			cfg:  models.Format{Type: FormatJSON},
+			raw:  `{"a": 1}`,
+			want: map[string]interface{}{"a": json.Number("1")},
+		},
+		{
+			name: "CEF",
+			cfg:  models.Format{Type: FormatCEF},
+			raw: `Jul 13 13:47:43 host CEF:0|Security|threat\|manager|1.0|100|worm successfully stopped|10|` +
+				`src=10.0.0.1 dst=2.1.2.2 msg=Detected a threat. No action needed\=ok cs1Label=a\\b spt=1232`,
+			want: map[string]interface{}{
+				"cefVersion":         "0",
+				"deviceVendor":       "Security",
+				"deviceProduct":      "threat|manager",
+				"deviceVersion":      "1.0",
+				"deviceEventClassId": "100",
+				"name":               "worm successfully stopped",
+				"severity":           "10",
+				"src":                "10.0.0.1",
+				"dst":                "2.1.2.2",
+				"msg":                "Detected a threat. No action needed=ok",
+				"cs1Label":           `a\b`,
+				"spt":                "1232",
+			},
+		},
+		{
+			name:    "CEF without header",
+			cfg:     models.Format{Type: FormatCEF},
+			raw:     `CEF:0|Security|threat`,
+			wantErr: true,
+		},
+		{
+			name: "LEEF 1.0",
+			cfg:  models.Format{Type: FormatLEEF},
+			raw:  "LEEF:1.0|Microsoft|MSExchange|4.0 SP1|15345|src=192.0.2.0\tdst=172.50.123.1\tsev=5",
+			want: map[string]interface{}{
+				"leefVersion": "1.0",
+				"vendor":      "Microsoft",
+				"product":     "MSExchange",
+				"version":     "4.0 SP1",
+				"eventId":     "15345",
+				"src":         "192.0.2.0",
+				"dst":         "172.50.123.1",
+				"sev":         "5",
+			},
+		},
+		{
+			name: "LEEF 2.0 with hex delimiter",
+			cfg:  models.Format{Type: FormatLEEF},
+			raw:  "LEEF:2.0|Lancope|StealthWatch|1.0|41|x5E|src=10.0.1.8^dst=10.0.0.5",
+			want: map[string]interface{}{
+				"leefVersion": "2.0",
+				"vendor":      "Lancope",
+				"product":     "StealthWatch",
+				"version":     "1.0",
+				"eventId":     "41",
+				"src":         "10.0.1.8",
+				"dst":         "10.0.0.5",
+			},
+		},
+		{
+			name: "Syslog RFC 3164",
+			cfg:  models.Format{Type: FormatSyslog},
+			raw:  "<34>Oct 11 22:14:15 mymachine su[230]: 'su root' failed for lonvick on /dev/pts/8\n",
+			want: map[string]interface{}{
+				"priority":  34,
+				"facility":  4,
+				"severity":  2,
+				"timestamp": "Oct 11 22:14:15",
+				"hostname":  "mymachine",
+				"appName":   "su",
+				"procId":    "230",
+				"message":   "'su root' failed for lonvick on /dev/pts/8",
+			},
+		},
+		{
+			name: "Syslog RFC 3164 without header",
+			cfg:  models.Format{Type: FormatSyslog},
+			raw:  "<13>hello world",
+			want: map[string]interface{}{"priority": 13, "facility": 1, "severity": 5, "message": "hello world"},
+		},
+		{
+			name: "Syslog RFC 5424",
+			cfg:  models.Format{Type: FormatSyslog},
+			raw: `<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 ` +
+				`[exampleSDID@32473 iut="3" eventSource="Appli\"cation"][examplePriority@32473 class="high"] An application event`,
+			want: map[string]interface{}{
+				"priority":  165,
+				"facility":  20,
+				"severity":  5,
+				"version":   1,
+				"timestamp": "2003-10-11T22:14:15.003Z",
+				"hostname":  "mymachine.example.com",
+				"appName":   "evntslog",
+				"msgId":     "ID47",
+				"structuredData": map[string]interface{}{
+					"exampleSDID@32473":     map[string]interface{}{"iut": "3", "eventSource": `Appli"cation`},
+					"examplePriority@32473": map[string]interface{}{"class": "high"},
+				},
+				"message": "An application event",
+			},
+		},
+		{
+			name: "Syslog RFC 5424 without structured data",
+			cfg:  models.Format{Type: FormatSyslog},
+			raw:  `<34>1 2003-10-11T22:14:15.003Z - su - - - ` + utf8BOM + `'su root' failed`,
+			want: map[string]interface{}{
+				"priority":  34,
+				"facility":  4,
+				"severity":  2,
+				"version":   1,
+				"timestamp": "2003-10-11T22:14:15.003Z",
+				"appName":   "su",
+				"message":   "'su root' failed",
+			},
+		},
+		{
+			name:    "Syslog without priority",
+			cfg:     models.Format{Type: FormatSyslog},
+			raw:     "Oct 11 22:14:15 mymachine su: failed",
+			wantErr: true,
+		},
+		{
+			name:    "Syslog with broken structured data",
+			cfg:     models.Format{Type: FormatSyslog},
+			raw:     `<34>1 - - - - - [id a="b]`,
+			wantErr: true,
+		},
+		{
+			name: "Key value",
+			cfg:  models.Format{Type: FormatKV},
+			raw:  `user=alice  action="log in" note='it\'s' flag src=10.0.0.1`,
+			want: map[string]interface{}{"user": "alice", "action": "log in", "note": "it's", "src": "10.0.0.1"},
+		},
+		{
+			name: "Key value with separators",
+			cfg:  models.Format{Type: FormatKV, PairSeparator: ";", KVSeparator: ":"},
+			raw:  `user:alice bob;action:login`,
+			want: map[string]interface{}{"user": "alice bob", "action": "login"},
+		},
+		{
+			name:    "Key value with unterminated quote",
+			cfg:     models.Format{Type: FormatKV},
+			raw:     `user="alice`,
+			wantErr: true,
+		},
+		{
+			name: "CSV",
+			cfg:  models.Format{Type: FormatCSV, Delimiter: ";", Columns: []string{"ip", "", "msg"}},
+			raw:  `10.0.0.1;skip;"a; b";extra`,
+			want: map[string]interface{}{"ip": "10.0.0.1", "msg": "a; b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			p, err := compileFormat(&cfg)
+			assert.NoError(t, err)
+
+			got, err := p([]byte(tt.raw))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parse() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRule_ProcessFormat(t *testing.T) {
+	rule, err := CompileRule(parseConfig(t, `{
+		"format": {"type": "cef"},
+		"filter": {"field": "severity", "gte": 7},
+		"entityHash": ["src"],
+		"unifier": [
+			{"name": "ip", "type": "ip", "expression": "src"},
+			{"name": "port", "type": "int", "expression": "spt"}
+		]}`))
+	assert.NoError(t, err)
+
+	res, err := rule.Process([]byte(`CEF:0|Security|threat|1.0|100|worm|10|src=10.0.0.1 spt=1232`))
+	assert.NoError(t, err)
+	assert.Empty(t, res.Errors)
+	assert.Equal(t, map[string]interface{}{
+		"entity": "190dafab69706a67221c1226360de7dc",
+		"ip":     "10.0.0.1",
+		"port":   1232,
+	}, res.Event)
+}
@@ -0,0 +1,233 @@
+package worker
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ArgKind - тип аргумента функции дополнительной обработки.
+type ArgKind int
+
+const (
+	// ArgString - произвольная строка.
+	ArgString ArgKind = iota
+	// ArgField - имя поля унифицированного события.
+	ArgField
+	// ArgInt - целое число.
+	ArgInt
+	// ArgRegexp - регулярное выражение.
+	ArgRegexp
+)
+
+func (k ArgKind) String() string {
+	switch k {
+	case ArgString:
+		return "string"
+	case ArgField:
+		return "field"
+	case ArgInt:
+		return "int"
+	case ArgRegexp:
+		return "regexp"
+	default:
+		return "unknown"
+	}
+}
+
+// ArgSpec описывает аргумент функции.
+type ArgSpec struct {
+	Name string
+	Kind ArgKind
+	// Enum - допустимые значения строкового аргумента
+	Enum []string
+	// Optional - аргумент можно не передавать, допустимо только для последних аргументов
+	Optional bool
+	// Variadic - последний аргумент может повторяться. Если он не Optional, требуется хотя бы одно значение
+	Variadic bool
+}
+
+// FuncCall - реализация функции. Получает унифицированное событие и
+// разобранные аргументы: string для ArgString и ArgField, int для ArgInt,
+// *regexp.Regexp для ArgRegexp. Значения variadic аргумента передаются
+// отдельными элементами в конце списка.
+// Результат nil означает, что значение в поле To не записывается.
+type FuncCall func(uEvent map[string]interface{}, args []interface{}) (interface{}, error)
+
+// Func - функция дополнительной обработки.
+type Func struct {
+	Args []ArgSpec
+	Call FuncCall
+	// NoResult - функция сама изменяет событие и не использует поле To
+	NoResult bool
+}
+
+var (
+	funcsMu sync.RWMutex
+	funcs   = make(map[string]Func)
+)
+
+// RegisterFunc добавляет функцию в реестр extraProcess.
+func RegisterFunc(name string, f Func) error {
+	if name == "" {
+		return fmt.Errorf("empty func name")
+	}
+
+	if f.Call == nil {
+		return fmt.Errorf("func %v: call is nil", name)
+	}
+
+	for i, a := range f.Args {
+		last := i == len(f.Args)-1
+		if a.Variadic && !last {
+			return fmt.Errorf("func %v: only last argument may be variadic", name)
+		}
+		if !a.Optional && i > 0 && f.Args[i-1].Optional {
+			return fmt.Errorf("func %v: required argument %v after optional", name, a.Name)
+		}
+	}
+
+	funcsMu.Lock()
+	defer funcsMu.Unlock()
+
+	if _, ok := funcs[name]; ok {
+		return fmt.Errorf("func %v already registered", name)
+	}
+	funcs[name] = f
+
+	return nil
+}
+
+func mustRegisterFunc(name string, f Func) {
+	if err := RegisterFunc(name, f); err != nil {
+		panic(err)
+	}
+}
+
+// LookupFunc возвращает функцию из реестра.
+func LookupFunc(name string) (Func, bool) {
+	funcsMu.RLock()
+	defer funcsMu.RUnlock()
+
+	f, ok := funcs[name]
+	return f, ok
+}
+
+// FuncNames возвращает отсортированный список зарегистрированных функций.
+func FuncNames() []string {
+	funcsMu.RLock()
+	defer funcsMu.RUnlock()
+
+	names := make([]string, 0, len(funcs))
+	for n := range funcs {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// ParseArgs проверяет и разбирает строку аргументов согласно описанию функции.
+func (f Func) ParseArgs(raw string) ([]interface{}, error) {
+	parts := splitArgs(raw)
+
+	min, max := 0, len(f.Args)
+	for _, a := range f.Args {
+		if !a.Optional {
+			min++
+		}
+		if a.Variadic {
+			max = -1
+		}
+	}
+
+	if len(parts) < min {
+		return nil, fmt.Errorf("expected at least %d args, got %d", min, len(parts))
+	}
+	if max >= 0 && len(parts) > max {
+		return nil, fmt.Errorf("expected at most %d args, got %d", max, len(parts))
+	}
+
+	res := make([]interface{}, 0, len(parts))
+	for i, p := range parts {
+		spec := f.Args[len(f.Args)-1]
+		if i < len(f.Args) {
+			spec = f.Args[i]
+		}
+
+		v, err := parseArg(spec, p)
+		if err != nil {
+			return nil, fmt.Errorf("arg %d (%v): %w", i+1, spec.Name, err)
+		}
+		res = append(res, v)
+	}
+
+	return res, nil
+}
+
+func parseArg(spec ArgSpec, raw string) (interface{}, error) {
+	switch spec.Kind {
+	case ArgString:
+		if len(spec.Enum) != 0 {
+			for _, e := range spec.Enum {
+				if e == raw {
+					return raw, nil
+				}
+			}
+			return nil, fmt.Errorf("value %q must be one of %v", raw, spec.Enum)
+		}
+		return raw, nil
+	case ArgField:
+		if raw == "" {
+			return nil, fmt.Errorf("empty field name")
+		}
+		return raw, nil
+	case ArgInt:
+		i, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid int: %w", err)
+		}
+		return i, nil
+	case ArgRegexp:
+		re, err := regexp.Compile(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regexp: %w", err)
+		}
+		return re, nil
+	default:
+		return nil, fmt.Errorf("unknown arg kind: %v", spec.Kind)
+	}
+}
+
+// splitArgs разбивает аргументы по запятым. Запятую внутри аргумента
+// можно экранировать как "\,", обратный слэш - как "\\".
+func splitArgs(raw string) []string {
+	if strings.TrimSpace(raw) == "" {
+		return nil
+	}
+
+	var (
+		res []string
+		cur strings.Builder
+	)
+
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case c == '\\' && i+1 < len(raw) && (raw[i+1] == ',' || raw[i+1] == '\\'):
+			cur.WriteByte(raw[i+1])
+			i++
+		case c == ',':
+			res = append(res, strings.TrimSpace(cur.String()))
+			cur.Reset()
+		default:
+			cur.WriteByte(c)
+		}
+	}
+	res = append(res, strings.TrimSpace(cur.String()))
+
+	return res
+}
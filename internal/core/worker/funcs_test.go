@@ -0,0 +1,192 @@
+package worker
+
+import (
+	"testing"
+
+	"github.com/dedpnd/unifier/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisterFunc(t *testing.T) {
+	call := func(_ map[string]interface{}, _ []interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+
+	tests := []struct {
+		name    string
+		fName   string
+		f       Func
+		wantErr bool
+	}{
+		{
+			name:  "Func must be registered",
+			fName: "__testRegister",
+			f:     Func{Args: []ArgSpec{{Name: "a", Kind: ArgString}}, Call: call},
+		},
+		{
+			name:    "Duplicate func should return an error",
+			fName:   "__if",
+			f:       Func{Call: call},
+			wantErr: true,
+		},
+		{
+			name:    "Func without call should return an error",
+			fName:   "__testNoCall",
+			f:       Func{},
+			wantErr: true,
+		},
+		{
+			name:  "Variadic not last should return an error",
+			fName: "__testVariadic",
+			f: Func{Args: []ArgSpec{
+				{Name: "a", Kind: ArgField, Variadic: true},
+				{Name: "b", Kind: ArgString},
+			}, Call: call},
+			wantErr: true,
+		},
+		{
+			name:  "Required after optional should return an error",
+			fName: "__testOptional",
+			f: Func{Args: []ArgSpec{
+				{Name: "a", Kind: ArgString, Optional: true},
+				{Name: "b", Kind: ArgString},
+			}, Call: call},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := RegisterFunc(tt.fName, tt.f); (err != nil) != tt.wantErr {
+				t.Errorf("RegisterFunc() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	uEvent := map[string]interface{}{}
+	err := applyExtraProcess([]models.ExtraProcess{{Func: "__testRegister", Args: "x", To: "out"}}, uEvent)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", uEvent["out"])
+	assert.Contains(t, FuncNames(), "__testRegister")
+}
+
+func TestFunc_ParseArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		fName   string
+		args    string
+		want    int
+		wantErr bool
+	}{
+		{name: "__if with three args", fName: "__if", args: "a, b, c", want: 3},
+		{name: "__if with two args", fName: "__if", args: "a, b", wantErr: true},
+		{name: "__stringConstant with extra args", fName: "__stringConstant", args: "a, b", want: 2},
+		{name: "Escaped comma", fName: "__stringConstant", args: `a\, b`, want: 1},
+		{name: "Optional arg", fName: "__trim", args: "a", want: 1},
+		{name: "Variadic args", fName: "__coalesce", args: "a, b, c, d", want: 4},
+		{name: "Variadic requires value", fName: "__coalesce", args: "", wantErr: true},
+		{name: "Invalid int", fName: "__substring", args: "a, x", wantErr: true},
+		{name: "Invalid regexp", fName: "__regexReplace", args: "a, [, b", wantErr: true},
+		{name: "Invalid enum", fName: "__hash", args: "sha1, a", wantErr: true},
+		{name: "Empty field", fName: "__lowercase", args: " ", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, ok := LookupFunc(tt.fName)
+			assert.True(t, ok)
+
+			got, err := f.ParseArgs(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseArgs() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			assert.Len(t, got, tt.want)
+		})
+	}
+}
+
+func Test_fnHash(t *testing.T) {
+	// Значения полей разделяются, перестановка границы между полями меняет хэш
+	a, err := fnHash(map[string]interface{}{"x": "a", "y": "bc"}, []interface{}{"md5", "x", "y"})
+	assert.NoError(t, err)
+	b, err := fnHash(map[string]interface{}{"x": "ab", "y": "c"}, []interface{}{"md5", "x", "y"})
+	assert.NoError(t, err)
+	assert.NotEqual(t, a, b)
+}
+
+func Test_stdFuncs(t *testing.T) {
+	event := func() map[string]interface{} {
+		return map[string]interface{}{
+			"name":  "  Alice  ",
+			"host":  "srv-01.corp.local",
+			"port":  443,
+			"empty": "",
+		}
+	}
+
+	tests := []struct {
+		name    string
+		ep      models.ExtraProcess
+		want    interface{}
+		written bool
+		wantErr bool
+	}{
+		{name: "__lowercase", ep: models.ExtraProcess{Func: "__lowercase", Args: "host"}, want: "srv-01.corp.local", written: true},
+		{name: "__uppercase", ep: models.ExtraProcess{Func: "__uppercase", Args: "host"}, want: "SRV-01.CORP.LOCAL", written: true},
+		{name: "__trim", ep: models.ExtraProcess{Func: "__trim", Args: "name"}, want: "Alice", written: true},
+		{name: "__trim with cutset", ep: models.ExtraProcess{Func: "__trim", Args: "host, srl"}, want: "v-01.corp.loca", written: true},
+		{name: "__regexReplace", ep: models.ExtraProcess{Func: "__regexReplace", Args: `host, \d+, XX`}, want: "srv-XX.corp.local", written: true},
+		{name: "__regexExtract", ep: models.ExtraProcess{Func: "__regexExtract", Args: `host, ^([^.]+)\.`}, want: "srv-01", written: true},
+		{name: "__regexExtract whole match", ep: models.ExtraProcess{Func: "__regexExtract", Args: `host, \d+`}, want: "01", written: true},
+		{name: "__regexExtract bad group", ep: models.ExtraProcess{Func: "__regexExtract", Args: `host, \d+, 2`}, wantErr: true},
+		{name: "__regexExtract no match", ep: models.ExtraProcess{Func: "__regexExtract", Args: `host, ^x`}},
+		{name: "__concat", ep: models.ExtraProcess{Func: "__concat", Args: "|, host, port, missing"}, want: "srv-01.corp.local|443", written: true},
+		{name: "__split", ep: models.ExtraProcess{Func: "__split", Args: "host, ."}, want: []interface{}{"srv-01", "corp", "local"}, written: true},
+		{name: "__substring", ep: models.ExtraProcess{Func: "__substring", Args: "host, 0, 3"}, want: "srv", written: true},
+		{name: "__substring to end", ep: models.ExtraProcess{Func: "__substring", Args: "host, 12"}, want: "local", written: true},
+		{name: "__substring invalid range", ep: models.ExtraProcess{Func: "__substring", Args: "host, 3, 1"}, wantErr: true},
+		{name: "__coalesce", ep: models.ExtraProcess{Func: "__coalesce", Args: "missing, empty, port"}, want: 443, written: true},
+		{name: "__default missing", ep: models.ExtraProcess{Func: "__default", Args: "empty, n/a"}, want: "n/a", written: true},
+		{name: "__default exists", ep: models.ExtraProcess{Func: "__default", Args: "port, n/a"}, want: 443, written: true},
+		{name: "__hash md5", ep: models.ExtraProcess{Func: "__hash", Args: "md5, port"}, want: "c4cee82a722b54303dfb8ed6f615d115", written: true},
+		{
+			name:    "__hash sha256",
+			ep:      models.ExtraProcess{Func: "__hash", Args: "sha256, port"},
+			want:    "2b0f04f7f30f769b67a1393ba6b1322e35476abbd0d73bd644b1a7af822d5b2a",
+			written: true,
+		},
+		{
+			name:    "__hash keeps field positions",
+			ep:      models.ExtraProcess{Func: "__hash", Args: "md5, port, missing"},
+			want:    "041803d16ef9730d339e77a611505e5c",
+			written: true,
+		},
+		{name: "__stringConstant ignores extra args", ep: models.ExtraProcess{Func: "__stringConstant", Args: "high, low"}, want: "high", written: true},
+		{name: "Missing field is not written", ep: models.ExtraProcess{Func: "__lowercase", Args: "missing"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uEvent := event()
+			tt.ep.To = "out"
+
+			err := applyExtraProcess([]models.ExtraProcess{tt.ep}, uEvent)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("applyExtraProcess() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			v, ok := uEvent["out"]
+			assert.Equal(t, tt.written, ok)
+			assert.Equal(t, tt.want, v)
+		})
+	}
+
+	t.Run("__delete", func(t *testing.T) {
+		uEvent := event()
+		err := applyExtraProcess([]models.ExtraProcess{{Func: "__delete", Args: "name, port", To: "out"}}, uEvent)
+		assert.NoError(t, err)
+		assert.NotContains(t, uEvent, "name")
+		assert.NotContains(t, uEvent, "port")
+		assert.NotContains(t, uEvent, "out")
+	})
+}
@@ -0,0 +1,272 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dedpnd/unifier/internal/models"
+)
+
+// grokPatterns - встроенная библиотека шаблонов. Шаблоны совместимы с RE2,
+// поэтому в отличие от logstash не используют просмотр назад и вперед.
+// Альтернативы упорядочены так, чтобы первой совпадала самая длинная.
+//
+//nolint:lll // Шаблоны не переносятся
+var grokPatterns = map[string]string{
+	"USERNAME":       `[a-zA-Z0-9._-]+`,
+	"USER":           `%{USERNAME}`,
+	"EMAILLOCALPART": `[a-zA-Z0-9._%+-]+`,
+	"EMAILADDRESS":   `%{EMAILLOCALPART}@%{HOSTNAME}`,
+	"INT":            `[+-]?[0-9]+`,
+	"BASE10NUM":      `[+-]?(?:[0-9]+(?:\.[0-9]+)?|\.[0-9]+)`,
+	"NUMBER":         `%{BASE10NUM}`,
+	"BASE16NUM":      `[+-]?(?:0x)?[0-9A-Fa-f]+`,
+	"POSINT":         `[1-9][0-9]*`,
+	"NONNEGINT":      `[0-9]+`,
+	"WORD":           `\b\w+\b`,
+	"NOTSPACE":       `\S+`,
+	"SPACE":          `\s*`,
+	"DATA":           `.*?`,
+	"GREEDYDATA":     `.*`,
+	"QUOTEDSTRING":   `"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'`,
+	"UUID":           `[A-Fa-f0-9]{8}-(?:[A-Fa-f0-9]{4}-){3}[A-Fa-f0-9]{12}`,
+
+	"CISCOMAC":   `(?:[A-Fa-f0-9]{4}\.){2}[A-Fa-f0-9]{4}`,
+	"WINDOWSMAC": `(?:[A-Fa-f0-9]{2}-){5}[A-Fa-f0-9]{2}`,
+	"COMMONMAC":  `(?:[A-Fa-f0-9]{2}:){5}[A-Fa-f0-9]{2}`,
+	"MAC":        `%{CISCOMAC}|%{WINDOWSMAC}|%{COMMONMAC}`,
+
+	"IPV4":  `(?:(?:25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])\.){3}(?:25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])`,
+	"IPV6":  `::(?:[Ff]{4}(?::0{1,4})?:)?%{IPV4}|(?:%{IPV6H}:){1,4}:%{IPV4}|(?:%{IPV6H}:){7}%{IPV6H}|%{IPV6H}:(?::%{IPV6H}){1,6}|(?:%{IPV6H}:){1,2}(?::%{IPV6H}){1,5}|(?:%{IPV6H}:){1,3}(?::%{IPV6H}){1,4}|(?:%{IPV6H}:){1,4}(?::%{IPV6H}){1,3}|(?:%{IPV6H}:){1,5}(?::%{IPV6H}){1,2}|(?:%{IPV6H}:){1,6}:%{IPV6H}|(?:%{IPV6H}:){1,7}:|:(?:(?::%{IPV6H}){1,7}|:)`,
+	"IPV6H": `[0-9A-Fa-f]{1,4}`,
+	"IP":    `%{IPV6}|%{IPV4}`,
+
+	"HOSTNAME": `\b[0-9A-Za-z][0-9A-Za-z-]{0,62}(?:\.[0-9A-Za-z][0-9A-Za-z-]{0,62})*\.?`,
+	"IPORHOST": `%{IP}|%{HOSTNAME}`,
+	"PORT":     `[0-9]{1,5}`,
+	"HOSTPORT": `%{IPORHOST}:%{PORT}`,
+
+	"UNIXPATH":     `(?:/[^/\s]*)+`,
+	"WINPATH":      `(?:[A-Za-z]+:|\\)(?:\\[^\\?*]*)+`,
+	"PATH":         `%{UNIXPATH}|%{WINPATH}`,
+	"URIPROTO":     `[A-Za-z][A-Za-z0-9+.-]+`,
+	"URIHOST":      `%{IPORHOST}(?::%{PORT})?`,
+	"URIPATH":      `(?:/[A-Za-z0-9$.+!*'(){},~:;=@#%&_\-]*)+`,
+	"URIPARAM":     `\?[A-Za-z0-9$.+!*'|(){},~@#%&/=:;_?\-\[\]<>]*`,
+	"URIPATHPARAM": `%{URIPATH}(?:%{URIPARAM})?`,
+	"URI":          `%{URIPROTO}://(?:%{USER}(?::[^@]*)?@)?(?:%{URIHOST})?(?:%{URIPATHPARAM})?`,
+
+	"MONTH":    `\b(?:[Jj]an(?:uary)?|[Ff]eb(?:ruary)?|[Mm]ar(?:ch)?|[Aa]pr(?:il)?|[Mm]ay|[Jj]un(?:e)?|[Jj]ul(?:y)?|[Aa]ug(?:ust)?|[Ss]ep(?:tember)?|[Oo]ct(?:ober)?|[Nn]ov(?:ember)?|[Dd]ec(?:ember)?)\b`,
+	"MONTHNUM": `1[0-2]|0?[1-9]`,
+	"MONTHDAY": `3[01]|[12][0-9]|0?[1-9]`,
+	"DAY":      `Mon(?:day)?|Tue(?:sday)?|Wed(?:nesday)?|Thu(?:rsday)?|Fri(?:day)?|Sat(?:urday)?|Sun(?:day)?`,
+	"YEAR":     `(?:[0-9]{2}){1,2}`,
+	"HOUR":     `2[0-3]|[01]?[0-9]`,
+	"MINUTE":   `[0-5][0-9]`,
+	"SECOND":   `(?:60|[0-5]?[0-9])(?:[.,][0-9]+)?`,
+	"TIME":     `%{HOUR}:%{MINUTE}(?::%{SECOND})?`,
+	"DATE_US":  `%{MONTHNUM}[/-]%{MONTHDAY}[/-]%{YEAR}`,
+	"DATE_EU":  `%{MONTHDAY}[./-]%{MONTHNUM}[./-]%{YEAR}`,
+
+	"ISO8601_TIMEZONE":  `Z|[+-]%{HOUR}(?::?%{MINUTE})?`,
+	"TIMESTAMP_ISO8601": `%{YEAR}-%{MONTHNUM}-%{MONTHDAY}[T ]%{HOUR}:?%{MINUTE}(?::?%{SECOND})?(?:%{ISO8601_TIMEZONE})?`,
+	"SYSLOGTIMESTAMP":   `%{MONTH} +%{MONTHDAY} %{TIME}`,
+	"HTTPDATE":          `%{MONTHDAY}/%{MONTH}/%{YEAR}:%{TIME} %{INT}`,
+
+	"LOGLEVEL": `[Aa]lert|ALERT|[Tt]race|TRACE|[Dd]ebug|DEBUG|[Nn]otice|NOTICE|[Ii]nfo(?:rmation)?|INFO(?:RMATION)?|[Ww]arn(?:ing)?|WARN(?:ING)?|[Ee]rr(?:or)?|ERR(?:OR)?|[Cc]rit(?:ical)?|CRIT(?:ICAL)?|[Ff]atal|FATAL|[Ss]evere|SEVERE|[Ee]merg(?:ency)?|EMERG(?:ENCY)?`,
+}
+
+// grokGroup - префикс имен групп, созданных для %{NAME:field}.
+const grokGroup = "__grok"
+
+var (
+	// %{NAME} или %{NAME:field}
+	grokRef  = regexp.MustCompile(`%\{(\w+)(?::([^{}:]+))?\}`)
+	grokName = regexp.MustCompile(`^\w+$`)
+)
+
+// grokPattern - скомпилированный шаблон. Поля результата хранятся отдельно
+// от имен групп, так как имя поля может содержать точки.
+type grokPattern struct {
+	re     *regexp.Regexp
+	fields []string
+}
+
+// extractor - этап извлечения полей из одного поля события.
+type extractor struct {
+	models.Extract
+	path     Path
+	patterns []*grokPattern
+}
+
+// compileGrok раскрывает ссылки %{NAME:field} и компилирует шаблон. Именованные
+// группы регулярного выражения (?P<field>...) также становятся полями.
+func compileGrok(pattern string, defs map[string]string) (*grokPattern, error) {
+	var fields []string
+	expanding := make(map[string]bool)
+
+	var expand func(p string) (string, error)
+	expand = func(p string) (string, error) {
+		var err error
+		out := grokRef.ReplaceAllStringFunc(p, func(ref string) string {
+			if err != nil {
+				return ""
+			}
+
+			m := grokRef.FindStringSubmatch(ref)
+			name, field := m[1], m[2]
+
+			def, ok := defs[name]
+			if !ok {
+				def, ok = grokPatterns[name]
+			}
+			if !ok {
+				err = fmt.Errorf("unknown pattern: %v", name)
+				return ""
+			}
+			if expanding[name] {
+				err = fmt.Errorf("recursive pattern: %v", name)
+				return ""
+			}
+
+			expanding[name] = true
+			def, err = expand(def)
+			expanding[name] = false
+			if err != nil {
+				return ""
+			}
+
+			if field == "" {
+				return "(?:" + def + ")"
+			}
+
+			fields = append(fields, field)
+			return fmt.Sprintf("(?P<%v%d>%s)", grokGroup, len(fields)-1, def)
+		})
+
+		return out, err
+	}
+
+	expr, err := expand(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+
+	g := &grokPattern{re: re, fields: make([]string, len(re.SubexpNames()))}
+	for i, name := range re.SubexpNames() {
+		if n, ok := strings.CutPrefix(name, grokGroup); ok {
+			if idx, err := strconv.Atoi(n); err == nil {
+				g.fields[i] = fields[idx]
+				continue
+			}
+		}
+		g.fields[i] = name
+	}
+
+	return g, nil
+}
+
+// match возвращает захваченные поля или false, если шаблон не совпал.
+// Группы, не участвовавшие в совпадении, пропускаются.
+func (g *grokPattern) match(s string) (map[string]string, bool) {
+	loc := g.re.FindStringSubmatchIndex(s)
+	if loc == nil {
+		return nil, false
+	}
+
+	res := make(map[string]string)
+	for i, field := range g.fields {
+		if field == "" || loc[2*i] < 0 {
+			continue
+		}
+		res[field] = s[loc[2*i]:loc[2*i+1]]
+	}
+
+	return res, true
+}
+
+func compileExtract(cfgExtract []models.Extract) ([]extractor, error) {
+	ve := &ValidationError{}
+
+	extractors := make([]extractor, 0, len(cfgExtract))
+	for i, e := range cfgExtract {
+		ptr := fmt.Sprintf("/extract/%d", i)
+
+		p, err := ParsePath(e.Field)
+		if err != nil {
+			ve.add(ptr+"/field", "invalid field: %v", err)
+		}
+
+		for name := range e.Definitions {
+			if !grokName.MatchString(name) {
+				ve.add(ptr+"/definitions", "invalid pattern name: %q", name)
+			}
+		}
+
+		if len(e.Patterns) == 0 {
+			ve.add(ptr+"/patterns", "is required")
+		}
+
+		ex := extractor{Extract: e, path: p}
+		for j, pattern := range e.Patterns {
+			g, err := compileGrok(pattern, e.Definitions)
+			if err != nil {
+				ve.add(fmt.Sprintf("%v/patterns/%d", ptr, j), "%v", err)
+				continue
+			}
+			ex.patterns = append(ex.patterns, g)
+		}
+
+		extractors = append(extractors, ex)
+	}
+
+	return extractors, ve.err()
+}
+
+var errNoMatch = errors.New("no pattern matched")
+
+// extractFields применяет шаблоны к полям события и добавляет захваченные
+// значения в событие. Отсутствующее поле пропускается.
+func extractFields(event map[string]interface{}, extractors []extractor) []error {
+	var errs []error
+	for _, ex := range extractors {
+		v, found := ex.path.Get(event)
+		if !found || v == nil {
+			continue
+		}
+
+		s, ok := scalarString(v)
+		if !ok {
+			errs = append(errs, fmt.Errorf("extract %v: not a string", ex.Field))
+			continue
+		}
+
+		matched := false
+		for _, g := range ex.patterns {
+			captures, ok := g.match(s)
+			if !ok {
+				continue
+			}
+
+			for field, c := range captures {
+				event[field] = c
+			}
+			matched = true
+			break
+		}
+
+		if !matched && !ex.Optional {
+			errs = append(errs, fmt.Errorf("extract %v: %w", ex.Field, errNoMatch))
+		}
+	}
+
+	return errs
+}
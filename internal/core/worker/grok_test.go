@@ -0,0 +1,154 @@
+package worker
+
+import (
+	"testing"
+
+	"github.com/dedpnd/unifier/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_compileGrok(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		defs    map[string]string
+		input   string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name:    "Access log",
+			pattern: `%{IP:client} %{USER:ident} %{USER:auth} \[%{HTTPDATE:ts}\] "%{WORD:method} %{URIPATHPARAM:request}" %{INT:status}`,
+			input:   `10.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /index.html?a=1" 200`,
+			want: map[string]string{
+				"client": "10.0.0.1", "ident": "-", "auth": "frank", "ts": "10/Oct/2000:13:55:36 -0700",
+				"method": "GET", "request": "/index.html?a=1", "status": "200",
+			},
+		},
+		{
+			name:    "Host and port",
+			pattern: `^%{IPORHOST:host}:%{PORT:port}$`,
+			input:   `db.example.com:5432`,
+			want:    map[string]string{"host": "db.example.com", "port": "5432"},
+		},
+		{
+			name:    "IPv6",
+			pattern: `^%{IP:ip}$`,
+			input:   `2001:db8::1`,
+			want:    map[string]string{"ip": "2001:db8::1"},
+		},
+		{
+			name:    "IPv4 mapped IPv6",
+			pattern: `^%{IP:ip}$`,
+			input:   `::ffff:10.0.0.1`,
+			want:    map[string]string{"ip": "::ffff:10.0.0.1"},
+		},
+		{
+			name:    "ISO8601 timestamp and level",
+			pattern: `%{TIMESTAMP_ISO8601:ts} %{LOGLEVEL:level} %{GREEDYDATA:msg}`,
+			input:   `2023-07-13T13:47:43.123+03:00 WARNING disk is full`,
+			want:    map[string]string{"ts": "2023-07-13T13:47:43.123+03:00", "level": "WARNING", "msg": "disk is full"},
+		},
+		{
+			name:    "Dotted field and regexp group",
+			pattern: `user=%{USER:src.user} (?P<action>\w+)`,
+			input:   `user=root login`,
+			want:    map[string]string{"src.user": "root", "action": "login"},
+		},
+		{
+			name:    "Custom definition",
+			pattern: `%{SESSION:session}`,
+			defs:    map[string]string{"SESSION": `sess-%{INT}`},
+			input:   `id sess-42`,
+			want:    map[string]string{"session": "sess-42"},
+		},
+		{
+			name:    "Unmatched optional group is skipped",
+			pattern: `%{WORD:a}(?: %{INT:b})?`,
+			input:   `abc`,
+			want:    map[string]string{"a": "abc"},
+		},
+		{name: "No match", pattern: `^%{INT:n}$`, input: `abc`},
+		{name: "Unknown pattern", pattern: `%{NOPE:x}`, wantErr: "unknown pattern: NOPE"},
+		{
+			name:    "Recursive pattern",
+			pattern: `%{A}`,
+			defs:    map[string]string{"A": `%{B}`, "B": `%{A}`},
+			wantErr: "recursive pattern: A",
+		},
+		{name: "Invalid regexp", pattern: `(%{INT}`, wantErr: "invalid pattern"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := compileGrok(tt.pattern, tt.defs)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+
+			got, _ := g.match(tt.input)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRule_ProcessExtract(t *testing.T) {
+	rule, err := CompileRule(models.Config{
+		Extract: []models.Extract{{
+			Field: "message",
+			Patterns: []string{
+				`Accepted password for %{USER:user} from %{IP:src.ip} port %{PORT:src.port}`,
+				`Failed password for %{USER:user} from %{IP:src.ip}`,
+			},
+		}},
+		EntityHash: []string{"src.ip"},
+		Unifier: []models.Unifier{
+			{Name: "user", Type: "string", Expression: "user"},
+			{Name: "ip", Type: "ip", Expression: "src.ip"},
+			{Name: "port", Type: "int", Expression: "src.port"},
+		},
+	})
+	assert.NoError(t, err)
+
+	res, err := rule.Process([]byte(`{"message": "Accepted password for root from 10.0.0.1 port 22 ssh2"}`))
+	assert.NoError(t, err)
+	assert.Empty(t, res.Errors)
+	assert.Equal(t, map[string]interface{}{
+		"entity": "190dafab69706a67221c1226360de7dc",
+		"user":   "root",
+		"ip":     "10.0.0.1",
+		"port":   22,
+	}, res.Event)
+
+	// Применяется первый совпавший шаблон
+	res, err = rule.Process([]byte(`{"message": "Failed password for admin from 10.0.0.1"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "admin", res.Event["user"])
+	assert.NotContains(t, res.Event, "port")
+
+	// Отсутствие совпадения - ошибка обработки
+	res, err = rule.Process([]byte(`{"message": "Connection closed"}`))
+	assert.NoError(t, err)
+	assert.True(t, res.Matched)
+	assert.Len(t, res.Errors, 1)
+	assert.ErrorIs(t, res.Errors[0], errNoMatch)
+}
+
+func Test_compileExtract(t *testing.T) {
+	_, err := CompileRule(models.Config{
+		Extract: []models.Extract{
+			{Field: "a..b", Patterns: []string{`%{NOPE}`}},
+			{Field: "msg", Definitions: map[string]string{"BAD-NAME": `x`}},
+		},
+	})
+
+	var ve *ValidationError
+	assert.ErrorAs(t, err, &ve)
+	assert.Equal(t, []FieldError{
+		{Pointer: "/extract/0/field", Message: `invalid field: path "a..b": empty segment at 2`},
+		{Pointer: "/extract/0/patterns/0", Message: "unknown pattern: NOPE"},
+		{Pointer: "/extract/1/definitions", Message: `invalid pattern name: "BAD-NAME"`},
+		{Pointer: "/extract/1/patterns", Message: "is required"},
+	}, ve.Errors)
+}
@@ -0,0 +1,204 @@
+package worker
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/dedpnd/unifier/internal/models"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Форматы кодирования событий topicTo.
+const (
+	OutputJSON     = "json"
+	OutputAvro     = "avro"
+	OutputProtobuf = "protobuf"
+)
+
+// Имя файла схемы protobuf для сообщений об ошибках.
+const protoFile = "schema.proto"
+
+// errSchemaMismatch - событие не соответствует схеме вывода.
+var errSchemaMismatch = errors.New("schema mismatch")
+
+// encoder кодирует унифицированное событие для записи в topicTo.
+type encoder func(event map[string]interface{}) ([]byte, error)
+
+func encodeJSON(event map[string]interface{}) ([]byte, error) {
+	return json.Marshal(event)
+}
+
+// compileOutput проверяет секцию output и подготавливает кодирование.
+func compileOutput(cfg *models.Output) (encoder, error) {
+	if cfg == nil {
+		return encodeJSON, nil
+	}
+
+	ve := &ValidationError{}
+	enc := encodeJSON
+	var header []byte
+
+	switch cfg.Format {
+	case "", OutputJSON:
+		if cfg.Schema != "" {
+			ve.add("/output/schema", "allowed only for %v and %v formats", OutputAvro, OutputProtobuf)
+		}
+		if cfg.SchemaID != 0 {
+			ve.add("/output/schemaId", "allowed only for %v and %v formats", OutputAvro, OutputProtobuf)
+		}
+	case OutputAvro:
+		if e := compileAvro(cfg, ve); e != nil {
+			enc = e
+		}
+		header = registryHeader(cfg.SchemaID, nil)
+	case OutputProtobuf:
+		md, e := compileProtobuf(cfg, ve)
+		if e != nil {
+			enc = e
+			header = registryHeader(cfg.SchemaID, messageIndexes(md))
+		}
+	default:
+		ve.add("/output/format", "unknown format: %v", cfg.Format)
+	}
+
+	if cfg.Message != "" && cfg.Format != OutputProtobuf {
+		ve.add("/output/message", "allowed only for %v format", OutputProtobuf)
+	}
+	if cfg.SchemaID < 0 {
+		ve.add("/output/schemaId", "must be positive")
+	}
+
+	if err := ve.err(); err != nil {
+		return nil, err
+	}
+
+	if cfg.SchemaID > 0 {
+		return withHeader(header, enc), nil
+	}
+
+	return enc, nil
+}
+
+func compileAvro(cfg *models.Output, ve *ValidationError) encoder {
+	if cfg.Schema == "" {
+		ve.add("/output/schema", "is required for %v format", cfg.Format)
+		return nil
+	}
+
+	enc, err := compileAvroSchema(cfg.Schema)
+	if err != nil {
+		ve.add("/output/schema", "%v", err)
+		return nil
+	}
+
+	return enc
+}
+
+func compileProtobuf(cfg *models.Output, ve *ValidationError) (protoreflect.MessageDescriptor, encoder) {
+	if cfg.Schema == "" {
+		ve.add("/output/schema", "is required for %v format", cfg.Format)
+		return nil, nil
+	}
+
+	c := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(map[string]string{protoFile: cfg.Schema}),
+		}),
+	}
+
+	files, err := c.Compile(context.Background(), protoFile)
+	if err != nil {
+		ve.add("/output/schema", "%v", err)
+		return nil, nil
+	}
+	fd := files[0]
+
+	var md protoreflect.MessageDescriptor
+	if cfg.Message == "" {
+		if fd.Messages().Len() == 0 {
+			ve.add("/output/schema", "no messages defined")
+			return nil, nil
+		}
+		md = fd.Messages().Get(0)
+	} else {
+		name := protoreflect.FullName(cfg.Message)
+		d := fd.FindDescriptorByName(name)
+		if d == nil && fd.Package() != "" {
+			d = fd.FindDescriptorByName(fd.Package().Append(name.Name()))
+		}
+		md, _ = d.(protoreflect.MessageDescriptor)
+		if md == nil {
+			ve.add("/output/message", "unknown message: %v", cfg.Message)
+			return nil, nil
+		}
+	}
+
+	return md, func(event map[string]interface{}) ([]byte, error) {
+		buf, err := json.Marshal(event)
+		if err != nil {
+			return nil, err
+		}
+
+		// Событие приводится к сообщению через JSON: неизвестные поля и
+		// несовпадающие типы отклоняются
+		msg := dynamicpb.NewMessage(md)
+		if err := protojson.Unmarshal(buf, msg); err != nil {
+			return nil, fmt.Errorf("%w: %v", errSchemaMismatch, err)
+		}
+
+		return proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	}
+}
+
+// messageIndexes возвращает путь к сообщению в файле .proto для формата schema registry.
+func messageIndexes(md protoreflect.MessageDescriptor) []int {
+	var idx []int
+	for d := protoreflect.Descriptor(md); ; {
+		idx = append([]int{d.Index()}, idx...)
+
+		parent, ok := d.Parent().(protoreflect.MessageDescriptor)
+		if !ok {
+			return idx
+		}
+		d = parent
+	}
+}
+
+// registryHeader формирует заголовок формата schema registry: магический байт 0,
+// идентификатор схемы big-endian и для protobuf индексы сообщения.
+// Путь к первому сообщению файла кодируется одним нулевым байтом.
+func registryHeader(schemaID int, indexes []int) []byte {
+	h := binary.BigEndian.AppendUint32([]byte{0}, uint32(schemaID))
+	if indexes == nil {
+		return h
+	}
+
+	if len(indexes) == 1 && indexes[0] == 0 {
+		return append(h, 0)
+	}
+
+	h = binary.AppendVarint(h, int64(len(indexes)))
+	for _, i := range indexes {
+		h = binary.AppendVarint(h, int64(i))
+	}
+
+	return h
+}
+
+func withHeader(header []byte, enc encoder) encoder {
+	return func(event map[string]interface{}) ([]byte, error) {
+		buf, err := enc(event)
+		if err != nil {
+			return nil, err
+		}
+
+		return append(append(make([]byte, 0, len(header)+len(buf)), header...), buf...), nil
+	}
+}
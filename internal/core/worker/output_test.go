@@ -0,0 +1,335 @@
+package worker
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/dedpnd/unifier/internal/models"
+	"github.com/hamba/avro/v2"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const testAvroSchema = `{
+	"type": "record", "name": "Event", "namespace": "unifier",
+	"fields": [
+		{"name": "entity", "type": "string"},
+		{"name": "port", "type": "int"},
+		{"name": "ts", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+		{"name": "user", "type": ["null", "string"], "default": null},
+		{"name": "level", "type": {"type": "enum", "name": "Level", "symbols": ["low", "high"]}},
+		{"name": "tags", "type": {"type": "array", "items": "string"}, "default": []}
+	]
+}`
+
+func TestAvroEncode(t *testing.T) {
+	enc, err := compileAvroSchema(testAvroSchema)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		event   map[string]interface{}
+		want    []byte
+		wantErr string
+	}{
+		{
+			name: "All fields",
+			event: map[string]interface{}{
+				"entity": "ab", "port": 22, "ts": "1970-01-01T00:00:01Z",
+				"user": "root", "level": "high", "tags": []interface{}{"x"},
+			},
+			want: []byte{
+				4, 'a', 'b', // entity
+				44,         // port 22
+				0xd0, 0x0f, // ts 1000 мс
+				2, 8, 'r', 'o', 'o', 't', // user: ветка 1, строка
+				2,               // level: индекс 1
+				1, 4, 2, 'x', 0, // tags: блок из одного элемента размером 2 байта
+			},
+		},
+		{
+			name:  "Defaults",
+			event: map[string]interface{}{"entity": "", "port": json.Number("-1"), "ts": 0, "level": "low"},
+			want:  []byte{0, 1, 0, 0, 0, 0},
+		},
+		{
+			name:    "Wrong type",
+			event:   map[string]interface{}{"entity": "", "port": "22", "ts": 0, "level": "low"},
+			wantErr: `port: cannot convert "22" to int`,
+		},
+		{
+			name:    "Int out of range",
+			event:   map[string]interface{}{"entity": "", "port": int64(math.MaxInt32) + 1, "ts": 0, "level": "low"},
+			wantErr: "port: cannot convert 2147483648 (int64) to int",
+		},
+		{
+			name:    "Missing field",
+			event:   map[string]interface{}{"entity": "", "ts": 0, "level": "low"},
+			wantErr: "port: missing field",
+		},
+		{
+			name:    "Unknown field",
+			event:   map[string]interface{}{"entity": "", "port": 1, "ts": 0, "level": "low", "extra": 1},
+			wantErr: "extra: unknown field",
+		},
+		{
+			name:    "Unknown enum symbol",
+			event:   map[string]interface{}{"entity": "", "port": 1, "ts": 0, "level": "medium"},
+			wantErr: `level: cannot convert "medium" to enum`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := enc(tt.event)
+			if tt.wantErr != "" {
+				assert.ErrorIs(t, err, errSchemaMismatch)
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAvroEncode_Types(t *testing.T) {
+	// Ссылки на именованные типы, объединения записей и логические типы
+	const schema = `{
+		"type": "record", "name": "Event", "namespace": "unifier",
+		"fields": [
+			{"name": "src", "type": {"type": "record", "name": "Host", "fields": [{"name": "ip", "type": "string"}]}},
+			{"name": "dst", "type": ["null", "Host"], "default": null},
+			{"name": "day", "type": {"type": "int", "logicalType": "date"}},
+			{"name": "amount", "type": {"type": "bytes", "logicalType": "decimal", "precision": 6, "scale": 2}},
+			{"name": "hash", "type": {"type": "fixed", "name": "Hash", "size": 2}},
+			{"name": "price", "type": {"type": "fixed", "name": "Price", "size": 8, "logicalType": "decimal", "precision": 10, "scale": 2}},
+			{"name": "elapsed", "type": {"type": "int", "logicalType": "time-millis"}},
+			{"name": "labels", "type": {"type": "map", "values": ["long", "string"]}}
+		]
+	}`
+
+	enc, err := compileAvroSchema(schema)
+	assert.NoError(t, err)
+
+	event := map[string]interface{}{
+		"src":     map[string]interface{}{"ip": "10.0.0.1"},
+		"dst":     map[string]interface{}{"ip": "10.0.0.2"},
+		"day":     "1970-01-03",
+		"amount":  json.Number("12.34"),
+		"hash":    "ab",
+		"price":   12.5,
+		"elapsed": json.Number("1500"),
+		"labels":  map[string]interface{}{"a": 1, "b": "x"},
+	}
+	buf, err := enc(event)
+	assert.NoError(t, err)
+
+	s, err := avro.ParseWithCache(schema, "", &avro.SchemaCache{})
+	assert.NoError(t, err)
+
+	var got map[string]interface{}
+	assert.NoError(t, avro.Unmarshal(s, buf, &got))
+	assert.Equal(t, map[string]interface{}{"ip": "10.0.0.1"}, got["src"])
+	assert.Equal(t, map[string]interface{}{"unifier.Host": map[string]interface{}{"ip": "10.0.0.2"}}, got["dst"])
+	assert.Equal(t, time.Date(1970, 1, 3, 0, 0, 0, 0, time.UTC), got["day"])
+	assert.Equal(t, "12.34", got["amount"].(*big.Rat).FloatString(2))
+	assert.Equal(t, [2]byte{'a', 'b'}, got["hash"])
+	assert.Equal(t, "12.50", got["price"].(*big.Rat).FloatString(2))
+	assert.Equal(t, 1500*time.Millisecond, got["elapsed"])
+	assert.Equal(t, map[string]interface{}{"a": int64(1), "b": "x"}, got["labels"])
+
+	event["hash"] = "abc"
+	_, err = enc(event)
+	assert.ErrorContains(t, err, `hash: cannot convert "abc" to fixed(2)`)
+}
+
+func Test_avroLong(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		want int64
+		ok   bool
+	}{
+		{name: "Int", v: 42, want: 42, ok: true},
+		{name: "Number", v: json.Number("-9223372036854775808"), want: math.MinInt64, ok: true},
+		{name: "Number overflow", v: json.Number("9223372036854775808")},
+		{name: "Float", v: float64(-1 << 63), want: math.MinInt64, ok: true},
+		{name: "Float overflow", v: float64(1 << 63)},
+		{name: "Fraction", v: 1.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := avroLong(tt.v)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_compileAvroSchema(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  string
+		wantErr string
+	}{
+		{
+			name:   "Recursive record",
+			schema: `{"type": "record", "name": "Node", "fields": [{"name": "next", "type": ["null", "Node"]}]}`,
+		},
+		{name: "Invalid JSON", schema: `{`, wantErr: "avro: "},
+		{name: "Unknown type", schema: `{"type": "record", "name": "A", "fields": [{"name": "a", "type": "B"}]}`, wantErr: "unknown type: B"},
+		{name: "Nested union", schema: `{"type": "record", "name": "A", "fields": [{"name": "a", "type": [["null"]]}]}`, wantErr: "union"},
+		{name: "Record without name", schema: `{"type": "record", "fields": []}`, wantErr: "name"},
+		{name: "Top level type", schema: `"string"`, wantErr: "top level type must be record, got string"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := compileAvroSchema(tt.schema)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+
+	// Одинаковые имена типов в схемах разных правил не конфликтуют
+	_, err := compileAvroSchema(`{"type": "record", "name": "Same", "fields": [{"name": "a", "type": "string"}]}`)
+	assert.NoError(t, err)
+	_, err = compileAvroSchema(`{"type": "record", "name": "Same", "fields": [{"name": "b", "type": "int"}]}`)
+	assert.NoError(t, err)
+}
+
+const testProtoSchema = `
+syntax = "proto3";
+package unifier;
+
+message Other {}
+
+message Event {
+	message Host {
+		string ip = 1;
+	}
+	string entity = 1;
+	int64 port = 2;
+	Host src = 3;
+}
+`
+
+func TestProtobufEncode(t *testing.T) {
+	cfg := &models.Output{Format: OutputProtobuf, Schema: testProtoSchema, Message: "Event"}
+
+	enc, err := compileOutput(cfg)
+	assert.NoError(t, err)
+
+	buf, err := enc(map[string]interface{}{"entity": "ab", "port": 22, "src": map[string]interface{}{"ip": "10.0.0.1"}})
+	assert.NoError(t, err)
+
+	md, _ := compileProtobuf(cfg, &ValidationError{})
+	msg := dynamicpb.NewMessage(md)
+	assert.NoError(t, proto.Unmarshal(buf, msg))
+	assert.Equal(t, "ab", msg.Get(md.Fields().ByName("entity")).String())
+	assert.Equal(t, int64(22), msg.Get(md.Fields().ByName("port")).Int())
+
+	_, err = enc(map[string]interface{}{"entity": "ab", "unknown": 1})
+	assert.ErrorIs(t, err, errSchemaMismatch)
+
+	_, err = enc(map[string]interface{}{"port": "x"})
+	assert.ErrorIs(t, err, errSchemaMismatch)
+
+	// Заголовок schema registry с индексом вложенного сообщения
+	cfg = &models.Output{Format: OutputProtobuf, Schema: testProtoSchema, Message: "unifier.Event.Host", SchemaID: 7}
+	enc, err = compileOutput(cfg)
+	assert.NoError(t, err)
+
+	buf, err = enc(map[string]interface{}{"ip": "1"})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0, 0, 0, 0, 7, 4, 2, 0, 10, 1, '1'}, buf)
+}
+
+func Test_registryHeader(t *testing.T) {
+	assert.Equal(t, []byte{0, 0, 0, 1, 2}, registryHeader(258, nil))
+	assert.Equal(t, []byte{0, 0, 0, 0, 1, 0}, registryHeader(1, []int{0}))
+	assert.Equal(t, []byte{0, 0, 0, 0, 1, 2, 2}, registryHeader(1, []int{1}))
+}
+
+func Test_compileOutput(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  models.Output
+		want []FieldError
+	}{
+		{name: "JSON", cfg: models.Output{Format: OutputJSON}},
+		{name: "Avro with registry", cfg: models.Output{Format: OutputAvro, Schema: testAvroSchema, SchemaID: 1}},
+		{
+			name: "Unknown format",
+			cfg:  models.Output{Format: "xml"},
+			want: []FieldError{{Pointer: "/output/format", Message: "unknown format: xml"}},
+		},
+		{
+			name: "Schema is required",
+			cfg:  models.Output{Format: OutputAvro},
+			want: []FieldError{{Pointer: "/output/schema", Message: "is required for avro format"}},
+		},
+		{
+			name: "Schema for JSON",
+			cfg:  models.Output{Schema: "{}", Message: "A"},
+			want: []FieldError{
+				{Pointer: "/output/schema", Message: "allowed only for avro and protobuf formats"},
+				{Pointer: "/output/message", Message: "allowed only for protobuf format"},
+			},
+		},
+		{
+			name: "Avro top level type",
+			cfg:  models.Output{Format: OutputAvro, Schema: `"string"`},
+			want: []FieldError{{Pointer: "/output/schema", Message: "top level type must be record, got string"}},
+		},
+		{
+			name: "Unknown protobuf message",
+			cfg:  models.Output{Format: OutputProtobuf, Schema: testProtoSchema, Message: "Nope"},
+			want: []FieldError{{Pointer: "/output/message", Message: "unknown message: Nope"}},
+		},
+		{
+			name: "Negative schema id",
+			cfg:  models.Output{Format: OutputAvro, Schema: testAvroSchema, SchemaID: -1},
+			want: []FieldError{{Pointer: "/output/schemaId", Message: "must be positive"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			_, err := compileOutput(&cfg)
+			if tt.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			var ve *ValidationError
+			assert.ErrorAs(t, err, &ve)
+			assert.Equal(t, tt.want, ve.Errors)
+		})
+	}
+
+	// Ошибка синтаксиса .proto
+	_, err := compileOutput(&models.Output{Format: OutputProtobuf, Schema: "message {"})
+	assert.ErrorContains(t, err, "/output/schema: schema.proto:1:9")
+}
+
+func TestRule_DryRunOutput(t *testing.T) {
+	rule, err := CompileRule(models.Config{
+		Unifier: []models.Unifier{{Name: "port", Type: "string", Expression: "port"}},
+		Output: &models.Output{
+			Format: OutputAvro,
+			Schema: `{"type": "record", "name": "E", "fields": [{"name": "entity", "type": "string"}, {"name": "port", "type": "int"}]}`,
+		},
+	})
+	assert.NoError(t, err)
+
+	res := rule.DryRun([]byte(`{"port": "22"}`))
+	assert.True(t, res.Matched)
+	assert.Equal(t, []string{`schema mismatch: port: cannot convert "22" to int`}, res.Errors)
+}
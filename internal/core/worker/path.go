@@ -0,0 +1,244 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Path - разобранное выражение для доступа к полю события.
+//
+// Поддерживаемый синтаксис:
+//
+//	srcHost.ip              - ключ верхнего уровня с точкой или вложенный объект
+//	blockGroup.users[0]     - элемент массива по индексу
+//	blockGroup.users[*]     - все элементы массива
+//	blockGroup.*.name       - все значения объекта
+//	blockGroup["a.b"].c     - ключ в кавычках, точки внутри не разделяют путь
+//
+// Ключи, разделенные точками, сначала ищутся целиком как плоский ключ,
+// поэтому выражения вида "srcHost.ip" сохраняют прежний смысл.
+type Path struct {
+	expr  string
+	steps []step
+	multi bool
+}
+
+type stepKind int
+
+const (
+	stepKey stepKind = iota
+	stepIndex
+	stepWildcard
+)
+
+type step struct {
+	key    string
+	kind   stepKind
+	index  int
+	quoted bool
+}
+
+var errEmptyPath = errors.New("empty path")
+
+// ParsePath разбирает выражение пути.
+func ParsePath(expr string) (Path, error) {
+	p := Path{expr: expr}
+
+	if strings.TrimSpace(expr) == "" {
+		return p, errEmptyPath
+	}
+
+	// Точка допустима только между сегментами
+	needSegment := true
+	for i := 0; i < len(expr); {
+		switch expr[i] {
+		case '.':
+			if needSegment {
+				return p, fmt.Errorf("path %q: empty segment at %d", expr, i)
+			}
+			needSegment = true
+			i++
+		case '[':
+			s, n, err := parseBracket(expr[i:])
+			if err != nil {
+				return p, fmt.Errorf("path %q: %w", expr, err)
+			}
+			if s.kind == stepWildcard {
+				p.multi = true
+			}
+			p.steps = append(p.steps, s)
+			needSegment = false
+			i += n
+		default:
+			if !needSegment {
+				return p, fmt.Errorf("path %q: expected '.' or '[' at %d", expr, i)
+			}
+			end := strings.IndexAny(expr[i:], ".[")
+			if end == -1 {
+				end = len(expr) - i
+			}
+			seg := expr[i : i+end]
+			if seg == "*" {
+				p.multi = true
+				p.steps = append(p.steps, step{kind: stepWildcard})
+			} else {
+				p.steps = append(p.steps, step{kind: stepKey, key: seg})
+			}
+			needSegment = false
+			i += end
+		}
+	}
+
+	if needSegment {
+		return p, fmt.Errorf("path %q: trailing '.'", expr)
+	}
+
+	return p, nil
+}
+
+func parseBracket(s string) (step, int, error) {
+	if len(s) > 1 && (s[1] == '"' || s[1] == '\'') {
+		q := s[1]
+		end := strings.IndexByte(s[2:], q)
+		if end == -1 {
+			return step{}, 0, errors.New("unterminated quoted key")
+		}
+		end += 2
+		if end+1 >= len(s) || s[end+1] != ']' {
+			return step{}, 0, errors.New("expected ']' after quoted key")
+		}
+		return step{kind: stepKey, key: s[2:end], quoted: true}, end + 2, nil
+	}
+
+	end := strings.IndexByte(s, ']')
+	if end == -1 {
+		return step{}, 0, errors.New("unterminated '['")
+	}
+
+	body := strings.TrimSpace(s[1:end])
+	if body == "*" {
+		return step{kind: stepWildcard}, end + 1, nil
+	}
+
+	idx, err := strconv.Atoi(body)
+	if err != nil || idx < 0 {
+		return step{}, 0, fmt.Errorf("invalid index %q", body)
+	}
+
+	return step{kind: stepIndex, index: idx}, end + 1, nil
+}
+
+// String возвращает исходное выражение.
+func (p Path) String() string {
+	return p.expr
+}
+
+// Multi сообщает, может ли путь вернуть несколько значений.
+func (p Path) Multi() bool {
+	return p.multi
+}
+
+// Get возвращает значение по пути. Для путей с подстановкой (*) результатом
+// всегда является []interface{} из всех найденных значений.
+func (p Path) Get(event map[string]interface{}) (interface{}, bool) {
+	if len(p.steps) == 0 {
+		return nil, false
+	}
+
+	vals := resolve(event, p.steps, nil)
+	if len(vals) == 0 {
+		return nil, false
+	}
+
+	if p.multi {
+		return vals, true
+	}
+
+	return vals[0], true
+}
+
+func resolve(cur interface{}, steps []step, out []interface{}) []interface{} {
+	if len(steps) == 0 {
+		return append(out, cur)
+	}
+
+	s := steps[0]
+	switch s.kind {
+	case stepKey:
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return out
+		}
+
+		// Сначала пробуем самый длинный плоский ключ из соседних сегментов
+		for n := plainRun(steps); n >= 1; n-- {
+			v, ok := m[joinKeys(steps[:n])]
+			if !ok {
+				continue
+			}
+			before := len(out)
+			out = resolve(v, steps[n:], out)
+			if len(out) > before {
+				return out
+			}
+		}
+	case stepIndex:
+		arr, ok := cur.([]interface{})
+		if !ok || s.index >= len(arr) {
+			return out
+		}
+		return resolve(arr[s.index], steps[1:], out)
+	case stepWildcard:
+		switch v := cur.(type) {
+		case []interface{}:
+			for _, e := range v {
+				out = resolve(e, steps[1:], out)
+			}
+		case map[string]interface{}:
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+
+			for _, k := range keys {
+				out = resolve(v[k], steps[1:], out)
+			}
+		}
+	}
+
+	return out
+}
+
+func plainRun(steps []step) int {
+	// Ключ в кавычках не склеивается с соседями
+	if steps[0].quoted {
+		return 1
+	}
+
+	n := 0
+	for _, s := range steps {
+		if s.kind != stepKey || s.quoted {
+			break
+		}
+		n++
+	}
+
+	return n
+}
+
+func joinKeys(steps []step) string {
+	if len(steps) == 1 {
+		return steps[0].key
+	}
+
+	keys := make([]string, len(steps))
+	for i, s := range steps {
+		keys[i] = s.key
+	}
+
+	return strings.Join(keys, ".")
+}
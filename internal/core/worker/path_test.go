@@ -0,0 +1,92 @@
+package worker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		multi   bool
+		wantErr bool
+	}{
+		{name: "Flat key", expr: "cat"},
+		{name: "Dotted key", expr: "srcHost.ip"},
+		{name: "Array index", expr: "blockGroup.users[0].name"},
+		{name: "Array wildcard", expr: "blockGroup.users[*]", multi: true},
+		{name: "Object wildcard", expr: "blockGroup.*", multi: true},
+		{name: "Quoted key", expr: `blockGroup["a.b"][1]`},
+		{name: "Empty path", expr: "", wantErr: true},
+		{name: "Empty segment", expr: "a..b", wantErr: true},
+		{name: "Trailing dot", expr: "a.", wantErr: true},
+		{name: "Invalid index", expr: "a[x]", wantErr: true},
+		{name: "Unterminated bracket", expr: "a[0", wantErr: true},
+		{name: "Unterminated quote", expr: `a["b]`, wantErr: true},
+		{name: "Segment after bracket", expr: "a[0]b", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParsePath(tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParsePath() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr {
+				assert.Equal(t, tt.multi, p.Multi())
+				assert.Equal(t, tt.expr, p.String())
+			}
+		})
+	}
+}
+
+func TestPath_Get(t *testing.T) {
+	event := map[string]interface{}{
+		"cat":        "/Host/Connect/Host/Accept",
+		"srcHost.ip": "212.3.150.103",
+		"dstHost": map[string]interface{}{
+			"ip": "194.50.152.187",
+		},
+		"dvcHost.rule": map[string]interface{}{
+			"name": "fw_rule",
+		},
+		"blockGroup": map[string]interface{}{
+			"a.b": []interface{}{"x", "y"},
+			"users": []interface{}{
+				map[string]interface{}{"name": "alice"},
+				map[string]interface{}{"name": "bob"},
+			},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		expr  string
+		want  interface{}
+		found bool
+	}{
+		{name: "Flat key", expr: "cat", want: "/Host/Connect/Host/Accept", found: true},
+		{name: "Literal dotted key", expr: "srcHost.ip", want: "212.3.150.103", found: true},
+		{name: "Nested object", expr: "dstHost.ip", want: "194.50.152.187", found: true},
+		{name: "Dotted key with nested object", expr: "dvcHost.rule.name", want: "fw_rule", found: true},
+		{name: "Array index", expr: "blockGroup.users[1].name", want: "bob", found: true},
+		{name: "Array wildcard", expr: "blockGroup.users[*].name", want: []interface{}{"alice", "bob"}, found: true},
+		{name: "Quoted key", expr: `blockGroup["a.b"][0]`, want: "x", found: true},
+		{name: "Index out of range", expr: "blockGroup.users[5]", found: false},
+		{name: "Missing key", expr: "dstHost.port", found: false},
+		{name: "Index on object", expr: "dstHost[0]", found: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParsePath(tt.expr)
+			assert.NoError(t, err)
+
+			got, found := p.Get(event)
+			assert.Equal(t, tt.found, found)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -2,78 +2,303 @@ package worker
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strconv"
+	"sync"
+	"sync/atomic"
 
 	"github.com/dedpnd/unifier/internal/adapter/store"
-	"github.com/dedpnd/unifier/internal/models"
+	"github.com/dedpnd/unifier/internal/metrics"
 	"go.uber.org/zap"
 )
 
+// Pool - реестр запущенных воркеров. Безопасен для одновременного использования
+// из HTTP обработчиков и горутин воркеров.
 type Pool struct {
 	logger   *zap.Logger
 	kafkaURL string
-	p        map[string]workerEntity
+	backoff  Backoff
+	commit   Commit
+
+	contracts *contractSet
+
+	mu     sync.RWMutex
+	p      map[string]*workerEntity
+	closed bool
 }
 
 type workerEntity struct {
-	ID     string
-	Config models.Config
-	Stop   chan bool
+	ID string
+	// Правило можно заменить на лету, не перезапуская воркер
+	rule   atomic.Pointer[Rule]
+	cancel context.CancelFunc
+	done   chan struct{}
+	state  *workerState
+	stats  *workerStats
+	// Контракты читаются на каждое сообщение, изменение схемы не требует перезапуска
+	contracts *contractSet
 }
 
-func StartPool(kAddr string, str store.Storage, lg *zap.Logger) (Pool, error) {
-	p := Pool{
-		logger:   lg,
-		kafkaURL: kAddr,
-		p:        make(map[string]workerEntity),
+var ErrPoolClosed = errors.New("worker pool closed")
+
+func newPool(kAddr string, lg *zap.Logger, b Backoff, c Commit) *Pool {
+	return &Pool{
+		logger:    lg,
+		kafkaURL:  kAddr,
+		backoff:   b,
+		commit:    c,
+		contracts: newContractSet(),
+		p:         make(map[string]*workerEntity),
+	}
+}
+
+// StartPool создает пул и запускает воркеры для всех сохраненных правил.
+func StartPool(kAddr string, str store.Storage, lg *zap.Logger, b Backoff, c Commit) (*Pool, error) {
+	p := newPool(kAddr, lg, b, c)
+
+	schemas, err := str.GetTopicSchemas(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed get topic schemas from storage: %w", err)
+	}
+
+	for _, ts := range schemas {
+		c, err := CompileContract(ts)
+		if err != nil {
+			lg.With(zap.Error(err)).Error("Invalid topic schema", zap.String("topic", ts.Topic))
+			continue
+		}
+		p.SetContract(c)
 	}
 
 	rules, err := str.GetAllRules(context.Background())
 	if err != nil {
-		return Pool{}, fmt.Errorf("failed get all rule from storage: %w", err)
+		return nil, fmt.Errorf("failed get all rule from storage: %w", err)
 	}
 
 	for i := range rules {
 		id := strconv.Itoa(rules[i].ID)
-		p.AddWorker(id, rules[i].Rule)
+
+		rule, err := CompileRule(rules[i].Rule)
+		if err != nil {
+			// Некорректное правило не мешает запуску остальных и видно в списке
+			// воркеров, пока его не исправят
+			lg.With(zap.Error(err)).Error("Invalid rule", zap.String("ID", id))
+			p.addFailed(id, fmt.Errorf("invalid rule: %w", err))
+			continue
+		}
+		rule.SetVersion(rules[i].Version)
+
+		if err := p.AddWorker(context.Background(), id, rule); err != nil {
+			return nil, err
+		}
 	}
 
 	return p, nil
 }
 
-func (p Pool) AddWorker(id string, rule models.Config) {
-	p.p[id] = workerEntity{
-		ID:     id,
-		Config: rule,
-		Stop:   make(chan bool),
+// AddWorker запускает воркер для правила. Воркер с тем же ID предварительно
+// останавливается, если его правило не новее rule. Остановка ожидается до
+// отмены ctx, новый воркер в любом случае начнет работу только после нее.
+func (p *Pool) AddWorker(ctx context.Context, id string, rule *Rule) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrPoolClosed
+	}
+
+	old := p.p[id]
+	if old.newer(rule) {
+		p.mu.Unlock()
+		p.logger.Info("Stale rule version skipped", zap.String("ID", id), zap.Int("version", rule.Version()))
+		return nil
 	}
 
+	wCtx, cancel := context.WithCancel(context.Background())
+	wrk := &workerEntity{
+		ID:        id,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+		state:     newWorkerState(),
+		stats:     newWorkerStats(),
+		contracts: p.contracts,
+	}
+	wrk.rule.Store(rule)
+	p.p[id] = wrk
+	p.mu.Unlock()
+
+	if old != nil {
+		old.cancel()
+	}
+
+	// Супервизор перезапускает воркер после ошибок
 	go func() {
-		if err := Start(context.Background(), p.kafkaURL, p.p[id], p.logger); err != nil {
-			p.logger.With(zap.Error(err)).Error("Worker has error", zap.String("ID", id))
+		defer close(wrk.done)
 
-			// TODO: Перезапускать воркер ?
-			// Удаляем конфигурацию из пула так как она не работает
-			delete(p.p, id)
+		// Два воркера одного правила не должны работать одновременно
+		if old != nil {
+			select {
+			case <-old.done:
+			case <-wCtx.Done():
+				wrk.state.set(StateStopped, nil)
+				return
+			}
 		}
+
+		supervise(wCtx, func(ctx context.Context) error {
+			return Start(ctx, p.kafkaURL, p.commit, wrk, p.logger)
+		}, p.backoff, wrk.state, id, p.logger)
 	}()
+
+	if old != nil {
+		if err := waitStopped(ctx, old); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addFailed регистрирует воркер правила, которое не удалось подготовить к работе,
+// в состоянии failed. Воркер не запускается, ReloadWorker заменяет его новым.
+func (p *Pool) addFailed(id string, err error) {
+	done := make(chan struct{})
+	close(done)
+
+	wrk := &workerEntity{
+		ID:        id,
+		cancel:    func() {},
+		done:      done,
+		state:     newWorkerState(),
+		stats:     newWorkerStats(),
+		contracts: p.contracts,
+	}
+	wrk.state.set(StateFailed, err)
+
+	p.mu.Lock()
+	p.p[id] = wrk
+	p.mu.Unlock()
 }
 
-func (p Pool) DeleteWorker(id string) {
+// ReloadWorker заменяет правило воркера. Если топики и политика ошибок не
+// изменились, новое правило применяется к следующему сообщению без переподключения.
+// Иначе воркер перезапускается с тем же ID, поэтому группа консьюмеров и ее
+// смещения сохраняются. Правило старее текущего не применяется: одновременные
+// изменения могут дойти до пула не в порядке сохранения.
+func (p *Pool) ReloadWorker(ctx context.Context, id string, rule *Rule) error {
+	// Проверка версии и замена выполняются под p.mu, поэтому из двух
+	// одновременных изменений правила остается более новое
+	p.mu.Lock()
 	wrk, ok := p.p[id]
+	if wrk.newer(rule) {
+		p.mu.Unlock()
+		p.logger.Info("Stale rule version skipped", zap.String("ID", id), zap.Int("version", rule.Version()))
+		return nil
+	}
 
 	if ok {
-		// Останнавливаем воркер
-		wrk.Stop <- true
+		state, _, _ := wrk.state.State()
+		if state != StateFailed && state != StateStopped && wrk.rule.Load().sameEndpoints(rule) {
+			wrk.rule.Store(rule)
+			p.mu.Unlock()
+			p.logger.Info("Worker reloaded", zap.String("ID", id))
+			return nil
+		}
+	}
+	p.mu.Unlock()
+
+	return p.AddWorker(ctx, id, rule)
+}
+
+// newer сообщает, что воркер уже работает с более новой версией правила,
+// чем rule. Вызывается под p.mu.
+func (wrk *workerEntity) newer(rule *Rule) bool {
+	if wrk == nil {
+		return false
+	}
+
+	cur := wrk.rule.Load()
+	return cur != nil && cur.Version() > rule.Version()
+}
+
+// SetContract добавляет или заменяет контракт топика. Воркеры применяют его
+// к следующему сообщению.
+func (p *Pool) SetContract(c *Contract) {
+	p.contracts.set(c)
+}
 
-		// Удаляем конфигурацию
+// DeleteContract удаляет контракт топика.
+func (p *Pool) DeleteContract(topic string) {
+	p.contracts.delete(topic)
+}
+
+// CheckRule сверяет правило с контрактом его topicTo, если он задан.
+func (p *Pool) CheckRule(rule *Rule) error {
+	c := p.contracts.get(rule.Config().TopicTo)
+	if c == nil {
+		return nil
+	}
+
+	return c.CheckRule(rule)
+}
+
+// DeleteWorker останавливает воркер и дожидается закрытия его соединений до
+// отмены ctx. После ошибки воркер завершится сам, но метрики правила останутся.
+func (p *Pool) DeleteWorker(ctx context.Context, id string) error {
+	p.mu.Lock()
+	wrk, ok := p.p[id]
+	if ok {
 		delete(p.p, id)
 	}
+	p.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	// Останнавливаем воркер
+	wrk.cancel()
+	if err := waitStopped(ctx, wrk); err != nil {
+		return err
+	}
+
+	metrics.DeleteRule(id)
+
+	return nil
+}
+
+// waitStopped ждет завершения остановленного воркера до отмены ctx.
+func waitStopped(ctx context.Context, wrk *workerEntity) error {
+	select {
+	case <-wrk.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed wait worker:%v shutdown: %w", wrk.ID, ctx.Err())
+	}
 }
 
-func (p Pool) StopPool() {
-	for i := range p.p {
-		p.p[i].Stop <- true
+// StopPool останавливает все воркеры и ждет их завершения до дедлайна контекста.
+func (p *Pool) StopPool(ctx context.Context) error {
+	p.mu.Lock()
+	p.closed = true
+	workers := make([]*workerEntity, 0, len(p.p))
+	for id, wrk := range p.p {
+		workers = append(workers, wrk)
+		delete(p.p, id)
+	}
+	p.mu.Unlock()
+
+	for _, wrk := range workers {
+		wrk.cancel()
 	}
+
+	for _, wrk := range workers {
+		select {
+		case <-wrk.done:
+		case <-ctx.Done():
+			return fmt.Errorf("failed wait workers shutdown: %w", ctx.Err())
+		}
+	}
+
+	return nil
 }
@@ -0,0 +1,222 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dedpnd/unifier/internal/models"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// Адрес без брокера: воркеры падают при создании producer и перезапускаются.
+const unreachableKafka = "127.0.0.1:1"
+
+func testPool(t *testing.T) *Pool {
+	t.Helper()
+
+	return newPool(unreachableKafka, zap.NewNop(), Backoff{
+		Initial:    time.Millisecond,
+		Max:        5 * time.Millisecond,
+		Multiplier: 2,
+	}, DefaultCommit)
+}
+
+func testRule(t *testing.T) *Rule {
+	t.Helper()
+
+	rule, err := CompileRule(models.Config{TopicFrom: "events", TopicTo: "test"})
+	assert.NoError(t, err)
+
+	return rule
+}
+
+func TestPool_Concurrent(t *testing.T) {
+	p := testPool(t)
+	rule := testRule(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			id := strconv.Itoa(i % 5)
+			assert.NoError(t, p.AddWorker(context.Background(), id, rule))
+			if i%2 == 0 {
+				assert.NoError(t, p.DeleteWorker(context.Background(), id))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assert.NoError(t, p.StopPool(ctx))
+	assert.ErrorIs(t, p.AddWorker(context.Background(), "1", rule), ErrPoolClosed)
+}
+
+func TestPool_DeleteWorker(t *testing.T) {
+	p := testPool(t)
+	rule := testRule(t)
+
+	assert.NoError(t, p.AddWorker(context.Background(), "1", rule))
+
+	p.mu.RLock()
+	wrk := p.p["1"]
+	p.mu.RUnlock()
+
+	// Удаление дожидается завершения воркера
+	assert.NoError(t, p.DeleteWorker(context.Background(), "1"))
+
+	select {
+	case <-wrk.done:
+	default:
+		t.Fatal("worker must be stopped")
+	}
+
+	state, _, _ := wrk.state.State()
+	assert.Equal(t, StateStopped, state)
+
+	// Повторное удаление не блокируется
+	assert.NoError(t, p.DeleteWorker(context.Background(), "1"))
+}
+
+func TestPool_ReloadWorker(t *testing.T) {
+	p := testPool(t)
+	rule := testRule(t)
+
+	assert.NoError(t, p.AddWorker(context.Background(), "1", rule))
+
+	entity := func() *workerEntity {
+		p.mu.RLock()
+		defer p.mu.RUnlock()
+		return p.p["1"]
+	}
+
+	wrk := entity()
+
+	// Те же топики: правило подменяется без перезапуска
+	sameTopics, err := CompileRule(models.Config{TopicFrom: "events", TopicTo: "test", EntityHash: []string{"ip"}})
+	assert.NoError(t, err)
+	assert.NoError(t, p.ReloadWorker(context.Background(), "1", sameTopics))
+	assert.Same(t, wrk, entity())
+	assert.Same(t, sameTopics, wrk.rule.Load())
+
+	// Новый топик: воркер перезапускается
+	otherTopic, err := CompileRule(models.Config{TopicFrom: "events", TopicTo: "other"})
+	assert.NoError(t, err)
+	otherTopic.SetVersion(3)
+	assert.NoError(t, p.ReloadWorker(context.Background(), "1", otherTopic))
+	assert.NotSame(t, wrk, entity())
+	assert.Same(t, otherTopic, entity().rule.Load())
+
+	select {
+	case <-wrk.done:
+	default:
+		t.Fatal("old worker must be stopped")
+	}
+
+	// Более старая версия, перезагруженная позже новой, не применяется
+	stale, err := CompileRule(models.Config{TopicFrom: "events", TopicTo: "test"})
+	assert.NoError(t, err)
+	stale.SetVersion(2)
+	restarted := entity()
+	assert.NoError(t, p.ReloadWorker(context.Background(), "1", stale))
+	assert.Same(t, restarted, entity())
+	assert.Same(t, otherTopic, restarted.rule.Load())
+
+	// Неизвестный воркер запускается
+	assert.NoError(t, p.ReloadWorker(context.Background(), "2", rule))
+	_, ok := p.Status("2")
+	assert.True(t, ok)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assert.NoError(t, p.StopPool(ctx))
+}
+
+func TestPool_StopPoolDeadline(t *testing.T) {
+	p := testPool(t)
+
+	// Воркер, который не завершается, не должен блокировать остановку дольше дедлайна
+	p.p["stuck"] = &workerEntity{
+		ID:     "stuck",
+		cancel: func() {},
+		done:   make(chan struct{}),
+		state:  newWorkerState(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	assert.ErrorIs(t, p.StopPool(ctx), context.DeadlineExceeded)
+}
+
+func TestPool_StopWorkerDeadline(t *testing.T) {
+	p := testPool(t)
+
+	stuck := func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.p["stuck"] = &workerEntity{
+			ID:     "stuck",
+			cancel: func() {},
+			done:   make(chan struct{}),
+			state:  newWorkerState(),
+		}
+	}
+
+	// Удаление зависшего воркера ждет не дольше дедлайна запроса
+	stuck()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, p.DeleteWorker(ctx, "stuck"), context.DeadlineExceeded)
+
+	// Перезапуск тоже, а новый воркер не стартует, пока старый не завершится
+	stuck()
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, p.AddWorker(ctx, "stuck", testRule(t)), context.DeadlineExceeded)
+
+	p.mu.RLock()
+	wrk := p.p["stuck"]
+	p.mu.RUnlock()
+
+	state, _, _ := wrk.state.State()
+	assert.NotEqual(t, StateRunning, state)
+
+	// Отмененный до старта воркер завершается
+	assert.NoError(t, p.DeleteWorker(context.Background(), "stuck"))
+	state, _, _ = wrk.state.State()
+	assert.Equal(t, StateStopped, state)
+}
+
+func TestPool_InvalidRule(t *testing.T) {
+	p := testPool(t)
+
+	// Сохраненное правило, которое не компилируется, видно как failed
+	p.addFailed("1", fmt.Errorf("invalid rule: %w", errors.New("unknown func")))
+
+	st, ok := p.Status("1")
+	assert.True(t, ok)
+	assert.Equal(t, StateFailed, st.State)
+	assert.Equal(t, "invalid rule: unknown func", st.LastError)
+
+	// Исправленное правило запускает воркер
+	assert.NoError(t, p.ReloadWorker(context.Background(), "1", testRule(t)))
+	st, _ = p.Status("1")
+	assert.NotEqual(t, StateFailed, st.State)
+
+	assert.NoError(t, p.DeleteWorker(context.Background(), "1"))
+	p.addFailed("2", errors.New("invalid rule"))
+	assert.NoError(t, p.DeleteWorker(context.Background(), "2"))
+	assert.Empty(t, p.Statuses())
+}
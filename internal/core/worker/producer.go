@@ -0,0 +1,233 @@
+package worker
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/dedpnd/unifier/internal/models"
+	"github.com/segmentio/kafka-go"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// Способы выбора партиции topicTo.
+const (
+	BalancerHash       = "hash"
+	BalancerRoundRobin = "roundRobin"
+	BalancerLeastBytes = "leastBytes"
+)
+
+// Подтверждение записи брокером.
+const (
+	AcksAll  = "all"
+	AcksOne  = "one"
+	AcksNone = "none"
+)
+
+// Параметры записи по умолчанию.
+const (
+	defaultBatchSize    = 100
+	defaultBatchTimeout = 10 * time.Millisecond
+)
+
+var compressionCodecs = map[string]kafka.Compression{
+	"none":   0,
+	"gzip":   kafka.Gzip,
+	"snappy": kafka.Snappy,
+	"lz4":    kafka.Lz4,
+	"zstd":   kafka.Zstd,
+}
+
+var requiredAcks = map[string]kafka.RequiredAcks{
+	AcksAll:  kafka.RequireAll,
+	AcksOne:  kafka.RequireOne,
+	AcksNone: kafka.RequireNone,
+}
+
+// producerConfig - проверенные параметры записи с подставленными значениями по умолчанию.
+type producerConfig struct {
+	balancer     string
+	batchSize    int
+	batchTimeout time.Duration
+	compression  string
+	acks         string
+}
+
+// compileProducer проверяет секцию producer. В режиме exactly_once брокер
+// принимает транзакционную запись только с подтверждением всех реплик.
+func compileProducer(cfg *models.Producer, delivery string) (producerConfig, error) {
+	p := producerConfig{
+		balancer:     BalancerHash,
+		batchSize:    defaultBatchSize,
+		batchTimeout: defaultBatchTimeout,
+		compression:  "none",
+		acks:         AcksAll,
+	}
+	if cfg == nil {
+		return p, nil
+	}
+
+	ve := &ValidationError{}
+
+	switch cfg.Balancer {
+	case "":
+	case BalancerHash, BalancerRoundRobin, BalancerLeastBytes:
+		p.balancer = cfg.Balancer
+	default:
+		ve.add("/producer/balancer", "unknown balancer: %v", cfg.Balancer)
+	}
+
+	switch {
+	case cfg.BatchSize < 0:
+		ve.add("/producer/batchSize", "must be positive")
+	case cfg.BatchSize > 0:
+		p.batchSize = cfg.BatchSize
+	}
+
+	if cfg.BatchTimeout != "" {
+		d, err := time.ParseDuration(cfg.BatchTimeout)
+		switch {
+		case err != nil:
+			ve.add("/producer/batchTimeout", "invalid duration: %v", cfg.BatchTimeout)
+		case d <= 0:
+			ve.add("/producer/batchTimeout", "must be positive")
+		default:
+			p.batchTimeout = d
+		}
+	}
+
+	if cfg.Compression != "" {
+		if _, ok := compressionCodecs[cfg.Compression]; !ok {
+			ve.add("/producer/compression", "unknown compression: %v", cfg.Compression)
+		}
+		p.compression = cfg.Compression
+	}
+
+	if cfg.Acks != "" {
+		if _, ok := requiredAcks[cfg.Acks]; !ok {
+			ve.add("/producer/acks", "unknown acks: %v", cfg.Acks)
+		} else if cfg.Acks != AcksAll && delivery == DeliveryExactlyOnce {
+			ve.add("/producer/acks", "must be %v for %v delivery", AcksAll, DeliveryExactlyOnce)
+		}
+		p.acks = cfg.Acks
+	}
+
+	return p, ve.err()
+}
+
+// outbound - исходное сообщение результата. Передается writer в
+// kafka.Message.WriterData и доступно балансировщику и обработчику записи.
+type outbound struct {
+	src kafka.Message
+}
+
+// writer создает асинхронный producer для topicTo. Результат записи
+// передается в completion.
+func (p producerConfig) writer(kafkaURL, topic string, completion func([]kafka.Message, error)) *kafka.Writer {
+	w := &kafka.Writer{
+		Addr:         kafka.TCP(kafkaURL),
+		Topic:        topic,
+		BatchSize:    p.batchSize,
+		BatchTimeout: p.batchTimeout,
+		Compression:  compressionCodecs[p.compression],
+		RequiredAcks: requiredAcks[p.acks],
+		Async:        true,
+		Completion:   completion,
+	}
+
+	switch p.balancer {
+	case BalancerRoundRobin:
+		w.Balancer = &kafka.RoundRobin{}
+	case BalancerLeastBytes:
+		w.Balancer = &kafka.LeastBytes{}
+	default:
+		w.Balancer = &keyBalancer{}
+	}
+
+	return w
+}
+
+// kgoOpts возвращает те же параметры для транзакционного producer.
+// Размер пачки franz-go ограничивает в байтах, batchSize не используется.
+func (p producerConfig) kgoOpts() []kgo.Opt {
+	var codec kgo.CompressionCodec
+	switch p.compression {
+	case "gzip":
+		codec = kgo.GzipCompression()
+	case "snappy":
+		codec = kgo.SnappyCompression()
+	case "lz4":
+		codec = kgo.Lz4Compression()
+	case "zstd":
+		codec = kgo.ZstdCompression()
+	default:
+		codec = kgo.NoCompression()
+	}
+
+	var partitioner kgo.Partitioner
+	switch p.balancer {
+	case BalancerRoundRobin:
+		partitioner = kgo.RoundRobinPartitioner()
+	case BalancerLeastBytes:
+		partitioner = kgo.LeastBackupPartitioner()
+	default:
+		partitioner = kgo.BasicConsistentPartitioner(func(string) func(*kgo.Record, int) int {
+			return (&keyBalancer{}).partition
+		})
+	}
+
+	return []kgo.Opt{
+		kgo.RecordPartitioner(partitioner),
+		kgo.ProducerLinger(p.batchTimeout),
+		kgo.ProducerBatchCompression(codec),
+	}
+}
+
+// keyBalancer выбирает партицию результата по хэшу ключа сообщения (по умолчанию
+// поле entity, см. envelope.key), поэтому сообщения с одним ключом попадают в одну
+// партицию по порядку. Результаты без ключа и остальные сообщения, например
+// недоставленные события, распределяются по кругу.
+type keyBalancer struct {
+	hash kafka.Hash
+	rr   atomic.Uint32
+}
+
+func (b *keyBalancer) Balance(msg kafka.Message, partitions ...int) int {
+	if out, _ := msg.WriterData.(*outbound); out == nil || msg.Key == nil {
+		return partitions[int(b.rr.Add(1)-1)%len(partitions)]
+	}
+
+	return b.hash.Balance(kafka.Message{Key: msg.Key}, partitions...)
+}
+
+// partition выбирает партицию записи franz-go из n так же, как Balance.
+func (b *keyBalancer) partition(r *kgo.Record, n int) int {
+	if !isResult(r) || r.Key == nil {
+		return int(b.rr.Add(1)-1) % n
+	}
+
+	partitions := make([]int, n)
+	for i := range partitions {
+		partitions[i] = i
+	}
+
+	return b.hash.Balance(kafka.Message{Key: r.Key}, partitions...)
+}
+
+type resultKey struct{}
+
+// markResult отмечает запись результата для балансировщика franz-go.
+func markResult(r *kgo.Record, msg kafka.Message) {
+	if out, _ := msg.WriterData.(*outbound); out != nil {
+		r.Context = context.WithValue(context.Background(), resultKey{}, true)
+	}
+}
+
+func isResult(r *kgo.Record) bool {
+	if r.Context == nil {
+		return false
+	}
+
+	ok, _ := r.Context.Value(resultKey{}).(bool)
+	return ok
+}
@@ -0,0 +1,227 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dedpnd/unifier/internal/models"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+	"go.uber.org/zap"
+)
+
+func Test_compileProducer(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      *models.Producer
+		delivery string
+		want     producerConfig
+		wantErr  []FieldError
+	}{
+		{
+			name: "Defaults",
+			want: producerConfig{balancer: BalancerHash, batchSize: 100, batchTimeout: 10 * time.Millisecond, compression: "none", acks: AcksAll},
+		},
+		{
+			name: "All options",
+			cfg:  &models.Producer{Balancer: BalancerLeastBytes, BatchSize: 500, BatchTimeout: "1s", Compression: "zstd", Acks: AcksOne},
+			want: producerConfig{balancer: BalancerLeastBytes, batchSize: 500, batchTimeout: time.Second, compression: "zstd", acks: AcksOne},
+		},
+		{
+			name: "Invalid options",
+			cfg:  &models.Producer{Balancer: "random", BatchSize: -1, BatchTimeout: "soon", Compression: "brotli", Acks: "two"},
+			wantErr: []FieldError{
+				{Pointer: "/producer/balancer", Message: "unknown balancer: random"},
+				{Pointer: "/producer/batchSize", Message: "must be positive"},
+				{Pointer: "/producer/batchTimeout", Message: "invalid duration: soon"},
+				{Pointer: "/producer/compression", Message: "unknown compression: brotli"},
+				{Pointer: "/producer/acks", Message: "unknown acks: two"},
+			},
+		},
+		{
+			name:     "Exactly once requires all acks",
+			cfg:      &models.Producer{Acks: AcksNone},
+			delivery: DeliveryExactlyOnce,
+			wantErr:  []FieldError{{Pointer: "/producer/acks", Message: "must be all for exactly_once delivery"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := compileProducer(tt.cfg, tt.delivery)
+			if tt.wantErr != nil {
+				var ve *ValidationError
+				assert.ErrorAs(t, err, &ve)
+				assert.Equal(t, tt.wantErr, ve.Errors)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestKeyBalancer(t *testing.T) {
+	b := &keyBalancer{}
+	partitions := []int{0, 1, 2, 3}
+
+	msg := func(key string) kafka.Message {
+		return kafka.Message{Key: []byte(key), WriterData: &outbound{}}
+	}
+
+	// Один ключ всегда попадает в одну партицию, в обоих producer
+	for _, key := range []string{"a", "b", "c", "d41d8cd98f00b204e9800998ecf8427e"} {
+		p := b.Balance(msg(key), partitions...)
+		assert.Equal(t, p, b.Balance(msg(key), partitions...))
+
+		r := &kgo.Record{Key: []byte(key)}
+		markResult(r, msg(key))
+		assert.Equal(t, p, b.partition(r, len(partitions)))
+	}
+
+	// Результаты без ключа и недоставленные события распределяются по кругу
+	var got []int
+	for i := 0; i < 3; i++ {
+		got = append(got, b.Balance(kafka.Message{WriterData: &outbound{}}, partitions...))
+	}
+	for i := 0; i < 2; i++ {
+		got = append(got, b.Balance(kafka.Message{Key: []byte("a")}, partitions...))
+	}
+	assert.Equal(t, []int{0, 1, 2, 3, 0}, got)
+	assert.Equal(t, 1, b.partition(&kgo.Record{Key: []byte("a")}, len(partitions)))
+}
+
+func TestRunner_completed(t *testing.T) {
+	f := &fakeCommitter{offsets: make(map[int]int64)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := &runner{
+		wrk:  &workerEntity{ID: "1", state: newWorkerState(), stats: newWorkerStats()},
+		lg:   zap.NewNop(),
+		fail: failure{cancel: cancel},
+	}
+	w.acks = newInflight(context.Background(), newCommitter(f, 1), 10, w.fail.set)
+
+	src := []kafka.Message{{Partition: 0, Offset: 1}, {Partition: 0, Offset: 2}}
+	for i, m := range src {
+		m, err := w.acks.add(context.Background(), m)
+		assert.NoError(t, err)
+		w.acks.retain(m)
+		w.acks.release(m)
+		src[i] = m
+	}
+
+	w.completed([]kafka.Message{{WriterData: &outbound{src: src[0]}}}, nil)
+	offsets, _ := f.state()
+	assert.Equal(t, map[int]int64{0: 1}, offsets)
+	assert.Equal(t, int64(1), w.wrk.stats.emitted.Load())
+
+	// Ошибка записи останавливает воркер при любой политике, смещение не продвигается
+	w.completed([]kafka.Message{{WriterData: &outbound{src: src[1]}}}, errors.New("broker is down"))
+	assert.Error(t, w.fail.get())
+	assert.Error(t, ctx.Err())
+	offsets, _ = f.state()
+	assert.Equal(t, map[int]int64{0: 1}, offsets)
+}
+
+// closerFunc закрывает fake producer.
+type closerFunc func() error
+
+func (f closerFunc) Close() error { return f() }
+
+func Test_closeWriter(t *testing.T) {
+	assert.NoError(t, closeWriter(context.Background(), closerFunc(func() error { return nil })))
+
+	// Недоступный брокер не блокирует остановку дольше контекста записи
+	block := make(chan struct{})
+	defer close(block)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := closeWriter(ctx, closerFunc(func() error {
+		<-block
+		return nil
+	}))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestStart_AtLeastOnce(t *testing.T) {
+	addr := kafkaBroker(t)
+
+	cl, err := kgo.NewClient(kgo.SeedBrokers(addr))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer cl.Close()
+
+	createTopics(t, cl, 1, "alo-in")
+	createTopics(t, cl, 3, "alo-out")
+
+	rule, err := CompileRule(models.Config{
+		TopicFrom:  "alo-in",
+		TopicTo:    "alo-out",
+		EntityHash: []string{"user"},
+		Unifier:    []models.Unifier{{Name: "user", Type: "string", Expression: "user"}},
+		Producer:   &models.Producer{Compression: "lz4"},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	const events = 30
+	for i := 0; i < events; i++ {
+		value := fmt.Sprintf(`{"user": "u%d"}`, i%5)
+		assert.NoError(t, cl.ProduceSync(context.Background(), &kgo.Record{Topic: "alo-in", Value: []byte(value)}).FirstErr())
+	}
+
+	wrk := &workerEntity{ID: "alo", state: newWorkerState(), stats: newWorkerStats()}
+	wrk.rule.Store(rule)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Start(ctx, addr, DefaultCommit, wrk, zap.NewNop())
+	}()
+
+	records := readRecords(t, addr, "alo-out", events)
+	cancel()
+	assert.NoError(t, <-done)
+	assert.Len(t, records, events)
+
+	// События одной сущности попадают в одну партицию
+	entities := make(map[string]int32)
+	used := make(map[int32]bool)
+	for _, r := range records {
+		var doc map[string]string
+		assert.NoError(t, json.Unmarshal(r.Value, &doc))
+
+		if p, ok := entities[doc["entity"]]; ok {
+			assert.Equal(t, p, r.Partition)
+		}
+		entities[doc["entity"]] = r.Partition
+		used[r.Partition] = true
+	}
+	assert.Len(t, entities, 5)
+	assert.Greater(t, len(used), 1)
+
+	// При остановке подтверждены все обработанные сообщения
+	req := kmsg.NewPtrOffsetFetchRequest()
+	req.Group = "alo"
+	rt := kmsg.NewOffsetFetchRequestTopic()
+	rt.Topic = "alo-in"
+	rt.Partitions = []int32{0}
+	req.Topics = append(req.Topics, rt)
+
+	resp, err := req.RequestWith(context.Background(), cl)
+	if assert.NoError(t, err) && assert.Len(t, resp.Topics, 1) {
+		assert.Equal(t, int64(events), resp.Topics[0].Partitions[0].Offset)
+	}
+	assert.Equal(t, int64(events), wrk.stats.emitted.Load())
+}
@@ -0,0 +1,351 @@
+package worker
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/dedpnd/unifier/internal/models"
+)
+
+// Rule - правило унификации, подготовленное к обработке событий.
+// Фильтр, пути к полям и аргументы функций разбираются один раз при создании.
+type Rule struct {
+	config     models.Config
+	parse      parser
+	rawFilter  *regexp.Regexp
+	filter     *filterNode
+	extract    []extractor
+	entityHash []Path
+	unifier    []unifierField
+	extra      []extraFunc
+	encode     encoder
+	producer   producerConfig
+	envelope   envelope
+	lanes      lanesConfig
+	onError    models.OnError
+	delivery   string
+	// version - версия правила в хранилище для метаданных результата
+	version int
+}
+
+// Result - результат обработки одного события.
+type Result struct {
+	// Matched - событие прошло фильтр
+	Matched bool
+	// Event - унифицированное событие
+	Event map[string]interface{}
+	// Errors - ошибки преобразования полей, не прерывающие обработку
+	Errors []error
+}
+
+type unifierField struct {
+	models.Unifier
+	path    Path
+	convert converter
+}
+
+type extraFunc struct {
+	models.ExtraProcess
+	fn   Func
+	args []interface{}
+}
+
+// CompileRule проверяет конфигурацию правила и подготавливает ее к работе.
+// Ошибка имеет тип *ValidationError и содержит все найденные проблемы.
+func CompileRule(cfg models.Config) (*Rule, error) {
+	r := &Rule{config: cfg}
+	ve := &ValidationError{}
+
+	// Устаревший regexp верхнего уровня проверяется до разбора сообщения
+	filter := cfg.Filter
+	if filter.Regexp != "" {
+		re, err := regexp.Compile(filter.Regexp)
+		if err != nil {
+			ve.add("/filter/regexp", "invalid regexp: %v", err)
+		}
+		r.rawFilter = re
+		filter.Regexp = ""
+	}
+
+	var err error
+	r.parse, err = compileFormat(cfg.Format)
+	ve.merge(err)
+
+	r.filter, err = compileFilter(filter)
+	ve.merge(err)
+
+	r.extract, err = compileExtract(cfg.Extract)
+	ve.merge(err)
+
+	r.entityHash, err = compileEntityHash(cfg.EntityHash)
+	ve.merge(err)
+
+	r.unifier, err = compileUnifier(cfg.Unifier)
+	ve.merge(err)
+
+	r.extra, err = compileExtraProcess(cfg.ExtraProcess)
+	ve.merge(err)
+
+	r.encode, err = compileOutput(cfg.Output)
+	ve.merge(err)
+
+	r.onError, err = compileOnError(cfg.OnError, cfg.TopicFrom)
+	ve.merge(err)
+
+	r.delivery, err = compileDelivery(cfg.Delivery)
+	ve.merge(err)
+
+	r.producer, err = compileProducer(cfg.Producer, r.delivery)
+	ve.merge(err)
+
+	r.envelope, err = compileEnvelope(cfg.Envelope, cfg.Output)
+	ve.merge(err)
+
+	r.lanes, err = compileConcurrency(cfg.Concurrency)
+	ve.merge(err)
+
+	if err := ve.err(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Config возвращает исходную конфигурацию правила.
+func (r *Rule) Config() models.Config {
+	return r.config
+}
+
+// OnError возвращает политику обработки ошибок с подставленными значениями по умолчанию.
+func (r *Rule) OnError() models.OnError {
+	return r.onError
+}
+
+// SetVersion задает версию правила в хранилище. Вызывается до передачи правила воркеру.
+func (r *Rule) SetVersion(version int) {
+	r.version = version
+}
+
+// Version возвращает версию правила в хранилище.
+func (r *Rule) Version() int {
+	return r.version
+}
+
+// Delivery возвращает гарантию доставки с подставленным значением по умолчанию.
+func (r *Rule) Delivery() string {
+	return r.delivery
+}
+
+// Encode кодирует унифицированное событие в формате секции output.
+// Несоответствие схеме возвращается как ошибка события.
+func (r *Rule) Encode(event map[string]interface{}) ([]byte, error) {
+	return r.encode(event)
+}
+
+// sameEndpoints сообщает, что правила используют одни и те же соединения с kafka.
+func (r *Rule) sameEndpoints(o *Rule) bool {
+	return r.config.TopicFrom == o.config.TopicFrom &&
+		r.config.TopicTo == o.config.TopicTo &&
+		r.onError.Policy == o.onError.Policy &&
+		r.onError.Topic == o.onError.Topic &&
+		r.delivery == o.delivery &&
+		r.producer == o.producer &&
+		r.lanes == o.lanes
+}
+
+// Process прогоняет сообщение через фильтр, извлечение полей, вычисление хэша, унификацию
+// полей и дополнительную обработку. Ошибка возвращается, только если
+// сообщение не удалось разобрать.
+func (r *Rule) Process(raw []byte) (Result, error) {
+	if r.rawFilter != nil && !r.rawFilter.Match(raw) {
+		return Result{}, nil
+	}
+
+	pEvent, err := r.parse(raw)
+	if err != nil {
+		return Result{}, err
+	}
+
+	if !r.filter.Match(raw, pEvent) {
+		return Result{}, nil
+	}
+
+	res := Result{
+		Matched: true,
+		Event:   make(map[string]interface{}),
+	}
+
+	// Извлечение полей шаблонами, результат доступен хэшу и унификации
+	res.Errors = append(res.Errors, extractFields(pEvent, r.extract)...)
+
+	// Вычисляем уникальных идентификатор для записи
+	res.Event["entity"] = calculateHash(pEvent, r.entityHash)
+
+	// Унификация полей
+	res.Errors = append(res.Errors, unificationFields(pEvent, r.unifier, res.Event)...)
+
+	// Допольнительная обработка
+	res.Errors = append(res.Errors, extraProcess(r.extra, res.Event)...)
+
+	return res, nil
+}
+
+func compileEntityHash(cfgEntHash []string) ([]Path, error) {
+	ve := &ValidationError{}
+
+	paths := make([]Path, 0, len(cfgEntHash))
+	for i, eh := range cfgEntHash {
+		p, err := ParsePath(eh)
+		if err != nil {
+			ve.add(fmt.Sprintf("/entityHash/%d", i), "%v", err)
+			continue
+		}
+		paths = append(paths, p)
+	}
+
+	return paths, ve.err()
+}
+
+func compileUnifier(cfgUnifier []models.Unifier) ([]unifierField, error) {
+	ve := &ValidationError{}
+	names := make(map[string]bool, len(cfgUnifier))
+
+	fields := make([]unifierField, 0, len(cfgUnifier))
+	for i, u := range cfgUnifier {
+		ptr := fmt.Sprintf("/unifier/%d", i)
+
+		switch {
+		case u.Name == "":
+			ve.add(ptr+"/name", "is required")
+		case names[u.Name]:
+			ve.add(ptr+"/name", "duplicate name: %v", u.Name)
+		}
+		names[u.Name] = true
+
+		conv, ok := converters[u.Type]
+		if !ok {
+			ve.add(ptr+"/type", "unknown type: %v", u.Type)
+		}
+
+		if u.Timestamp != nil {
+			if u.Type == "timestamp" {
+				conv = compileTimestamp(u.Timestamp, ptr+"/timestamp", ve).convert
+			} else {
+				ve.add(ptr+"/timestamp", "allowed only for timestamp type")
+			}
+		}
+
+		p, err := ParsePath(u.Expression)
+		if err != nil {
+			ve.add(ptr+"/expression", "invalid expression: %v", err)
+		}
+
+		fields = append(fields, unifierField{Unifier: u, path: p, convert: conv})
+	}
+
+	return fields, ve.err()
+}
+
+func compileExtraProcess(cfgExtraProcess []models.ExtraProcess) ([]extraFunc, error) {
+	ve := &ValidationError{}
+
+	funcs := make([]extraFunc, 0, len(cfgExtraProcess))
+	for i, ep := range cfgExtraProcess {
+		ptr := fmt.Sprintf("/extraProcess/%d", i)
+
+		f, ok := LookupFunc(ep.Func)
+		if !ok {
+			ve.add(ptr+"/func", "unknown func: %v", ep.Func)
+			continue
+		}
+
+		args, err := f.ParseArgs(ep.Args)
+		if err != nil {
+			ve.add(ptr+"/args", "func %v: %v", ep.Func, err)
+		}
+
+		if !f.NoResult && ep.To == "" {
+			ve.add(ptr+"/to", "is required")
+		}
+
+		funcs = append(funcs, extraFunc{ExtraProcess: ep, fn: f, args: args})
+	}
+
+	return funcs, ve.err()
+}
+
+func extraProcess(funcs []extraFunc, uEvent map[string]interface{}) []error {
+	var errs []error
+	for _, ef := range funcs {
+		r, err := ef.fn.Call(uEvent, ef.args)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("func %v: %w", ef.Func, err))
+			continue
+		}
+
+		if !ef.fn.NoResult && r != nil {
+			uEvent[ef.To] = r
+		}
+	}
+
+	return errs
+}
+
+func unificationFields(event map[string]interface{}, fields []unifierField, uEvent map[string]interface{}) []error {
+	var errs []error
+	for _, u := range fields {
+		v, found := u.path.Get(event)
+		if !found {
+			continue
+		}
+
+		if v == nil {
+			continue
+		}
+
+		cv, ok, err := u.convert(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unifier %v: %w", u.Name, err))
+			continue
+		}
+
+		if ok {
+			uEvent[u.Name] = cv
+		}
+	}
+
+	return errs
+}
+
+func calculateHash(event map[string]interface{}, paths []Path) string {
+	strHash := ""
+	for _, path := range paths {
+		v, found := path.Get(event)
+		if !found {
+			continue
+		}
+
+		if vs, ok := v.([]interface{}); ok && path.Multi() {
+			for _, e := range vs {
+				if s, ok := e.(string); ok {
+					strHash += strings.TrimSpace(s)
+				}
+			}
+			continue
+		}
+
+		s, ok := v.(string)
+		if ok {
+			strHash += strings.TrimSpace(s)
+		}
+	}
+
+	// Вычисляем хэш
+	hash := md5.Sum([]byte(strHash))
+	hexStr := hex.EncodeToString(hash[:])
+
+	return hexStr
+}
@@ -0,0 +1,188 @@
+package worker
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/dedpnd/unifier/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// Правило из начальной миграции.
+//
+//nolint:lll // This legal size
+const seedRule = `{"topicFrom":"events","filter":{"regexp":"\"dstHost.ip\": \"10.10.10.10\""},"entityHash":["srcHost.ip","dstHost.port"],"unifier":[{"name":"id","type":"string","expression":"auditEventLog"},{"name":"date","type":"timestamp","expression":"datetime"},{"name":"ipaddr","type":"string","expression":"srcHost.ip"},{"name":"category","type":"string","expression":"cat"}],"extraProcess":[{"func":"__if","args":"category, /Host/Connect/Host/Accept, high","to":"category"},{"func":"__stringConstant","args":"test","to":"customString1"}],"topicTo":"test"}`
+
+func parseConfig(t testing.TB, s string) models.Config {
+	t.Helper()
+
+	var cfg models.Config
+	if err := json.Unmarshal([]byte(s), &cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	return cfg
+}
+
+func TestCompileRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     string
+		wantErr bool
+	}{
+		{name: "Seed rule", cfg: seedRule},
+		{name: "Empty rule", cfg: `{}`},
+		{name: "Invalid regexp", cfg: `{"filter": {"regexp": "["}}`, wantErr: true},
+		{name: "Invalid nested filter", cfg: `{"filter": {"and": [{"field": "ip", "cidr": "x"}]}}`, wantErr: true},
+		{name: "Invalid entity hash path", cfg: `{"entityHash": ["a..b"]}`, wantErr: true},
+		{name: "Unknown unifier type", cfg: `{"unifier": [{"name": "a", "type": "x", "expression": "a"}]}`, wantErr: true},
+		{name: "Invalid unifier expression", cfg: `{"unifier": [{"name": "a", "type": "string", "expression": ""}]}`, wantErr: true},
+		{name: "Unknown func", cfg: `{"extraProcess": [{"func": "__x", "args": "a", "to": "b"}]}`, wantErr: true},
+		{name: "__if with two args", cfg: `{"extraProcess": [{"func": "__if", "args": "a, b", "to": "c"}]}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := CompileRule(parseConfig(t, tt.cfg))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CompileRule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRule_Process(t *testing.T) {
+	rule, err := CompileRule(parseConfig(t, seedRule))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		raw     string
+		matched bool
+		want    map[string]interface{}
+		errs    int
+		wantErr bool
+	}{
+		{
+			name:    "Event must be unified",
+			raw:     `{"dstHost.ip": "10.10.10.10", "srcHost.ip": "1.1.1.1", "dstHost.port": "443", "auditEventLog": "x", "datetime": "2023-07-13T13:47:43+00:00", "cat": "/Host/Connect/Host/Accept"}`,
+			matched: true,
+			want: map[string]interface{}{
+				"entity":        "7dbdf7c8e423356a0357d661a03e78ac",
+				"id":            "x",
+				"date":          "2023-07-13T13:47:43Z",
+				"ipaddr":        "1.1.1.1",
+				"category":      "high",
+				"customString1": "test",
+			},
+		},
+		{
+			name:    "Conversion errors must be collected",
+			raw:     `{"dstHost.ip": "10.10.10.10", "datetime": "yesterday"}`,
+			matched: true,
+			want: map[string]interface{}{
+				"entity":        "d41d8cd98f00b204e9800998ecf8427e",
+				"category":      "",
+				"customString1": "test",
+			},
+			errs: 1,
+		},
+		{
+			name: "Event must be filtered",
+			raw:  `{"dstHost.ip": "192.168.0.1"}`,
+		},
+		{
+			name:    "Invalid JSON should return an error",
+			raw:     `{"dstHost.ip": "10.10.10.10"`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := rule.Process([]byte(tt.raw))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Process() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			assert.Equal(t, tt.matched, res.Matched)
+			assert.Equal(t, tt.want, res.Event)
+			assert.Len(t, res.Errors, tt.errs)
+		})
+	}
+}
+
+func TestRule_DryRun(t *testing.T) {
+	rule, err := CompileRule(parseConfig(t, seedRule))
+	assert.NoError(t, err)
+
+	res := rule.DryRun([]byte(`{"dstHost.ip": "10.10.10.10", "datetime": "yesterday"}`))
+	assert.True(t, res.Matched)
+	assert.Equal(t, "test", res.Output["customString1"])
+	assert.Len(t, res.Errors, 1)
+
+	res = rule.DryRun([]byte(`{"dstHost.ip": "192.168.0.1"}`))
+	assert.Equal(t, DryRunResult{}, res)
+
+	res = rule.DryRun([]byte(`{"dstHost.ip": "10.10.10.10"`))
+	assert.False(t, res.Matched)
+	assert.Len(t, res.Errors, 1)
+}
+
+// Набор событий для нагрузочного теста kafka-perf-test.
+func loadExampleEvents(b *testing.B) [][]byte {
+	b.Helper()
+
+	f, err := os.Open("../../../kafka-perf-test/scripts/example.json")
+	if err != nil {
+		b.Skip(err)
+	}
+	defer f.Close()
+
+	var events [][]byte
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 1024*1024), 1024*1024)
+	for sc.Scan() {
+		if len(sc.Bytes()) != 0 {
+			events = append(events, append([]byte(nil), sc.Bytes()...))
+		}
+	}
+
+	return events
+}
+
+// Правило компилируется один раз, как в воркере.
+func BenchmarkRule_Process(b *testing.B) {
+	events := loadExampleEvents(b)
+	cfg := parseConfig(b, seedRule)
+
+	rule, err := CompileRule(cfg)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := rule.Process(events[i%len(events)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Правило разбирается на каждое сообщение, как было до компиляции правил.
+func BenchmarkRule_ProcessRecompile(b *testing.B) {
+	events := loadExampleEvents(b)
+	cfg := parseConfig(b, seedRule)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rule, err := CompileRule(cfg)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := rule.Process(events[i%len(events)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
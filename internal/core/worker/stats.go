@@ -0,0 +1,122 @@
+package worker
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Status - состояние и счетчики воркера.
+type Status struct {
+	ID        string    `json:"id"`
+	State     string    `json:"state"`
+	LastError string    `json:"lastError,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+	Restarts  int       `json:"restarts"`
+	Consumed  int64     `json:"consumed"`
+	Matched   int64     `json:"matched"`
+	Emitted   int64     `json:"emitted"`
+	Errored   int64     `json:"errored"`
+	// Lag - отставание консьюмера по партициям
+	Lag map[int]int64 `json:"lag"`
+}
+
+// workerStats - счетчики обработки сообщений воркером.
+type workerStats struct {
+	consumed atomic.Int64
+	matched  atomic.Int64
+	emitted  atomic.Int64
+	errored  atomic.Int64
+
+	mu  sync.Mutex
+	lag map[int]int64
+}
+
+func newWorkerStats() *workerStats {
+	return &workerStats{lag: make(map[int]int64)}
+}
+
+// setLag запоминает и возвращает отставание партиции по последнему прочитанному сообщению.
+func (s *workerStats) setLag(partition int, offset, highWaterMark int64) int64 {
+	lag := highWaterMark - offset - 1
+	if lag < 0 {
+		lag = 0
+	}
+
+	s.mu.Lock()
+	s.lag[partition] = lag
+	s.mu.Unlock()
+
+	return lag
+}
+
+func (s *workerStats) fill(st *Status) {
+	st.Consumed = s.consumed.Load()
+	st.Matched = s.matched.Load()
+	st.Emitted = s.emitted.Load()
+	st.Errored = s.errored.Load()
+
+	s.mu.Lock()
+	st.Lag = make(map[int]int64, len(s.lag))
+	for p, l := range s.lag {
+		st.Lag[p] = l
+	}
+	s.mu.Unlock()
+}
+
+func (w *workerEntity) status() Status {
+	st := Status{ID: w.ID}
+
+	state, restarts, startedAt, lastErr := w.state.snapshot()
+	st.State = state
+	st.Restarts = restarts
+	st.StartedAt = startedAt
+	if lastErr != nil {
+		st.LastError = lastErr.Error()
+	}
+
+	w.stats.fill(&st)
+
+	return st
+}
+
+// Status возвращает состояние воркера правила.
+func (p *Pool) Status(id string) (Status, bool) {
+	p.mu.RLock()
+	wrk, ok := p.p[id]
+	p.mu.RUnlock()
+
+	if !ok {
+		return Status{}, false
+	}
+
+	return wrk.status(), true
+}
+
+// Statuses возвращает состояние всех воркеров, упорядоченное по ID правила.
+func (p *Pool) Statuses() []Status {
+	p.mu.RLock()
+	workers := make([]*workerEntity, 0, len(p.p))
+	for _, wrk := range p.p {
+		workers = append(workers, wrk)
+	}
+	p.mu.RUnlock()
+
+	res := make([]Status, 0, len(workers))
+	for _, wrk := range workers {
+		res = append(res, wrk.status())
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		a, errA := strconv.Atoi(res[i].ID)
+		b, errB := strconv.Atoi(res[j].ID)
+		if errA == nil && errB == nil {
+			return a < b
+		}
+		return res[i].ID < res[j].ID
+	})
+
+	return res
+}
@@ -0,0 +1,52 @@
+package worker
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestPool_Status(t *testing.T) {
+	p := newPool(unreachableKafka, zap.NewNop(), DefaultBackoff, DefaultCommit)
+
+	for _, id := range []string{"10", "2", "1"} {
+		p.p[id] = &workerEntity{
+			ID:    id,
+			state: newWorkerState(),
+			stats: newWorkerStats(),
+		}
+	}
+
+	wrk := p.p["2"]
+	wrk.state.set(StateRunning, nil)
+	wrk.state.set(StateRestarting, errors.New("failed read message"))
+	wrk.stats.consumed.Add(10)
+	wrk.stats.matched.Add(4)
+	wrk.stats.emitted.Add(3)
+	wrk.stats.errored.Add(1)
+	wrk.stats.setLag(0, 5, 10)
+	wrk.stats.setLag(1, 9, 10)
+
+	st, ok := p.Status("2")
+	assert.True(t, ok)
+	assert.Equal(t, StateRestarting, st.State)
+	assert.Equal(t, "failed read message", st.LastError)
+	assert.Equal(t, 1, st.Restarts)
+	assert.False(t, st.StartedAt.IsZero())
+	assert.Equal(t, int64(10), st.Consumed)
+	assert.Equal(t, int64(4), st.Matched)
+	assert.Equal(t, int64(3), st.Emitted)
+	assert.Equal(t, int64(1), st.Errored)
+	assert.Equal(t, map[int]int64{0: 4, 1: 0}, st.Lag)
+
+	_, ok = p.Status("5")
+	assert.False(t, ok)
+
+	var ids []string
+	for _, st := range p.Statuses() {
+		ids = append(ids, st.ID)
+	}
+	assert.Equal(t, []string{"1", "2", "10"}, ids)
+}
@@ -0,0 +1,313 @@
+package worker
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"regexp"
+	"strings"
+)
+
+// Стандартная библиотека функций extraProcess.
+//
+//nolint:funlen // Регистрация всех функций в одном месте
+func init() {
+	mustRegisterFunc("__if", Func{
+		Args: []ArgSpec{
+			{Name: "field", Kind: ArgField},
+			{Name: "value", Kind: ArgString},
+			{Name: "result", Kind: ArgString},
+		},
+		Call: fnIf,
+	})
+	mustRegisterFunc("__stringConstant", Func{
+		Args: []ArgSpec{
+			{Name: "value", Kind: ArgString},
+			// Как и до реестра функций, значение - первый аргумент, остальные не используются
+			{Name: "ignored", Kind: ArgString, Optional: true, Variadic: true},
+		},
+		Call: fnStringConstant,
+	})
+	mustRegisterFunc("__lowercase", Func{
+		Args: []ArgSpec{{Name: "field", Kind: ArgField}},
+		Call: stringFunc(strings.ToLower),
+	})
+	mustRegisterFunc("__uppercase", Func{
+		Args: []ArgSpec{{Name: "field", Kind: ArgField}},
+		Call: stringFunc(strings.ToUpper),
+	})
+	mustRegisterFunc("__trim", Func{
+		Args: []ArgSpec{
+			{Name: "field", Kind: ArgField},
+			{Name: "cutset", Kind: ArgString, Optional: true},
+		},
+		Call: fnTrim,
+	})
+	mustRegisterFunc("__regexReplace", Func{
+		Args: []ArgSpec{
+			{Name: "field", Kind: ArgField},
+			{Name: "pattern", Kind: ArgRegexp},
+			{Name: "replacement", Kind: ArgString},
+		},
+		Call: fnRegexReplace,
+	})
+	mustRegisterFunc("__regexExtract", Func{
+		Args: []ArgSpec{
+			{Name: "field", Kind: ArgField},
+			{Name: "pattern", Kind: ArgRegexp},
+			{Name: "group", Kind: ArgInt, Optional: true},
+		},
+		Call: fnRegexExtract,
+	})
+	mustRegisterFunc("__concat", Func{
+		Args: []ArgSpec{
+			{Name: "separator", Kind: ArgString},
+			{Name: "field", Kind: ArgField, Variadic: true},
+		},
+		Call: fnConcat,
+	})
+	mustRegisterFunc("__split", Func{
+		Args: []ArgSpec{
+			{Name: "field", Kind: ArgField},
+			{Name: "separator", Kind: ArgString},
+		},
+		Call: fnSplit,
+	})
+	mustRegisterFunc("__substring", Func{
+		Args: []ArgSpec{
+			{Name: "field", Kind: ArgField},
+			{Name: "start", Kind: ArgInt},
+			{Name: "end", Kind: ArgInt, Optional: true},
+		},
+		Call: fnSubstring,
+	})
+	mustRegisterFunc("__coalesce", Func{
+		Args: []ArgSpec{{Name: "field", Kind: ArgField, Variadic: true}},
+		Call: fnCoalesce,
+	})
+	mustRegisterFunc("__default", Func{
+		Args: []ArgSpec{
+			{Name: "field", Kind: ArgField},
+			{Name: "value", Kind: ArgString},
+		},
+		Call: fnDefault,
+	})
+	mustRegisterFunc("__hash", Func{
+		Args: []ArgSpec{
+			{Name: "algorithm", Kind: ArgString, Enum: []string{"md5", "sha256"}},
+			{Name: "field", Kind: ArgField, Variadic: true},
+		},
+		Call: fnHash,
+	})
+	mustRegisterFunc("__delete", Func{
+		Args:     []ArgSpec{{Name: "field", Kind: ArgField, Variadic: true}},
+		Call:     fnDelete,
+		NoResult: true,
+	})
+}
+
+// Значение поля в виде строки. Объекты и массивы строкой не считаются.
+func fieldString(uEvent map[string]interface{}, field string) (string, bool) {
+	v, ok := uEvent[field]
+	if !ok || v == nil {
+		return "", false
+	}
+
+	switch vv := v.(type) {
+	case string:
+		return vv, true
+	case map[string]interface{}, []interface{}:
+		return "", false
+	default:
+		return fmt.Sprint(vv), true
+	}
+}
+
+func stringFunc(fn func(string) string) FuncCall {
+	return func(uEvent map[string]interface{}, args []interface{}) (interface{}, error) {
+		s, ok := fieldString(uEvent, args[0].(string))
+		if !ok {
+			return nil, nil
+		}
+
+		return fn(s), nil
+	}
+}
+
+func fnIf(uEvent map[string]interface{}, args []interface{}) (interface{}, error) {
+	field, stmn, result := args[0].(string), args[1].(string), args[2].(string)
+
+	s, ok := fieldString(uEvent, field)
+	if ok && s == stmn {
+		return result, nil
+	}
+
+	return "", nil
+}
+
+func fnStringConstant(_ map[string]interface{}, args []interface{}) (interface{}, error) {
+	return args[0].(string), nil
+}
+
+func fnTrim(uEvent map[string]interface{}, args []interface{}) (interface{}, error) {
+	s, ok := fieldString(uEvent, args[0].(string))
+	if !ok {
+		return nil, nil
+	}
+
+	if len(args) > 1 {
+		return strings.Trim(s, args[1].(string)), nil
+	}
+
+	return strings.TrimSpace(s), nil
+}
+
+func fnRegexReplace(uEvent map[string]interface{}, args []interface{}) (interface{}, error) {
+	s, ok := fieldString(uEvent, args[0].(string))
+	if !ok {
+		return nil, nil
+	}
+
+	re := args[1].(*regexp.Regexp)
+	return re.ReplaceAllString(s, args[2].(string)), nil
+}
+
+func fnRegexExtract(uEvent map[string]interface{}, args []interface{}) (interface{}, error) {
+	s, ok := fieldString(uEvent, args[0].(string))
+	if !ok {
+		return nil, nil
+	}
+
+	re := args[1].(*regexp.Regexp)
+
+	// По умолчанию берем первую группу, если она есть
+	group := 0
+	if re.NumSubexp() > 0 {
+		group = 1
+	}
+	if len(args) > 2 {
+		group = args[2].(int)
+	}
+
+	if group < 0 || group > re.NumSubexp() {
+		return nil, fmt.Errorf("group %d out of range, pattern has %d groups", group, re.NumSubexp())
+	}
+
+	m := re.FindStringSubmatch(s)
+	if m == nil {
+		return nil, nil
+	}
+
+	return m[group], nil
+}
+
+func fnConcat(uEvent map[string]interface{}, args []interface{}) (interface{}, error) {
+	sep := args[0].(string)
+
+	parts := make([]string, 0, len(args)-1)
+	for _, a := range args[1:] {
+		if s, ok := fieldString(uEvent, a.(string)); ok {
+			parts = append(parts, s)
+		}
+	}
+
+	if len(parts) == 0 {
+		return nil, nil
+	}
+
+	return strings.Join(parts, sep), nil
+}
+
+func fnSplit(uEvent map[string]interface{}, args []interface{}) (interface{}, error) {
+	s, ok := fieldString(uEvent, args[0].(string))
+	if !ok {
+		return nil, nil
+	}
+
+	parts := strings.Split(s, args[1].(string))
+
+	res := make([]interface{}, len(parts))
+	for i, p := range parts {
+		res[i] = p
+	}
+
+	return res, nil
+}
+
+func fnSubstring(uEvent map[string]interface{}, args []interface{}) (interface{}, error) {
+	s, ok := fieldString(uEvent, args[0].(string))
+	if !ok {
+		return nil, nil
+	}
+
+	r := []rune(s)
+
+	start := args[1].(int)
+	end := len(r)
+	if len(args) > 2 {
+		end = args[2].(int)
+	}
+
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("invalid range [%d:%d]", start, end)
+	}
+
+	// Границы за пределами строки обрезаются
+	if start > len(r) {
+		start = len(r)
+	}
+	if end > len(r) {
+		end = len(r)
+	}
+
+	return string(r[start:end]), nil
+}
+
+func fnCoalesce(uEvent map[string]interface{}, args []interface{}) (interface{}, error) {
+	for _, a := range args {
+		v, ok := uEvent[a.(string)]
+		if ok && v != nil && v != "" {
+			return v, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func fnDefault(uEvent map[string]interface{}, args []interface{}) (interface{}, error) {
+	v, ok := uEvent[args[0].(string)]
+	if ok && v != nil && v != "" {
+		return v, nil
+	}
+
+	return args[1].(string), nil
+}
+
+func fnHash(uEvent map[string]interface{}, args []interface{}) (interface{}, error) {
+	var h hash.Hash
+	switch args[0].(string) {
+	case "sha256":
+		h = sha256.New()
+	default:
+		h = md5.New()
+	}
+
+	// Длина перед каждым значением не дает ("a", "bc") и ("ab", "c") совпасть.
+	// Отсутствующее поле считается пустой строкой, позиции полей сохраняются
+	for _, a := range args[1:] {
+		s, _ := fieldString(uEvent, a.(string))
+		fmt.Fprintf(h, "%d:%s", len(s), s)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func fnDelete(uEvent map[string]interface{}, args []interface{}) (interface{}, error) {
+	for _, a := range args {
+		delete(uEvent, a.(string))
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,154 @@
+package worker
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/dedpnd/unifier/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// Состояния воркера.
+const (
+	StateStarting   = "starting"
+	StateRunning    = "running"
+	StateRestarting = "restarting"
+	StateFailed     = "failed"
+	StateStopped    = "stopped"
+)
+
+// Backoff - параметры перезапуска упавшего воркера.
+type Backoff struct {
+	// Initial - задержка перед первым перезапуском
+	Initial time.Duration
+	// Max - максимальная задержка, воркер проработавший дольше считается стабильным
+	Max time.Duration
+	// Multiplier - множитель задержки для каждой следующей попытки
+	Multiplier float64
+	// Jitter - доля случайного отклонения задержки от 0 до 1
+	Jitter float64
+	// MaxRestarts - число попыток подряд, после которого правило помечается как failed,
+	// 0 - перезапускать без ограничений
+	MaxRestarts int
+}
+
+// DefaultBackoff - параметры перезапуска по умолчанию.
+var DefaultBackoff = Backoff{
+	Initial:     time.Second,
+	Max:         time.Minute,
+	Multiplier:  2,
+	Jitter:      0.2,
+	MaxRestarts: 5,
+}
+
+// Delay возвращает задержку перед попыткой перезапуска с номером attempt, начиная с 0.
+func (b Backoff) Delay(attempt int) time.Duration {
+	d := float64(b.Initial) * math.Pow(b.Multiplier, float64(attempt))
+	if d > float64(b.Max) || math.IsInf(d, 0) {
+		d = float64(b.Max)
+	}
+
+	if b.Jitter > 0 {
+		//nolint:gosec // Криптостойкость для разброса задержки не нужна
+		d *= 1 - b.Jitter + 2*b.Jitter*rand.Float64()
+	}
+
+	return time.Duration(d)
+}
+
+// workerState - состояние воркера под управлением супервизора.
+type workerState struct {
+	mu        sync.RWMutex
+	state     string
+	restarts  int
+	lastError error
+	startedAt time.Time
+}
+
+func newWorkerState() *workerState {
+	return &workerState{state: StateStarting}
+}
+
+func (s *workerState) set(state string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state = state
+	if state == StateRunning {
+		s.startedAt = time.Now()
+	}
+	if err != nil {
+		s.lastError = err
+	}
+	if state == StateRestarting {
+		s.restarts++
+	}
+}
+
+// State возвращает текущее состояние, число перезапусков и последнюю ошибку.
+func (s *workerState) State() (string, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.state, s.restarts, s.lastError
+}
+
+func (s *workerState) snapshot() (string, int, time.Time, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.state, s.restarts, s.startedAt, s.lastError
+}
+
+// supervise запускает воркер и перезапускает его после ошибок с экспоненциальной
+// задержкой. После MaxRestarts неудачных попыток подряд воркер помечается как failed.
+// Воркер останавливается отменой контекста.
+func supervise(ctx context.Context, run func(ctx context.Context) error, b Backoff, st *workerState,
+	id string, lg *zap.Logger) {
+	attempt := 0
+	for {
+		st.set(StateRunning, nil)
+
+		started := time.Now()
+		err := run(ctx)
+		if err == nil || ctx.Err() != nil {
+			st.set(StateStopped, nil)
+			return
+		}
+
+		// Воркер проработал достаточно долго, считаем сбой новым
+		if time.Since(started) > b.Max {
+			attempt = 0
+		}
+
+		if b.MaxRestarts > 0 && attempt >= b.MaxRestarts {
+			st.set(StateFailed, err)
+			lg.With(zap.Error(err)).Error("Worker failed", zap.String("ID", id), zap.Int("attempts", attempt))
+
+			return
+		}
+
+		delay := b.Delay(attempt)
+		attempt++
+
+		st.set(StateRestarting, err)
+		metrics.WorkerRestarts.WithLabelValues(id).Inc()
+		lg.With(zap.Error(err)).Warn("Worker restart",
+			zap.String("ID", id),
+			zap.Int("attempt", attempt),
+			zap.Duration("delay", delay),
+		)
+
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			st.set(StateStopped, nil)
+			return
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestBackoff_Delay(t *testing.T) {
+	b := Backoff{Initial: 100 * time.Millisecond, Max: time.Second, Multiplier: 2}
+
+	assert.Equal(t, 100*time.Millisecond, b.Delay(0))
+	assert.Equal(t, 400*time.Millisecond, b.Delay(2))
+	assert.Equal(t, time.Second, b.Delay(10))
+	assert.Equal(t, time.Second, b.Delay(5000))
+
+	b.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := b.Delay(1)
+		assert.GreaterOrEqual(t, d, 100*time.Millisecond)
+		assert.LessOrEqual(t, d, 300*time.Millisecond)
+	}
+}
+
+func Test_supervise(t *testing.T) {
+	b := Backoff{Initial: time.Millisecond, Max: 10 * time.Millisecond, Multiplier: 2, MaxRestarts: 3}
+	errRun := errors.New("kafka unavailable")
+
+	t.Run("Worker must be marked as failed", func(t *testing.T) {
+		var runs int32
+		st := newWorkerState()
+
+		supervise(context.Background(), func(context.Context) error {
+			atomic.AddInt32(&runs, 1)
+			return errRun
+		}, b, st, "1", zap.NewNop())
+
+		state, restarts, lastErr := st.State()
+		assert.Equal(t, StateFailed, state)
+		assert.Equal(t, 3, restarts)
+		assert.Equal(t, errRun, lastErr)
+		assert.Equal(t, int32(4), atomic.LoadInt32(&runs))
+	})
+
+	t.Run("Worker must be restarted", func(t *testing.T) {
+		var runs int32
+		st := newWorkerState()
+
+		supervise(context.Background(), func(context.Context) error {
+			if atomic.AddInt32(&runs, 1) < 3 {
+				return errRun
+			}
+			return nil
+		}, b, st, "1", zap.NewNop())
+
+		state, restarts, lastErr := st.State()
+		assert.Equal(t, StateStopped, state)
+		assert.Equal(t, 2, restarts)
+		assert.Equal(t, errRun, lastErr)
+	})
+
+	t.Run("Worker must be stopped while waiting restart", func(t *testing.T) {
+		st := newWorkerState()
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+
+		go func() {
+			supervise(ctx, func(context.Context) error {
+				return errRun
+			}, Backoff{Initial: time.Hour, Max: time.Hour, Multiplier: 2}, st, "1", zap.NewNop())
+			close(done)
+		}()
+
+		assert.Eventually(t, func() bool {
+			state, _, _ := st.State()
+			return state == StateRestarting
+		}, time.Second, time.Millisecond)
+
+		cancel()
+		<-done
+
+		state, _, _ := st.State()
+		assert.Equal(t, StateStopped, state)
+	})
+
+	t.Run("Cancelled worker must not be restarted", func(t *testing.T) {
+		var runs int32
+		st := newWorkerState()
+		ctx, cancel := context.WithCancel(context.Background())
+
+		supervise(ctx, func(context.Context) error {
+			atomic.AddInt32(&runs, 1)
+			cancel()
+			return context.Canceled
+		}, b, st, "1", zap.NewNop())
+
+		state, restarts, _ := st.State()
+		assert.Equal(t, StateStopped, state)
+		assert.Equal(t, 0, restarts)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&runs))
+	})
+}
@@ -0,0 +1,209 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Метка порядка байтов перед сообщением RFC 5424 в UTF-8.
+const utf8BOM = "\uFEFF"
+
+var errSyslogPriority = errors.New("invalid syslog parse: no priority")
+
+// parseSyslog разбирает сообщение syslog. Версия протокола после приоритета
+// означает RFC 5424, иначе сообщение разбирается по RFC 3164.
+// Время сохраняется строкой и приводится к типу timestamp при унификации.
+func parseSyslog(raw []byte) (map[string]interface{}, error) {
+	s := strings.TrimRight(string(raw), "\r\n")
+
+	if !strings.HasPrefix(s, "<") {
+		return nil, errSyslogPriority
+	}
+
+	end := strings.IndexByte(s, '>')
+	if end < 2 || end > 4 {
+		return nil, errSyslogPriority
+	}
+
+	pri, err := strconv.Atoi(s[1:end])
+	if err != nil || pri > 191 {
+		return nil, errSyslogPriority
+	}
+
+	event := map[string]interface{}{
+		"priority": pri,
+		"facility": pri / 8,
+		"severity": pri % 8,
+	}
+
+	s = s[end+1:]
+
+	if v, rest, ok := strings.Cut(s, " "); ok && v != "" && isDigits(v) {
+		version, _ := strconv.Atoi(v)
+		event["version"] = version
+
+		if err := parseSyslog5424(rest, event); err != nil {
+			return nil, fmt.Errorf("invalid syslog parse: %w", err)
+		}
+		return event, nil
+	}
+
+	parseSyslog3164(s, event)
+
+	return event, nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseSyslog5424: TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG.
+// Значения "-" не записываются.
+func parseSyslog5424(s string, event map[string]interface{}) error {
+	for _, name := range []string{"timestamp", "hostname", "appName", "procId", "msgId"} {
+		v, rest, ok := strings.Cut(s, " ")
+		if !ok {
+			return fmt.Errorf("no %v", name)
+		}
+		s = rest
+
+		if v != "-" {
+			event[name] = v
+		}
+	}
+
+	if strings.HasPrefix(s, "-") {
+		s = s[1:]
+	} else {
+		sd, rest, err := parseStructuredData(s)
+		if err != nil {
+			return err
+		}
+		event["structuredData"] = sd
+		s = rest
+	}
+
+	if msg := strings.TrimPrefix(strings.TrimPrefix(s, " "), utf8BOM); msg != "" {
+		event["message"] = msg
+	}
+
+	return nil
+}
+
+// parseStructuredData разбирает элементы [id name="value" ...] в объект
+// id -> name -> value и возвращает остаток строки.
+func parseStructuredData(s string) (map[string]interface{}, string, error) {
+	sd := make(map[string]interface{})
+
+	for strings.HasPrefix(s, "[") {
+		s = s[1:]
+
+		i := strings.IndexAny(s, " ]")
+		if i <= 0 {
+			return nil, "", errors.New("invalid structured data id")
+		}
+
+		params := make(map[string]interface{})
+		sd[s[:i]] = params
+		s = s[i:]
+
+		for strings.HasPrefix(s, " ") {
+			name, rest, ok := strings.Cut(s[1:], "=")
+			if !ok || name == "" || !strings.HasPrefix(rest, `"`) {
+				return nil, "", errors.New("invalid structured data param")
+			}
+
+			v, rest, err := readSDValue(rest)
+			if err != nil {
+				return nil, "", fmt.Errorf("structured data param %v: %w", name, err)
+			}
+
+			params[name] = v
+			s = rest
+		}
+
+		if !strings.HasPrefix(s, "]") {
+			return nil, "", errors.New("unterminated structured data element")
+		}
+		s = s[1:]
+	}
+
+	return sd, s, nil
+}
+
+// readSDValue читает значение в кавычках, в котором экранируются только
+// символы '"', '\' и ']'.
+func readSDValue(s string) (string, string, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && strings.IndexByte(`"\]`, s[i+1]) >= 0:
+			i++
+			b.WriteByte(s[i])
+		case s[i] == '"':
+			return b.String(), s[i+1:], nil
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+
+	return "", "", errors.New("unterminated quote")
+}
+
+// parseSyslog3164: Mmm dd hh:mm:ss HOSTNAME TAG[PID]: MSG. Если заголовок
+// не распознан, вся строка считается сообщением.
+func parseSyslog3164(s string, event map[string]interface{}) {
+	if len(s) > len(time.Stamp) && s[len(time.Stamp)] == ' ' {
+		if _, err := time.Parse(time.Stamp, s[:len(time.Stamp)]); err == nil {
+			event["timestamp"] = s[:len(time.Stamp)]
+
+			if host, rest, ok := strings.Cut(s[len(time.Stamp)+1:], " "); ok && host != "" {
+				event["hostname"] = host
+				s = parseSyslogTag(rest, event)
+			}
+		}
+	}
+
+	if s != "" {
+		event["message"] = s
+	}
+}
+
+// parseSyslogTag выделяет TAG и PID и возвращает сообщение.
+func parseSyslogTag(s string, event map[string]interface{}) string {
+	i := strings.IndexAny(s, "[: ")
+	if i <= 0 {
+		return s
+	}
+
+	tag, rest := s[:i], s[i:]
+
+	var pid string
+	if strings.HasPrefix(rest, "[") {
+		j := strings.IndexByte(rest, ']')
+		if j < 0 {
+			return s
+		}
+		pid, rest = rest[1:j], rest[j+1:]
+	}
+
+	if !strings.HasPrefix(rest, ":") {
+		return s
+	}
+
+	event["appName"] = tag
+	if pid != "" {
+		event["procId"] = pid
+	}
+
+	return strings.TrimPrefix(rest[1:], " ")
+}
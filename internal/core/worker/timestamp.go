@@ -0,0 +1,260 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dedpnd/unifier/internal/models"
+
+	// База часовых поясов встраивается, чтобы не зависеть от образа
+	_ "time/tzdata"
+)
+
+// Форматы времени в виде числа от начала эпохи Unix.
+const (
+	EpochS  = "epoch_s"
+	EpochMS = "epoch_ms"
+	EpochNS = "epoch_ns"
+)
+
+// Имена распространенных раскладок.
+var timeLayouts = map[string]string{
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"RFC850":      time.RFC850,
+	"ANSIC":       time.ANSIC,
+	"UnixDate":    time.UnixDate,
+	"DateTime":    time.DateTime,
+	"syslog":      time.Stamp,
+	"syslogMilli": time.StampMilli,
+}
+
+// Точность результата и число знаков дробной части для RFC3339.
+var timePrecisions = map[string]struct {
+	unit   time.Duration
+	layout string
+}{
+	"s":  {time.Second, time.RFC3339},
+	"ms": {time.Millisecond, "2006-01-02T15:04:05.000Z07:00"},
+	"us": {time.Microsecond, "2006-01-02T15:04:05.000000Z07:00"},
+	"ns": {time.Nanosecond, "2006-01-02T15:04:05.000000000Z07:00"},
+}
+
+// timestampFormat - скомпилированные настройки типа timestamp.
+type timestampFormat struct {
+	formats []string
+	loc     *time.Location
+	output  string
+	outLoc  *time.Location
+	unit    time.Duration
+	// now - текущее время, для определения года в форматах без года
+	now func() time.Time
+}
+
+var defaultTimestamp = &timestampFormat{
+	formats: []string{time.RFC3339},
+	loc:     time.UTC,
+	output:  time.RFC3339,
+	outLoc:  time.UTC,
+	unit:    time.Second,
+	now:     time.Now,
+}
+
+// compileTimestamp проверяет настройки времени. Ошибки добавляются в ve
+// с указателем ptr.
+func compileTimestamp(cfg *models.Timestamp, ptr string, ve *ValidationError) *timestampFormat {
+	if cfg == nil {
+		return defaultTimestamp
+	}
+
+	tf := *defaultTimestamp
+
+	if len(cfg.Formats) != 0 {
+		tf.formats = make([]string, 0, len(cfg.Formats))
+		for i, f := range cfg.Formats {
+			if f == "" {
+				ve.add(fmt.Sprintf("%v/formats/%d", ptr, i), "is empty")
+				continue
+			}
+			tf.formats = append(tf.formats, layoutByName(f))
+		}
+	}
+
+	var err error
+	if tf.loc, err = loadLocation(cfg.Timezone); err != nil {
+		ve.add(ptr+"/timezone", "%v", err)
+	}
+	if tf.outLoc, err = loadLocation(cfg.OutputTimezone); err != nil {
+		ve.add(ptr+"/outputTimezone", "%v", err)
+	}
+
+	// По умолчанию точность совпадает с единицей вывода epoch_*, иначе секунды
+	precision := cfg.Precision
+	if precision == "" {
+		switch cfg.Output {
+		case EpochMS:
+			precision = "ms"
+		case EpochNS:
+			precision = "ns"
+		default:
+			precision = "s"
+		}
+	}
+
+	p, ok := timePrecisions[precision]
+	if !ok {
+		ve.add(ptr+"/precision", "unknown precision: %v, expected s, ms, us or ns", cfg.Precision)
+	}
+	tf.unit = p.unit
+
+	tf.output = p.layout
+	if cfg.Output != "" {
+		tf.output = layoutByName(cfg.Output)
+	}
+
+	return &tf
+}
+
+func layoutByName(name string) string {
+	if l, ok := timeLayouts[name]; ok {
+		return l
+	}
+
+	return name
+}
+
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone: %w", err)
+	}
+
+	return loc, nil
+}
+
+// convert разбирает значение по первому подходящему формату и приводит
+// результат к часовому поясу и формату вывода.
+func (tf *timestampFormat) convert(v interface{}) (interface{}, bool, error) {
+	t, err := tf.parse(v)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return tf.format(t), true, nil
+}
+
+func (tf *timestampFormat) parse(v interface{}) (time.Time, error) {
+	var s string
+	switch vv := v.(type) {
+	case string:
+		s = strings.TrimSpace(vv)
+	case json.Number:
+		s = vv.String()
+	case float64:
+		s = strconv.FormatFloat(vv, 'f', -1, 64)
+	case int:
+		s = strconv.Itoa(vv)
+	default:
+		return time.Time{}, errConvert(v, "timestamp")
+	}
+
+	for _, f := range tf.formats {
+		switch f {
+		case EpochS:
+			if t, ok := parseEpoch(s, time.Second); ok {
+				return t, nil
+			}
+		case EpochMS:
+			if t, ok := parseEpoch(s, time.Millisecond); ok {
+				return t, nil
+			}
+		case EpochNS:
+			if t, ok := parseEpoch(s, time.Nanosecond); ok {
+				return t, nil
+			}
+		default:
+			t, err := time.ParseInLocation(f, s, tf.loc)
+			if err != nil {
+				continue
+			}
+			return tf.fillYear(s, t)
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("failed date parse: %q does not match formats %v", s, tf.formats)
+}
+
+// fillYear подставляет год для форматов без года, например syslog.
+// Время из будущего считается прошлогодним. Дата, которой нет в выбранном
+// году, например 29 февраля, не принимается.
+func (tf *timestampFormat) fillYear(s string, t time.Time) (time.Time, error) {
+	if t.Year() != 0 {
+		return t, nil
+	}
+
+	now := tf.now().In(t.Location())
+	res := withYear(t, now.Year())
+	if res.After(now.Add(24 * time.Hour)) {
+		res = withYear(t, now.Year()-1)
+	}
+
+	// time.Date переносит несуществующую дату на следующий день
+	if res.Day() != t.Day() {
+		return time.Time{}, fmt.Errorf("failed date parse: %q does not exist in %v", s, res.Year())
+	}
+
+	return res, nil
+}
+
+func withYear(t time.Time, year int) time.Time {
+	return time.Date(year, t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
+
+// parseEpoch разбирает целое или дробное число единиц от начала эпохи.
+func parseEpoch(s string, unit time.Duration) (time.Time, bool) {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if unit != time.Nanosecond && (i > math.MaxInt64/int64(unit) || i < math.MinInt64/int64(unit)) {
+			return time.Time{}, false
+		}
+		return time.Unix(0, 0).Add(time.Duration(i) * unit), true
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return time.Time{}, false
+	}
+
+	ns := f * float64(unit)
+	if ns > math.MaxInt64 || ns < math.MinInt64 {
+		return time.Time{}, false
+	}
+
+	return time.Unix(0, int64(ns)), true
+}
+
+func (tf *timestampFormat) format(t time.Time) interface{} {
+	t = t.In(tf.outLoc).Truncate(tf.unit)
+
+	switch tf.output {
+	case EpochS:
+		return t.Unix()
+	case EpochMS:
+		return t.UnixMilli()
+	case EpochNS:
+		return t.UnixNano()
+	default:
+		return t.Format(tf.output)
+	}
+}
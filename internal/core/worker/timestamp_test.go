@@ -0,0 +1,135 @@
+package worker
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/dedpnd/unifier/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_timestampFormat_convert(t *testing.T) {
+	now := time.Date(2024, time.January, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		cfg     *models.Timestamp
+		v       interface{}
+		want    interface{}
+		wantErr bool
+	}{
+		{name: "Default RFC3339 in UTC", v: "2023-07-13T16:47:43+03:00", want: "2023-07-13T13:47:43Z"},
+		{name: "Default rejects epoch", v: json.Number("1689256063"), wantErr: true},
+		{
+			name: "Epoch seconds",
+			cfg:  &models.Timestamp{Formats: []string{EpochS}},
+			v:    json.Number("1689256063"),
+			want: "2023-07-13T13:47:43Z",
+		},
+		{
+			name: "Epoch milliseconds with precision",
+			cfg:  &models.Timestamp{Formats: []string{EpochMS}, Precision: "ms"},
+			v:    "1689256063123",
+			want: "2023-07-13T13:47:43.123Z",
+		},
+		{
+			name: "Fractional epoch seconds",
+			cfg:  &models.Timestamp{Formats: []string{EpochS}, Precision: "ms"},
+			v:    json.Number("1689256063.5"),
+			want: "2023-07-13T13:47:43.500Z",
+		},
+		{
+			name: "Epoch nanoseconds to epoch milliseconds",
+			cfg:  &models.Timestamp{Formats: []string{EpochNS}, Output: EpochMS},
+			v:    json.Number("1689256063123456789"),
+			want: int64(1689256063123),
+		},
+		{
+			name: "First matching format",
+			cfg:  &models.Timestamp{Formats: []string{"RFC3339", "2006-01-02 15:04:05"}},
+			v:    "2023-07-13 13:47:43",
+			want: "2023-07-13T13:47:43Z",
+		},
+		{
+			name: "Source timezone",
+			cfg:  &models.Timestamp{Formats: []string{"DateTime"}, Timezone: "Europe/Moscow"},
+			v:    "2023-07-13 16:47:43",
+			want: "2023-07-13T13:47:43Z",
+		},
+		{
+			name: "Output timezone and layout",
+			cfg:  &models.Timestamp{OutputTimezone: "Europe/Moscow", Output: "DateTime"},
+			v:    "2023-07-13T13:47:43Z",
+			want: "2023-07-13 16:47:43",
+		},
+		{
+			name: "Syslog without year",
+			cfg:  &models.Timestamp{Formats: []string{"syslog"}},
+			v:    "Jan  2 15:04:05",
+			want: "2024-01-02T15:04:05Z",
+		},
+		{
+			name: "Syslog from last year",
+			cfg:  &models.Timestamp{Formats: []string{"syslog"}},
+			v:    "Dec 31 23:59:59",
+			want: "2023-12-31T23:59:59Z",
+		},
+		{
+			name: "Syslog after February from last year",
+			cfg:  &models.Timestamp{Formats: []string{"syslog"}},
+			v:    "Mar  1 00:00:00",
+			want: "2023-03-01T00:00:00Z",
+		},
+		{
+			name:    "Syslog leap day in non-leap year",
+			cfg:     &models.Timestamp{Formats: []string{"syslog"}},
+			v:       "Feb 29 10:00:00",
+			wantErr: true,
+		},
+		{
+			name:    "No format matched",
+			cfg:     &models.Timestamp{Formats: []string{EpochS, "DateTime"}},
+			v:       "yesterday",
+			wantErr: true,
+		},
+		{name: "Object is not a timestamp", v: map[string]interface{}{}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ve := &ValidationError{}
+			tf := *compileTimestamp(tt.cfg, "", ve)
+			assert.NoError(t, ve.err())
+			tf.now = func() time.Time { return now }
+
+			got, _, err := tf.convert(tt.v)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("convert() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_compileTimestamp(t *testing.T) {
+	ve := &ValidationError{}
+	compileTimestamp(&models.Timestamp{
+		Formats:        []string{""},
+		Timezone:       "Mars/Olympus",
+		OutputTimezone: "UTC",
+		Precision:      "m",
+	}, "/unifier/0/timestamp", ve)
+
+	pointers := make([]string, 0, len(ve.Errors))
+	for _, fe := range ve.Errors {
+		pointers = append(pointers, fe.Pointer)
+	}
+
+	assert.Equal(t, []string{
+		"/unifier/0/timestamp/formats/0",
+		"/unifier/0/timestamp/timezone",
+		"/unifier/0/timestamp/precision",
+	}, pointers)
+}
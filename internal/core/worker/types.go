@@ -0,0 +1,202 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// converter приводит значение события к типу унификатора. Признак ok сообщает,
+// что значение нужно записать в событие. Значение null не записывается.
+type converter func(v interface{}) (interface{}, bool, error)
+
+// Типы полей унификатора.
+var converters = map[string]converter{
+	"string":    toStringType,
+	"int":       toIntType,
+	"float":     toFloatType,
+	"bool":      toBoolType,
+	"timestamp": toTimestampType,
+	"ip":        toIPType,
+	"mac":       toMACType,
+	"duration":  toDurationType,
+	"array":     toArrayType,
+	"object":    toObjectType,
+}
+
+func errConvert(v interface{}, typ string) error {
+	if s, ok := v.(string); ok {
+		return fmt.Errorf("cannot convert %q to %v", s, typ)
+	}
+
+	return fmt.Errorf("cannot convert %v (%T) to %v", v, v, typ)
+}
+
+// string: строки без изменений, числа и bool - в строковом виде.
+func toStringType(v interface{}) (interface{}, bool, error) {
+	switch vv := v.(type) {
+	case string:
+		return vv, true, nil
+	case json.Number:
+		return vv.String(), true, nil
+	case float64:
+		return strconv.FormatFloat(vv, 'f', -1, 64), true, nil
+	case int:
+		return strconv.Itoa(vv), true, nil
+	case bool:
+		return strconv.FormatBool(vv), true, nil
+	default:
+		return nil, false, errConvert(v, "string")
+	}
+}
+
+// int: целые числа и строки с целым числом. Дробная часть считается ошибкой.
+func toIntType(v interface{}) (interface{}, bool, error) {
+	switch vv := v.(type) {
+	case int:
+		return vv, true, nil
+	case json.Number:
+		if i, err := strconv.Atoi(vv.String()); err == nil {
+			return i, true, nil
+		}
+		f, err := vv.Float64()
+		if err != nil {
+			return nil, false, errConvert(v, "int")
+		}
+		return floatToInt(f)
+	case float64:
+		return floatToInt(vv)
+	case string:
+		i, err := strconv.Atoi(strings.TrimSpace(vv))
+		if err != nil {
+			return nil, false, errConvert(v, "int")
+		}
+		return i, true, nil
+	default:
+		return nil, false, errConvert(v, "int")
+	}
+}
+
+// floatToInt приводит целое число float64. 2^63 уже не помещается в int64,
+// а math.MaxInt64 при сравнении с float64 округляется до 2^63.
+func floatToInt(f float64) (interface{}, bool, error) {
+	if f != math.Trunc(f) || f >= 1<<63 || f < -1<<63 {
+		return nil, false, errConvert(f, "int")
+	}
+
+	return int(f), true, nil
+}
+
+// float: числа и строки с числом.
+func toFloatType(v interface{}) (interface{}, bool, error) {
+	f, ok := toFloat(v)
+	if !ok {
+		return nil, false, errConvert(v, "float")
+	}
+
+	return f, true, nil
+}
+
+// bool: true/false без учета регистра, а также 1 и 0 числом или строкой.
+func toBoolType(v interface{}) (interface{}, bool, error) {
+	switch vv := v.(type) {
+	case bool:
+		return vv, true, nil
+	case string:
+		switch strings.ToLower(strings.TrimSpace(vv)) {
+		case "true", "1":
+			return true, true, nil
+		case "false", "0":
+			return false, true, nil
+		}
+	case json.Number, float64, int:
+		switch f, _ := toFloat(vv); f {
+		case 1:
+			return true, true, nil
+		case 0:
+			return false, true, nil
+		}
+	}
+
+	return nil, false, errConvert(v, "bool")
+}
+
+// timestamp: строка в формате RFC3339, результат в UTC. Форматы
+// настраиваются в models.Timestamp.
+func toTimestampType(v interface{}) (interface{}, bool, error) {
+	return defaultTimestamp.convert(v)
+}
+
+// ip: IPv4 или IPv6 адрес в каноническом виде. IPv4, отображенный в IPv6,
+// приводится к IPv4.
+func toIPType(v interface{}) (interface{}, bool, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, false, errConvert(v, "ip")
+	}
+
+	addr, err := netip.ParseAddr(strings.TrimSpace(s))
+	if err != nil {
+		return nil, false, errConvert(v, "ip")
+	}
+
+	return addr.Unmap().String(), true, nil
+}
+
+// mac: MAC адрес в любом формате, поддерживаемом net.ParseMAC,
+// приводится к виду 00:00:5e:00:53:01.
+func toMACType(v interface{}) (interface{}, bool, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, false, errConvert(v, "mac")
+	}
+
+	mac, err := net.ParseMAC(strings.TrimSpace(s))
+	if err != nil {
+		return nil, false, errConvert(v, "mac")
+	}
+
+	return mac.String(), true, nil
+}
+
+// duration: строка в формате Go ("1h30m") или число секунд,
+// результат - строка в формате Go.
+func toDurationType(v interface{}) (interface{}, bool, error) {
+	if s, ok := v.(string); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(s))
+		if err == nil {
+			return d.String(), true, nil
+		}
+	}
+
+	f, ok := toFloat(v)
+	if !ok || math.IsInf(f, 0) || math.IsNaN(f) {
+		return nil, false, errConvert(v, "duration")
+	}
+
+	return time.Duration(f * float64(time.Second)).String(), true, nil
+}
+
+// array: массивы без изменений, остальные значения оборачиваются в массив.
+func toArrayType(v interface{}) (interface{}, bool, error) {
+	if a, ok := v.([]interface{}); ok {
+		return a, true, nil
+	}
+
+	return []interface{}{v}, true, nil
+}
+
+// object: объекты без изменений.
+func toObjectType(v interface{}) (interface{}, bool, error) {
+	o, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, false, errConvert(v, "object")
+	}
+
+	return o, true, nil
+}
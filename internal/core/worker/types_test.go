@@ -0,0 +1,108 @@
+package worker
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/dedpnd/unifier/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// Конвертеры проверяются в том виде, в котором их подготавливает compileUnifier.
+func Test_converters(t *testing.T) {
+	tests := []struct {
+		name    string
+		typ     string
+		v       interface{}
+		want    interface{}
+		wantErr bool
+	}{
+		{name: "Unknown type", typ: "uuid", v: "x", wantErr: true},
+		{name: "string", typ: "string", v: "abc", want: "abc"},
+		{name: "string from number", typ: "string", v: json.Number("443"), want: "443"},
+		{name: "string from bool", typ: "string", v: true, want: "true"},
+		{name: "string from object", typ: "string", v: map[string]interface{}{}, wantErr: true},
+		{name: "int from number", typ: "int", v: json.Number("9007199254740993"), want: 9007199254740993},
+		{name: "int from float number", typ: "int", v: json.Number("443.0"), want: 443},
+		{name: "int from fraction", typ: "int", v: json.Number("1.5"), wantErr: true},
+		{name: "int from float64", typ: "int", v: float64(443), want: 443},
+		{name: "int overflow", typ: "int", v: json.Number("9223372036854775808"), wantErr: true},
+		{name: "int overflow from float64", typ: "int", v: float64(1 << 63), wantErr: true},
+		{name: "int min from float64", typ: "int", v: float64(-1 << 63), want: math.MinInt64},
+		{name: "int from string", typ: "int", v: " 443 ", want: 443},
+		{name: "int from bad string", typ: "int", v: "https", wantErr: true},
+		{name: "int from bool", typ: "int", v: true, wantErr: true},
+		{name: "float from number", typ: "float", v: json.Number("0.25"), want: 0.25},
+		{name: "float from string", typ: "float", v: "1e3", want: float64(1000)},
+		{name: "float from bad string", typ: "float", v: "x", wantErr: true},
+		{name: "bool", typ: "bool", v: false, want: false},
+		{name: "bool from True", typ: "bool", v: "True", want: true},
+		{name: "bool from 0 string", typ: "bool", v: "0", want: false},
+		{name: "bool from 1", typ: "bool", v: json.Number("1"), want: true},
+		{name: "bool from 2", typ: "bool", v: json.Number("2"), wantErr: true},
+		{name: "bool from yes", typ: "bool", v: "yes", wantErr: true},
+		{name: "ip v4", typ: "ip", v: "10.0.0.1", want: "10.0.0.1"},
+		{name: "ip v6 canonical", typ: "ip", v: "2001:DB8:0:0:0:0:0:1", want: "2001:db8::1"},
+		{name: "ip v4 mapped", typ: "ip", v: "::ffff:10.0.0.1", want: "10.0.0.1"},
+		{name: "ip invalid", typ: "ip", v: "10.0.0.256", wantErr: true},
+		{name: "mac", typ: "mac", v: "00-00-5E-00-53-01", want: "00:00:5e:00:53:01"},
+		{name: "mac dotted", typ: "mac", v: "0000.5e00.5301", want: "00:00:5e:00:53:01"},
+		{name: "mac invalid", typ: "mac", v: "00:00", wantErr: true},
+		{name: "duration", typ: "duration", v: "90m", want: "1h30m0s"},
+		{name: "duration from seconds", typ: "duration", v: json.Number("1.5"), want: "1.5s"},
+		{name: "duration from seconds string", typ: "duration", v: "60", want: "1m0s"},
+		{name: "duration invalid", typ: "duration", v: "soon", wantErr: true},
+		{name: "array", typ: "array", v: []interface{}{"a"}, want: []interface{}{"a"}},
+		{name: "array from scalar", typ: "array", v: "a", want: []interface{}{"a"}},
+		{name: "object", typ: "object", v: map[string]interface{}{"a": "b"}, want: map[string]interface{}{"a": "b"}},
+		{name: "object from scalar", typ: "object", v: "a", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields, err := compileUnifier([]models.Unifier{{Name: "f", Type: tt.typ, Expression: "f"}})
+			if err == nil {
+				var got interface{}
+				var ok bool
+				got, ok, err = fields[0].convert(tt.v)
+				if err == nil {
+					assert.True(t, ok)
+					assert.Equal(t, tt.want, got)
+				}
+			}
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("convert() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("Null is not written", func(t *testing.T) {
+		rule, err := CompileRule(models.Config{Unifier: []models.Unifier{{Name: "f", Type: "int", Expression: "f"}}})
+		assert.NoError(t, err)
+
+		res, err := rule.Process([]byte(`{"f": null}`))
+		assert.NoError(t, err)
+		assert.Empty(t, res.Errors)
+		assert.NotContains(t, res.Event, "f")
+	})
+}
+
+func TestRule_ProcessNumbers(t *testing.T) {
+	rule, err := CompileRule(parseConfig(t, `{"unifier": [
+		{"name": "id", "type": "int", "expression": "id"},
+		{"name": "raw", "type": "object", "expression": "raw"}]}`))
+	assert.NoError(t, err)
+
+	res, err := rule.Process([]byte(`{"id": 9007199254740993, "raw": {"n": 1.5}}`))
+	assert.NoError(t, err)
+	assert.Empty(t, res.Errors)
+	assert.Equal(t, 9007199254740993, res.Event["id"])
+
+	out, err := json.Marshal(res.Event["raw"])
+	assert.NoError(t, err)
+	assert.Equal(t, `{"n":1.5}`, string(out))
+
+	_, err = rule.Process([]byte(`{"id": 1} {"id": 2}`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,96 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dedpnd/unifier/internal/models"
+)
+
+// FieldError - ошибка в поле правила. Pointer указывает на поле
+// в формате JSON Pointer (RFC 6901), например "/unifier/0/type".
+type FieldError struct {
+	Pointer string `json:"pointer"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Pointer + ": " + e.Message
+}
+
+// ValidationError - все ошибки, найденные в правиле.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		msgs = append(msgs, fe.Error())
+	}
+
+	return "invalid rule: " + strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) add(pointer, format string, args ...interface{}) {
+	e.Errors = append(e.Errors, FieldError{Pointer: pointer, Message: fmt.Sprintf(format, args...)})
+}
+
+// fieldError возвращает ошибку проверки с одним полем.
+func fieldError(pointer, format string, args ...interface{}) error {
+	ve := &ValidationError{}
+	ve.add(pointer, format, args...)
+	return ve
+}
+
+// merge добавляет ошибки вложенной проверки.
+func (e *ValidationError) merge(err error) {
+	if err == nil {
+		return
+	}
+
+	var ve *ValidationError
+	if errors.As(err, &ve) {
+		e.Errors = append(e.Errors, ve.Errors...)
+		return
+	}
+
+	e.add("", "%v", err)
+}
+
+// err возвращает nil, если ошибок нет.
+func (e *ValidationError) err() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+
+	return e
+}
+
+// ValidateRule компилирует правило и дополнительно проверяет то, что нужно
+// воркеру для запуска: заданные и различные топики.
+// Используется при сохранении правила, ошибка имеет тип *ValidationError.
+func ValidateRule(cfg models.Config) (*Rule, error) {
+	ve := &ValidationError{}
+
+	rule, err := CompileRule(cfg)
+	ve.merge(err)
+
+	if cfg.TopicFrom == "" {
+		ve.add("/topicFrom", "is required")
+	}
+
+	switch {
+	case cfg.TopicTo == "":
+		ve.add("/topicTo", "is required")
+	case cfg.TopicTo == cfg.TopicFrom:
+		ve.add("/topicTo", "must differ from topicFrom")
+	}
+
+	if err := ve.err(); err != nil {
+		return nil, err
+	}
+
+	return rule, nil
+}
@@ -0,0 +1,74 @@
+package worker
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateRule(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  string
+		want []FieldError
+	}{
+		{name: "Seed rule", cfg: seedRule},
+		{
+			name: "Empty topics",
+			cfg:  `{}`,
+			want: []FieldError{
+				{Pointer: "/topicFrom", Message: "is required"},
+				{Pointer: "/topicTo", Message: "is required"},
+			},
+		},
+		{
+			name: "Same topics",
+			cfg:  `{"topicFrom": "events", "topicTo": "events"}`,
+			want: []FieldError{{Pointer: "/topicTo", Message: "must differ from topicFrom"}},
+		},
+		{
+			name: "Unknown delivery",
+			cfg:  `{"topicFrom": "events", "topicTo": "test", "delivery": "at_most_once"}`,
+			want: []FieldError{{Pointer: "/delivery", Message: "unknown delivery: at_most_once"}},
+		},
+		{
+			name: "All errors are collected",
+			cfg: `{"topicFrom": "events", "topicTo": "test",
+				"filter": {"and": [{"field": "ip", "cidr": "x"}, {"not": {"eq": 1}}]},
+				"entityHash": ["ok", "a..b"],
+				"unifier": [{"name": "a", "type": "integer", "expression": "a"}, {"name": "a", "type": "string", "expression": "b"}],
+				"extraProcess": [{"func": "__nope"}, {"func": "__if", "args": "a, b", "to": "c"}, {"func": "__lowercase", "args": "a"}],
+				"onError": {"policy": "retry"}}`,
+			want: []FieldError{
+				{Pointer: "/filter/and/0/cidr", Message: "invalid cidr: invalid CIDR address: x"},
+				{Pointer: "/filter/and/1/not/field", Message: errFilterNoField.Error()},
+				{Pointer: "/entityHash/1", Message: `path "a..b": empty segment at 2`},
+				{Pointer: "/unifier/0/type", Message: "unknown type: integer"},
+				{Pointer: "/unifier/1/name", Message: "duplicate name: a"},
+				{Pointer: "/extraProcess/0/func", Message: "unknown func: __nope"},
+				{Pointer: "/extraProcess/1/args", Message: "func __if: expected at least 3 args, got 2"},
+				{Pointer: "/extraProcess/2/to", Message: "is required"},
+				{Pointer: "/onError/policy", Message: "unknown policy: retry"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := ValidateRule(parseConfig(t, tt.cfg))
+			if tt.want == nil {
+				assert.NoError(t, err)
+				assert.NotNil(t, rule)
+				return
+			}
+
+			var ve *ValidationError
+			if !errors.As(err, &ve) {
+				t.Fatalf("ValidateRule() error = %v, want *ValidationError", err)
+			}
+
+			assert.Nil(t, rule)
+			assert.Equal(t, tt.want, ve.Errors)
+		})
+	}
+}
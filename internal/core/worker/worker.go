@@ -2,221 +2,387 @@ package worker
 
 import (
 	"context"
-	"crypto/md5"
-	"encoding/hex"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"regexp"
-	"strconv"
-	"strings"
+	"io"
+	"sync"
 	"time"
 
-	"github.com/dedpnd/unifier/internal/models"
+	"github.com/dedpnd/unifier/internal/metrics"
 	"github.com/segmentio/kafka-go"
 	"go.uber.org/zap"
 )
 
-func Start(ctx context.Context, kafkaURL string, wrkConfig workerEntity, lg *zap.Logger) error {
-	var r *kafka.Reader
-	var p *kafka.Conn
+// runner - окружение воркера на время одного запуска.
+type runner struct {
+	wrk *workerEntity
+	// emit пишет результат в topicTo, deadLetter - событие в топик недоставленных
+	emit       func(kafka.Message) error
+	deadLetter func(kafka.Message) error
+	lg         *zap.Logger
+	// Контекст записи, отменяемый только через shutdownGrace после остановки воркера
+	wCtx context.Context
+	// acks - сообщения, результат которых записывается асинхронно
+	acks *inflight
+	fail failure
+}
+
+// failure - первая ошибка асинхронной записи, после которой воркер останавливается.
+type failure struct {
+	mu     sync.Mutex
+	err    error
+	cancel context.CancelFunc
+}
+
+func (f *failure) set(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.err == nil {
+		f.err = err
+		f.cancel()
+	}
+}
+
+func (f *failure) get() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.err
+}
+
+// shutdownGrace ограничивает запись накопленных результатов и подтверждение
+// смещений после остановки воркера.
+const shutdownGrace = 10 * time.Second
 
+// writeContext возвращает контекст записи, который не отменяется вместе с ctx,
+// чтобы обработанные сообщения успели записаться, но отменяется через
+// shutdownGrace после него, чтобы недоступный брокер не блокировал остановку.
+func writeContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	wCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-wCtx.Done():
+			return
+		}
+
+		t := time.NewTimer(shutdownGrace)
+		defer t.Stop()
+
+		select {
+		case <-t.C:
+			cancel()
+		case <-wCtx.Done():
+		}
+	}()
+
+	return wCtx, cancel
+}
+
+// Start читает сообщения из topicFrom, обрабатывает их правилом и пишет в topicTo.
+// Сообщения обрабатываются обработчиками секции concurrency, каждый сохраняет
+// порядок своих партиций или ключей.
+// Результаты пишутся асинхронно пачками, а смещение сообщения подтверждается
+// только после записи его результата с подтверждением брокера и всех предыдущих
+// сообщений партиции, поэтому доставка выполняется как минимум один раз: после
+// сбоя сообщения с последнего подтвержденного смещения обрабатываются повторно.
+// Отмена контекста останавливает воркер: текущее сообщение дообрабатывается,
+// накопленные результаты записываются, обработанные смещения подтверждаются,
+// соединения закрываются, возвращается nil. Запись после остановки ограничена
+// shutdownGrace.
+func Start(ctx context.Context, kafkaURL string, commit Commit, wrkConfig *workerEntity,
+	lg *zap.Logger) (err error) {
 	lg.Info("Worker start", zap.String("ID", wrkConfig.ID))
 
+	// Топики, политика ошибок, гарантия доставки и параметры записи не меняются
+	// без перезапуска воркера
+	rule := wrkConfig.rule.Load()
+	cfg := rule.Config()
+	onError := rule.OnError()
+
+	if rule.Delivery() == DeliveryExactlyOnce {
+		return startTransactional(ctx, kafkaURL, wrkConfig, lg)
+	}
+
+	// С acks one и none результат может быть потерян после подтверждения смещения
+	if rule.producer.acks != AcksAll {
+		lg.Warn("Producer acks weaken at-least-once delivery",
+			zap.String("ID", wrkConfig.ID), zap.String("acks", rule.producer.acks))
+	}
+
+	// Чтение останавливается и при ошибке асинхронной записи
+	fetchCtx, stopFetch := context.WithCancel(ctx)
+	defer stopFetch()
+
+	// Отсчет shutdownGrace начинается и после ошибки асинхронной записи
+	wCtx, stopWrite := writeContext(fetchCtx)
+	defer stopWrite()
+
+	w := &runner{
+		wrk:  wrkConfig,
+		lg:   lg,
+		wCtx: wCtx,
+		fail: failure{cancel: stopFetch},
+	}
+
 	// Создаем kafka consumer
-	r = kafka.NewReader(kafka.ReaderConfig{
+	r := kafka.NewReader(kafka.ReaderConfig{
 		Brokers: []string{kafkaURL},
 		GroupID: wrkConfig.ID,
-		Topic:   wrkConfig.Config.TopicFrom,
+		Topic:   cfg.TopicFrom,
 	})
+	// Закрываем соединения при любом завершении, чтобы перезапуск не оставлял
+	// лишних участников группы
+	defer func() {
+		if cErr := r.Close(); cErr != nil && err == nil {
+			err = fmt.Errorf("worker:%v - failed close consumer: %w", wrkConfig.ID, cErr)
+		}
+	}()
+
+	// Создаем producer для недоставленных событий. Событие записывается сразу,
+	// без ожидания пачки: запись блокирует обработчик и обработку результатов
+	if onError.Policy == PolicyDeadLetter {
+		dlq := &kafka.Writer{
+			Addr:         kafka.TCP(kafkaURL),
+			Topic:        onError.Topic,
+			RequiredAcks: kafka.RequireAll,
+			BatchSize:    1,
+			BatchTimeout: defaultBatchTimeout,
+		}
+		defer func() {
+			if cErr := dlq.Close(); cErr != nil && err == nil {
+				err = fmt.Errorf("worker:%v - failed close dead letter producer: %w", wrkConfig.ID, cErr)
+			}
+		}()
+		w.deadLetter = func(msg kafka.Message) error {
+			return dlq.WriteMessages(w.wCtx, msg)
+		}
+	}
 
-	// Создаем kafka producer
-	var err error
-	p, err = kafka.DialLeader(context.Background(), "tcp", kafkaURL, wrkConfig.Config.TopicTo, 0)
-	if err != nil {
-		return fmt.Errorf("worker:%v - failed create producer: %w", wrkConfig.ID, err)
+	// Смещения подтверждаются пачками и периодически. При остановке подтверждаются
+	// все обработанные сообщения, до закрытия консьюмера
+	cm := newCommitter(r, commit.Batch)
+	tickCtx, stopTick := context.WithCancel(ctx)
+	ticked := make(chan struct{})
+	go func() {
+		defer close(ticked)
+		cm.run(tickCtx, commit.Interval, wrkConfig.ID, lg)
+	}()
+	defer func() {
+		stopTick()
+		<-ticked
+
+		if cErr := cm.flush(w.wCtx); cErr != nil && err == nil {
+			err = fmt.Errorf("worker:%v - %w", wrkConfig.ID, cErr)
+		}
+	}()
+
+	// В работе одновременно не больше нескольких пачек producer
+	w.acks = newInflight(w.wCtx, cm, maxInFlight*rule.producer.batchSize, func(err error) {
+		w.fail.set(fmt.Errorf("worker:%v - %w", wrkConfig.ID, err))
+	})
+
+	// Создаем kafka producer. Закрытие дописывает накопленные пачки до
+	// подтверждения смещений
+	out := rule.producer.writer(kafkaURL, cfg.TopicTo, w.completed)
+	defer func() {
+		if cErr := closeWriter(w.wCtx, out); cErr != nil && err == nil {
+			err = fmt.Errorf("worker:%v - failed close producer: %w", wrkConfig.ID, cErr)
+		}
+		if fErr := w.fail.get(); fErr != nil && err == nil {
+			err = fErr
+		}
+	}()
+	w.emit = func(msg kafka.Message) error {
+		src := msg.WriterData.(*outbound).src
+
+		w.acks.retain(src)
+		if err := out.WriteMessages(w.wCtx, msg); err != nil {
+			w.acks.release(src)
+			return err
+		}
+
+		return nil
 	}
-	// Вычитываем сообщения
-	for {
-		select {
-		default:
-			msg, err := r.ReadMessage(ctx)
-			if err != nil {
-				return fmt.Errorf("worker:%v - failed read message: %w", wrkConfig.ID, err)
-			}
 
-			// Фильтруем событие по регулярному выражению
-			strMsg := string(msg.Value)
-			matched, err := regexp.Match(wrkConfig.Config.Filter.Regexp, []byte(strMsg))
-			if err != nil {
-				return fmt.Errorf("worker:%v - failed filter message: %w", wrkConfig.ID, err)
-			}
+	// Обработчики завершаются до закрытия producer, чтобы их результаты были записаны
+	ln := newLanes(fetchCtx, rule.lanes, rule.producer.batchSize, func(msg kafka.Message) {
+		if err := w.handle(msg); err != nil {
+			w.fail.set(err)
+			return
+		}
 
-			// Преобразум сообщения для удобства разбора
-			if matched {
-				var uniferEvents = make(map[string]interface{})
-				var pEvent map[string]interface{}
-
-				if err := json.Unmarshal([]byte(strMsg), &pEvent); err != nil {
-					return fmt.Errorf("worker:%v - invalid JSON parse: %w", wrkConfig.ID, err)
-				}
-
-				// Вычисляем уникальных идентификатор для записи
-				hex := calculateHash(pEvent, wrkConfig.Config.EntityHash)
-				uniferEvents["entity"] = hex
-
-				// Унификация полей
-				err = unificationFields(pEvent, wrkConfig.Config.Unifier, &uniferEvents)
-				if err != nil {
-					lg.Error(err.Error())
-				}
-
-				// Допольнительная обработка
-				err = extraProcess(wrkConfig.Config.ExtraProcess, &uniferEvents)
-				if err != nil {
-					lg.Error(err.Error())
-				}
-
-				buf, err := json.Marshal(uniferEvents)
-				if err != nil {
-					return fmt.Errorf("worker:%v - failed stringify message: %w", wrkConfig.ID, err)
-				}
-
-				_, err = p.WriteMessages(kafka.Message{Value: buf})
-				if err != nil {
-					return fmt.Errorf("worker:%v - failed to write messages: %w", wrkConfig.ID, err)
-				}
-			}
-		case <-wrkConfig.Stop:
-			lg.Info("Worker stop", zap.String("ID", wrkConfig.ID))
+		w.acks.release(msg)
+	})
+	defer ln.close()
 
-			err := r.Close()
-			if err != nil {
-				return fmt.Errorf("worker:%v - failed close consumer: %w", wrkConfig.ID, err)
+	// Вычитываем сообщения
+	for {
+		msg, err := r.FetchMessage(fetchCtx)
+		if err == nil {
+			msg, err = w.acks.add(fetchCtx, msg)
+		}
+		if err == nil {
+			err = ln.dispatch(msg)
+		}
+		if err != nil {
+			if fErr := w.fail.get(); fErr != nil {
+				return fErr
 			}
-
-			err = p.Close()
-			if err != nil {
-				return fmt.Errorf("worker:%v - failed close producer: %w", wrkConfig.ID, err)
+			if ctx.Err() != nil {
+				lg.Info("Worker stop", zap.String("ID", wrkConfig.ID))
+				return nil
 			}
-
-			return nil
+			return fmt.Errorf("worker:%v - failed read message: %w", wrkConfig.ID, err)
 		}
 	}
 }
 
-func extraProcess(cfgExtraProcess []models.ExtraProcess, uEvent *map[string]interface{}) error {
-	for _, ep := range cfgExtraProcess {
-		switch ep.Func {
-		case "__if":
-			r := __if(*uEvent, ep.Args)
-			(*uEvent)[ep.To] = r
-		case "__stringConstant":
-			r := __stringConstant(ep.Args)
-			(*uEvent)[ep.To] = r
-		default:
-			return fmt.Errorf("unknown func: %v", ep.Func)
+// maxInFlight - число пачек producer, которые могут записываться одновременно.
+const maxInFlight = 10
+
+// completed вызывается producer после записи пачки результатов. Ошибка записи
+// не относится к событиям и не обрабатывается политикой onError: сообщения не
+// подтверждаются, воркер останавливается и прочитает их снова после перезапуска.
+func (w *runner) completed(msgs []kafka.Message, err error) {
+	if err != nil {
+		w.fail.set(fmt.Errorf("worker:%v - failed to write messages: %w", w.wrk.ID, err))
+		return
+	}
+
+	for _, m := range msgs {
+		out, ok := m.WriterData.(*outbound)
+		if !ok {
+			continue
 		}
+
+		w.emitted(1)
+		w.acks.release(out.src)
 	}
+}
 
-	return nil
+// emitted учитывает n записанных результатов.
+func (w *runner) emitted(n int64) {
+	w.wrk.stats.emitted.Add(n)
+	metrics.EventsEmitted.WithLabelValues(w.wrk.ID).Add(float64(n))
 }
 
-func unificationFields(event map[string]interface{}, cfgUnifier []models.Unifier, uEvent *map[string]interface{}) error {
-	for _, u := range cfgUnifier {
-		v, found := event[u.Expression]
-		if found {
-			switch u.Type {
-			// TODO: Логировать когда преобразование не получилось
-			case "string":
-				v, ok := v.(string)
-				if ok {
-					(*uEvent)[u.Name] = v
-				}
-			case "int":
-				vv, ok := v.(int)
-				if ok {
-					(*uEvent)[u.Name] = vv
-					return nil
-				}
-
-				v, ok := v.(string)
-				if !ok {
-					return fmt.Errorf("failed int parse to string: %v", v)
-				}
-
-				i, err := strconv.Atoi(v)
-				if err != nil {
-					return fmt.Errorf("failed int parse: %w", err)
-				}
-
-				(*uEvent)[u.Name] = i
-			case "timestamp":
-				v, ok := v.(string)
-				if ok {
-					v, err := time.Parse(time.RFC3339, v)
-
-					if err != nil {
-						return fmt.Errorf("failed date parse: %w", err)
-					}
-
-					(*uEvent)[u.Name] = v.Format(time.RFC3339)
-				}
-			default:
-				return fmt.Errorf("unknown type: %v", u.Type)
-			}
+// handle обрабатывает одно сообщение. Ошибка означает, что воркер нужно остановить.
+func (w *runner) handle(msg kafka.Message) error {
+	id := w.wrk.ID
+	started := time.Now()
+	defer func() {
+		metrics.ProcessingDuration.WithLabelValues(id).Observe(time.Since(started).Seconds())
+	}()
+
+	w.wrk.stats.consumed.Add(1)
+	metrics.EventsConsumed.WithLabelValues(id).Inc()
+	lag := w.wrk.stats.setLag(msg.Partition, msg.Offset, msg.HighWaterMark)
+	metrics.SetReaderLag(id, msg.Partition, lag)
+
+	// Правило читается на каждое сообщение, чтобы подхватить замену на лету
+	rule := w.wrk.rule.Load()
+
+	res, err := rule.Process(msg.Value)
+	if err != nil {
+		return w.handleError(rule, msg, err)
+	}
+
+	if !res.Matched {
+		metrics.EventsFiltered.WithLabelValues(id).Inc()
+		return nil
+	}
+	w.wrk.stats.matched.Add(1)
+
+	if len(res.Errors) != 0 {
+		metrics.TransformErrors.WithLabelValues(id).Add(float64(len(res.Errors)))
+
+		if rule.OnError().Strict {
+			return w.handleError(rule, msg, errors.Join(res.Errors...))
+		}
+
+		w.wrk.stats.errored.Add(1)
+		for _, e := range res.Errors {
+			w.lg.Error(e.Error(), zap.String("ID", id))
 		}
 	}
 
-	return nil
-}
+	meta := sourceMeta{ruleID: id, ruleVersion: rule.Version(), src: msg, processedAt: time.Now()}
+	if rule.envelope.meta == MetaField {
+		res.Event[MetaKey] = meta.fields()
+	}
+
+	if c := w.wrk.contracts.get(rule.Config().TopicTo); c != nil && c.Mode() != ContractOff {
+		if err := c.Validate(res.Event); err != nil {
+			metrics.ContractViolations.WithLabelValues(id).Inc()
 
-func calculateHash(event map[string]interface{}, cfgEntHash []string) string {
-	strHash := ""
-	for _, eh := range cfgEntHash {
-		v, found := event[eh]
-		if found {
-			s, ok := v.(string)
-			if ok {
-				strHash += strings.TrimSpace(s)
+			if c.Mode() == ContractEnforce {
+				return w.handleError(rule, msg, err)
 			}
+			w.lg.Warn(err.Error(), zap.String("ID", id))
 		}
 	}
 
-	// Вычисляем хэш
-	hash := md5.Sum([]byte(strHash))
-	hexStr := hex.EncodeToString(hash[:])
-
-	return hexStr
-}
+	buf, err := rule.Encode(res.Event)
+	if err != nil {
+		return w.handleError(rule, msg, fmt.Errorf("failed encode message: %w", err))
+	}
 
-// Function fot extra process!
-//
-//nolint:stylecheck // This legal name
-func __if(uniEvent map[string]interface{}, args string) string {
-	aSlice := strings.Split(args, ",")
-	for i, v := range aSlice {
-		aSlice[i] = strings.TrimSpace(v)
+	out := rule.envelope.message(res.Event, buf, meta)
+	out.WriterData = &outbound{src: msg}
+	// Ошибка записи не относится к событию, воркер останавливается
+	if err := w.emit(out); err != nil {
+		return fmt.Errorf("worker:%v - failed to write messages: %w", id, err)
 	}
 
-	var field, stmn, result string = aSlice[0], aSlice[1], aSlice[2]
+	return nil
+}
 
-	v, ok := uniEvent[field]
-	if ok {
-		if v == stmn {
-			return result
+// handleError обрабатывает ошибку события согласно политике правила.
+func (w *runner) handleError(rule *Rule, msg kafka.Message, cause error) error {
+	id := w.wrk.ID
+	w.wrk.stats.errored.Add(1)
+
+	switch rule.OnError().Policy {
+	case PolicyStop:
+		return fmt.Errorf("worker:%v - %w", id, cause)
+	case PolicyDeadLetter:
+		if err := w.deadLetter(deadLetterMessage(id, msg, cause)); err != nil {
+			return fmt.Errorf("worker:%v - failed to write dead letter: %w", id, err)
 		}
+
+		metrics.EventsDeadLettered.WithLabelValues(id).Inc()
+		w.lg.With(zap.Error(cause)).Warn("Event sent to dead letter topic",
+			zap.String("ID", id),
+			zap.Int("partition", msg.Partition),
+			zap.Int64("offset", msg.Offset),
+		)
+
+		return nil
 	}
 
-	return ""
+	w.lg.With(zap.Error(cause)).Warn("Event skipped",
+		zap.String("ID", id),
+		zap.Int("partition", msg.Partition),
+		zap.Int64("offset", msg.Offset),
+	)
+
+	return nil
 }
 
-//nolint:stylecheck // This legal name
-func __stringConstant(args string) string {
-	aSlice := strings.Split(args, ",")
-	for i, v := range aSlice {
-		aSlice[i] = strings.TrimSpace(v)
+// closeWriter закрывает producer, дописывающий накопленные пачки, не дольше
+// отмены ctx. Незавершенное закрытие продолжится в фоне.
+func closeWriter(ctx context.Context, out io.Closer) error {
+	closed := make(chan error, 1)
+	go func() {
+		closed <- out.Close()
+	}()
+
+	select {
+	case err := <-closed:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-
-	var c string = aSlice[0]
-	return c
 }
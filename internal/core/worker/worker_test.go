@@ -1,6 +1,7 @@
 package worker
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/dedpnd/unifier/internal/models"
@@ -80,7 +81,7 @@ func Test_extraProcess(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if err := extraProcess(tt.args.cfgExtraProcess, tt.args.uEvent); (err != nil) != tt.wantErr {
+			if err := applyExtraProcess(tt.args.cfgExtraProcess, *tt.args.uEvent); (err != nil) != tt.wantErr {
 				t.Errorf("extraProcess() error = %v, wantErr %v", err, tt.wantErr)
 			}
 
@@ -130,6 +131,27 @@ func Test_unificationFields(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "Nested field must be string",
+			args: args{
+				event: map[string]interface{}{
+					"testFrom": map[string]interface{}{
+						"list": []interface{}{"qwerty"},
+					},
+				},
+				cfgUnifier: []models.Unifier{{
+					Name:       "testString",
+					Type:       "string",
+					Expression: "testFrom.list[0]",
+				}},
+				uEvent: &map[string]interface{}{},
+			},
+			want: want{
+				key:   "testString",
+				value: "qwerty",
+			},
+			wantErr: false,
+		},
 		{
 			name: "Field must be int",
 			args: args{
@@ -192,7 +214,7 @@ func Test_unificationFields(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if err := unificationFields(tt.args.event, tt.args.cfgUnifier, tt.args.uEvent); (err != nil) != tt.wantErr {
+			if err := applyUnifier(tt.args.event, tt.args.cfgUnifier, *tt.args.uEvent); (err != nil) != tt.wantErr {
 				t.Errorf("unificationFields() error = %v, wantErr %v", err, tt.wantErr)
 			}
 
@@ -229,10 +251,29 @@ func Test_calculateHash(t *testing.T) {
 			want:    "d8578edf8458ce06fbc5bb76a58c5ca4",
 			wantErr: false,
 		},
+		{
+			name: "Get hash from nested fields must be correct",
+			args: args{
+				event: map[string]interface{}{
+					"test": map[string]interface{}{
+						"string": []interface{}{"qwe", "rty"},
+					},
+				},
+				cfgEntHash: []string{"test.string[*]"},
+			},
+			want:    "d8578edf8458ce06fbc5bb76a58c5ca4",
+			wantErr: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := calculateHash(tt.args.event, tt.args.cfgEntHash)
+			paths, err := compileEntityHash(tt.args.cfgEntHash)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("compileEntityHash() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			got := calculateHash(tt.args.event, paths)
 			if got != tt.want {
 				t.Errorf("calculateHash() = %v, want %v", got, tt.want)
 			}
@@ -241,3 +282,23 @@ func Test_calculateHash(t *testing.T) {
 		})
 	}
 }
+
+// Применяет дополнительную обработку так же, как скомпилированное правило.
+func applyExtraProcess(cfg []models.ExtraProcess, uEvent map[string]interface{}) error {
+	funcs, err := compileExtraProcess(cfg)
+	if err != nil {
+		return err
+	}
+
+	return errors.Join(extraProcess(funcs, uEvent)...)
+}
+
+// Применяет унификацию полей так же, как скомпилированное правило.
+func applyUnifier(event map[string]interface{}, cfg []models.Unifier, uEvent map[string]interface{}) error {
+	fields, err := compileUnifier(cfg)
+	if err != nil {
+		return err
+	}
+
+	return errors.Join(unificationFields(event, fields, uEvent)...)
+}
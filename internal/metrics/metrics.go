@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "unifier"
+
+// Счетчики конвейера обработки событий по правилам.
+var (
+	EventsConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_consumed_total",
+		Help:      "Events read from topicFrom.",
+	}, []string{"rule"})
+
+	EventsFiltered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_filtered_total",
+		Help:      "Events dropped by the rule filter.",
+	}, []string{"rule"})
+
+	EventsEmitted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_emitted_total",
+		Help:      "Unified events written to topicTo.",
+	}, []string{"rule"})
+
+	TransformErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transform_errors_total",
+		Help:      "Unifier and extraProcess conversion errors.",
+	}, []string{"rule"})
+
+	EventsDeadLettered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_dead_lettered_total",
+		Help:      "Events written to the dead letter topic.",
+	}, []string{"rule"})
+
+	ProcessingDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "event_processing_seconds",
+		Help:      "Time from reading an event to finishing its processing.",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 10),
+	}, []string{"rule"})
+
+	ReaderLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "kafka_reader_lag",
+		Help:      "Consumer lag of the rule reader by partition.",
+	}, []string{"rule", "partition"})
+
+	ContractViolations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "contract_violations_total",
+		Help:      "Unified events not matching the topicTo schema.",
+	}, []string{"rule"})
+
+	WorkerRestarts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "worker_restarts_total",
+		Help:      "Worker restarts after errors.",
+	}, []string{"rule"})
+)
+
+// HTTPRequestDuration - длительность HTTP запросов по маршруту и статусу.
+var HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "http_request_duration_seconds",
+	Help:      "HTTP request duration by route and status.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"method", "route", "status"})
+
+// SetReaderLag обновляет отставание консьюмера правила по партиции.
+func SetReaderLag(rule string, partition int, lag int64) {
+	ReaderLag.WithLabelValues(rule, strconv.Itoa(partition)).Set(float64(lag))
+}
+
+// DeleteRule удаляет серии удаленного правила.
+func DeleteRule(rule string) {
+	labels := prometheus.Labels{"rule": rule}
+
+	EventsConsumed.DeletePartialMatch(labels)
+	EventsFiltered.DeletePartialMatch(labels)
+	EventsEmitted.DeletePartialMatch(labels)
+	TransformErrors.DeletePartialMatch(labels)
+	EventsDeadLettered.DeletePartialMatch(labels)
+	ProcessingDuration.DeletePartialMatch(labels)
+	ReaderLag.DeletePartialMatch(labels)
+	ContractViolations.DeletePartialMatch(labels)
+	WorkerRestarts.DeletePartialMatch(labels)
+}
+
+// Handler отдает метрики в формате Prometheus.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
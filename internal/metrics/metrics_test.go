@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetReaderLag(t *testing.T) {
+	SetReaderLag("lag", 2, 15)
+
+	assert.Equal(t, float64(15), testutil.ToFloat64(ReaderLag.WithLabelValues("lag", "2")))
+}
+
+func TestDeleteRule(t *testing.T) {
+	EventsConsumed.WithLabelValues("del").Add(3)
+	EventsEmitted.WithLabelValues("del").Inc()
+	SetReaderLag("del", 0, 1)
+	EventsConsumed.WithLabelValues("keep").Inc()
+
+	DeleteRule("del")
+
+	assert.Equal(t, 1, testutil.CollectAndCount(EventsConsumed, "unifier_events_consumed_total"))
+	assert.Equal(t, float64(1), testutil.ToFloat64(EventsConsumed.WithLabelValues("keep")))
+	assert.Equal(t, 0, testutil.CollectAndCount(EventsEmitted))
+}
+
+func TestHandler(t *testing.T) {
+	HTTPRequestDuration.WithLabelValues(http.MethodGet, "/api/rules", "200").Observe(0.01)
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, strings.Contains(rec.Body.String(), `unifier_http_request_duration_seconds_count{method="GET",route="/api/rules",status="200"} 1`))
+}
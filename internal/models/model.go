@@ -1,5 +1,10 @@
 package models
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type User struct {
 	ID    int    `json:"id"`
 	Login string `json:"login"`
@@ -7,28 +12,162 @@ type User struct {
 }
 
 type Rule struct {
+	ID      int    `json:"id"`
+	Rule    Config `json:"rule"`
+	Owner   *int   `json:"owner"`
+	Version int    `json:"version"`
+}
+
+// Author - пользователь, изменивший правило.
+type Author struct {
 	ID    int    `json:"id"`
-	Rule  Config `json:"rule"`
-	Owner *int   `json:"owner"`
+	Login string `json:"login"`
+}
+
+// Действия над правилом, записываемые в историю.
+const (
+	ActionCreate   = "create"
+	ActionUpdate   = "update"
+	ActionRollback = "rollback"
+	ActionDelete   = "delete"
+)
+
+// RuleVersion - версия правила из истории изменений.
+type RuleVersion struct {
+	RuleID  int    `json:"ruleId"`
+	Version int    `json:"version"`
+	Action  string `json:"action"`
+	// Rule - конфигурация после изменения, nil для удаления
+	Rule *Config `json:"rule"`
+	// Author - nil для правил, созданных до ведения истории
+	Author    *Author   `json:"author"`
+	CreatedAt time.Time `json:"createdAt"`
 }
 
 type Config struct {
 	TopicFrom    string         `json:"topicFrom"`
+	Format       *Format        `json:"format,omitempty"`
 	Filter       Filter         `json:"filter"`
+	Extract      []Extract      `json:"extract,omitempty"`
 	EntityHash   []string       `json:"entityHash"`
 	Unifier      []Unifier      `json:"unifier"`
 	ExtraProcess []ExtraProcess `json:"extraProcess"`
 	TopicTo      string         `json:"topicTo"`
+	Output       *Output        `json:"output,omitempty"`
+	Producer     *Producer      `json:"producer,omitempty"`
+	Envelope     *Envelope      `json:"envelope,omitempty"`
+	Concurrency  *Concurrency   `json:"concurrency,omitempty"`
+	OnError      *OnError       `json:"onError,omitempty"`
+	// Delivery - гарантия доставки: at_least_once (по умолчанию) или exactly_once
+	Delivery string `json:"delivery,omitempty"`
 }
 
+// Format - формат входных сообщений. По умолчанию JSON.
+type Format struct {
+	// Type - json, cef, leef, syslog, kv или csv
+	Type string `json:"type"`
+	// PairSeparator - разделитель пар для kv, по умолчанию пробельные символы
+	PairSeparator string `json:"pairSeparator,omitempty"`
+	// KVSeparator - разделитель ключа и значения для kv, по умолчанию "="
+	KVSeparator string `json:"kvSeparator,omitempty"`
+	// Delimiter - разделитель полей для csv, по умолчанию ","
+	Delimiter string `json:"delimiter,omitempty"`
+	// Columns - имена колонок csv, пустое имя пропускает колонку
+	Columns []string `json:"columns,omitempty"`
+}
+
+// Filter - условие отбора событий. Операторы одного узла объединяются
+// через "и", пустой фильтр пропускает все события.
 type Filter struct {
-	Regexp string `json:"regexp"`
+	// Regexp - устаревший фильтр по регулярному выражению над исходным сообщением
+	Regexp string `json:"regexp,omitempty"`
+
+	And []Filter `json:"and,omitempty"`
+	Or  []Filter `json:"or,omitempty"`
+	Not *Filter  `json:"not,omitempty"`
+
+	// Field - путь к полю события, к которому применяются операторы ниже
+	Field  string        `json:"field,omitempty"`
+	Eq     interface{}   `json:"eq,omitempty"`
+	In     []interface{} `json:"in,omitempty"`
+	Exists *bool         `json:"exists,omitempty"`
+	Gt     *float64      `json:"gt,omitempty"`
+	Gte    *float64      `json:"gte,omitempty"`
+	Lt     *float64      `json:"lt,omitempty"`
+	Lte    *float64      `json:"lte,omitempty"`
+	CIDR   string        `json:"cidr,omitempty"`
+	Match  string        `json:"match,omitempty"`
+}
+
+// OnError - политика обработки событий, которые не удалось обработать.
+type OnError struct {
+	// Policy - skip (по умолчанию), deadLetter или stop
+	Policy string `json:"policy,omitempty"`
+	// Topic - топик для недоставленных событий при политике deadLetter
+	Topic string `json:"topic,omitempty"`
+	// Strict - ошибки преобразования полей тоже обрабатываются политикой,
+	// иначе они только логируются, а событие отправляется без этих полей
+	Strict bool `json:"strict,omitempty"`
+}
+
+// TopicSchema - контракт документов выходного топика.
+type TopicSchema struct {
+	Topic string `json:"topic"`
+	// Schema - JSON Schema документа
+	Schema json.RawMessage `json:"schema"`
+	// Mode - проверка документов воркером: enforce, warn или off
+	Mode string `json:"mode"`
+	// Owner - пользователь, создавший схему. Только он может изменить или удалить ее
+	Owner     *int      `json:"owner"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Output - кодирование событий для topicTo.
+type Output struct {
+	// Format - json, avro или protobuf, по умолчанию json
+	Format string `json:"format"`
+	// Schema - схема Avro в JSON или текст файла .proto
+	Schema string `json:"schema,omitempty"`
+	// Message - полное имя сообщения protobuf, по умолчанию первое в файле
+	Message string `json:"message,omitempty"`
+	// SchemaID - идентификатор схемы в schema registry, если задан,
+	// сообщение предваряется магическим байтом и идентификатором
+	SchemaID int `json:"schemaId,omitempty"`
+}
+
+// Extract - извлечение полей из текстового поля события шаблонами grok.
+type Extract struct {
+	// Field - исходное поле события
+	Field string `json:"field"`
+	// Patterns - шаблоны, применяется первый совпавший
+	Patterns []string `json:"patterns"`
+	// Definitions - дополнительные именованные шаблоны для %{NAME}
+	Definitions map[string]string `json:"definitions,omitempty"`
+	// Optional - отсутствие совпадения не считается ошибкой
+	Optional bool `json:"optional,omitempty"`
 }
 
 type Unifier struct {
 	Name       string `json:"name"`
 	Type       string `json:"type"`
 	Expression string `json:"expression"`
+	// Timestamp - настройки разбора для типа timestamp
+	Timestamp *Timestamp `json:"timestamp,omitempty"`
+}
+
+// Timestamp описывает разбор и нормализацию времени.
+type Timestamp struct {
+	// Formats - входные форматы по порядку: раскладки Go, их имена (RFC3339, syslog ...)
+	// или epoch_s, epoch_ms, epoch_ns. По умолчанию RFC3339.
+	Formats []string `json:"formats,omitempty"`
+	// Timezone - часовой пояс источника для форматов без смещения, по умолчанию UTC
+	Timezone string `json:"timezone,omitempty"`
+	// Output - формат результата: раскладка Go, ее имя или epoch_*, по умолчанию RFC3339
+	Output string `json:"output,omitempty"`
+	// OutputTimezone - часовой пояс результата, по умолчанию UTC
+	OutputTimezone string `json:"outputTimezone,omitempty"`
+	// Precision - точность результата: s, ms, us, ns. По умолчанию s или единица epoch_* вывода
+	Precision string `json:"precision,omitempty"`
 }
 
 type ExtraProcess struct {
@@ -36,3 +175,38 @@ type ExtraProcess struct {
 	Args string `json:"args"`
 	To   string `json:"to"`
 }
+
+// Producer - параметры записи в topicTo.
+type Producer struct {
+	// Balancer - выбор партиции: hash (по полю entity, по умолчанию), roundRobin или leastBytes
+	Balancer string `json:"balancer,omitempty"`
+	// BatchSize - максимальное число сообщений в пачке, по умолчанию 100
+	BatchSize int `json:"batchSize,omitempty"`
+	// BatchTimeout - время ожидания заполнения пачки, например "50ms", по умолчанию 10ms
+	BatchTimeout string `json:"batchTimeout,omitempty"`
+	// Compression - none (по умолчанию), gzip, snappy, lz4 или zstd
+	Compression string `json:"compression,omitempty"`
+	// Acks - подтверждение записи брокером: all (по умолчанию), one или none
+	Acks string `json:"acks,omitempty"`
+}
+
+// Envelope - ключ, заголовки и метаданные сообщений topicTo.
+type Envelope struct {
+	// Key - путь к полю унифицированного события для ключа сообщения, по умолчанию entity
+	Key string `json:"key,omitempty"`
+	// CopyHeaders - заголовки исходного сообщения, которые копируются в результат, "*" - все
+	CopyHeaders []string `json:"copyHeaders,omitempty"`
+	// Headers - заголовки с постоянными значениями, заменяют скопированные
+	Headers map[string]string `json:"headers,omitempty"`
+	// Meta - куда записать метаданные обработки: field (блок _meta) или headers,
+	// по умолчанию не записываются
+	Meta string `json:"meta,omitempty"`
+}
+
+// Concurrency - параллельная обработка событий правила.
+type Concurrency struct {
+	// Workers - число обработчиков, по умолчанию 1
+	Workers int `json:"workers,omitempty"`
+	// Ordering - что сохраняет порядок обработки: partition (по умолчанию) или sourceKey
+	Ordering string `json:"ordering,omitempty"`
+}